@@ -1,9 +1,15 @@
 package ch13
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"maps"
+	"shared/dbtx"
+	"slices"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -17,43 +23,74 @@ type Product struct {
 	Category string
 }
 
+// ErrInsufficientStock is returned by DecrementStock when the product exists
+// but has fewer units than requested.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 // ProductStore manages product operations
 type ProductStore struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
+
+	// reservationTTL is how long a Reserve holds stock before the reaper may
+	// hand it back.
+	reservationTTL time.Duration
+
+	// slowLog, when set, hears about operations slower than slowThreshold.
+	slowLog       QueryLogger
+	slowThreshold time.Duration
+
+	// stmts holds the hot-path statements, prepared on first use and keyed
+	// by their unbound query. Close releases them.
+	stmtMu sync.Mutex
+	stmts  map[string]*sql.Stmt
+	closed bool
 }
 
-// NewProductStore creates a new ProductStore with the given database connection
+// NewProductStore creates a new ProductStore with the given SQLite database connection
 func NewProductStore(db *sql.DB) *ProductStore {
-	return &ProductStore{db: db}
+	store, _ := NewProductStoreWithDriver(db, DriverSQLite)
+	return store
+}
+
+// NewProductStoreWithDriver creates a ProductStore for a database opened with
+// InitDBWithDriver, so queries use that driver's placeholder style.
+func NewProductStoreWithDriver(db *sql.DB, driver string) (*ProductStore, error) {
+	d, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &ProductStore{db: db, dialect: d, reservationTTL: RESERVATION_TTL}, nil
 }
 
 // InitDB sets up a new SQLite database and creates the products table
 func InitDB(dbPath string) (*sql.DB, error) {
-	// TODO: Open a SQLite database connection
-	// TODO: Create the products table if it doesn't exist
-	// The table should have columns: id, name, price, quantity, category
+	return InitDBWithDriver(DriverSQLite, dbPath)
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+// InitDBWithDriver opens dsn with driver (DriverSQLite or DriverPostgres) and
+// creates the tables using that database's DDL.
+func InitDBWithDriver(driver, dsn string) (*sql.DB, error) {
+	d, err := dialectFor(driver)
 	if err != nil {
 		return nil, err
 	}
 
-	if db.Ping() != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("error connecting database %s: %w", dbPath, err)
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	initTable := `create TABLE IF NOT EXISTS products (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		price REAL NOT NULL,
-		quantity INTEGER NOT NULL DEFAULT 0,
-		category TEXT
-	)`
-
-	if _, err := db.Exec(initTable); err != nil {
+	if err := db.Ping(); err != nil {
 		_ = db.Close()
-		return nil, err
+		return nil, fmt.Errorf("error connecting database %s: %w", dsn, err)
+	}
+
+	for _, ddl := range d.schema() {
+		if _, err := db.Exec(ddl); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
 	}
 
 	return db, nil
@@ -61,32 +98,32 @@ func InitDB(dbPath string) (*sql.DB, error) {
 
 // CreateProduct adds a new product to the database
 func (ps *ProductStore) CreateProduct(product *Product) error {
-	query := `INSERT INTO products (name, price, quantity, category) VALUES (?, ?, ?, ?)`
-
-	result, err := ps.db.Exec(query, product.Name, product.Price, product.Quantity, product.Category)
-	if err != nil {
-		return err
-	}
+	defer ps.timeQuery("CreateProduct")()
 
-	id, err := result.LastInsertId()
+	// RETURNING rather than LastInsertId, which the postgres drivers do not support.
+	stmt, err := ps.stmt(`INSERT INTO products (name, price, quantity, category) VALUES (?, ?, ?, ?) RETURNING id`)
 	if err != nil {
 		return err
 	}
-	product.ID = id
 
-	return nil
+	return stmt.QueryRow(product.Name, product.Price, product.Quantity, product.Category).Scan(&product.ID)
 }
 
 // GetProduct retrieves a product by ID
 func (ps *ProductStore) GetProduct(id int64) (*Product, error) {
+	defer ps.timeQuery("GetProduct")()
+
 	// TODO: Query the database for a product with the given ID
 	// TODO: Return a Product struct populated with the data or an error if not found
 
-	query := `SELECT id, name, price, quantity, category FROM products WHERE id = ?`
+	stmt, err := ps.stmt(`SELECT id, name, price, quantity, category FROM products WHERE id = ?`)
+	if err != nil {
+		return nil, err
+	}
 
 	p := &Product{}
 
-	err := ps.db.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.Price, &p.Quantity, &p.Category)
+	err = stmt.QueryRow(id).Scan(&p.ID, &p.Name, &p.Price, &p.Quantity, &p.Category)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("product with id %d not found", id)
@@ -100,12 +137,14 @@ func (ps *ProductStore) GetProduct(id int64) (*Product, error) {
 
 // UpdateProduct updates an existing product
 func (ps *ProductStore) UpdateProduct(product *Product) error {
+	defer ps.timeQuery("UpdateProduct")()
+
 	// TODO: Update the product in the database
 	// TODO: Return an error if the product doesn't exist
 
 	query := `UPDATE products SET name = ?, price = ?, quantity = ?, category = ? WHERE id = ?`
 
-	result, err := ps.db.Exec(query, product.Name, product.Price, product.Quantity, product.Category, product.ID)
+	result, err := ps.db.Exec(ps.dialect.rebind(query), product.Name, product.Price, product.Quantity, product.Category, product.ID)
 	if err != nil {
 		return err
 	}
@@ -124,12 +163,14 @@ func (ps *ProductStore) UpdateProduct(product *Product) error {
 
 // DeleteProduct removes a product by ID
 func (ps *ProductStore) DeleteProduct(id int64) error {
+	defer ps.timeQuery("DeleteProduct")()
+
 	// TODO: Delete the product from the database
 	// TODO: Return an error if the product doesn't exist
 	query := `DELETE FROM products WHERE id = ?`
 
 	// 1. Execute the deletion
-	result, err := ps.db.Exec(query, id)
+	result, err := ps.db.Exec(ps.dialect.rebind(query), id)
 	if err != nil {
 		return err
 	}
@@ -146,20 +187,23 @@ func (ps *ProductStore) DeleteProduct(id int64) error {
 	return nil
 }
 
-// ListProducts returns all products with optional filtering by category
+// ListProducts returns all products with optional filtering by category,
+// ordered by ID
 func (ps *ProductStore) ListProducts(category string) ([]*Product, error) {
+	defer ps.timeQuery("ListProducts")()
+
 	// TODO: Query the database for products
 	// TODO: If category is not empty, filter by category
 	// TODO: Return a slice of Product pointers
-	query := `SELECT id, name, price, quantity, category FROM products WHERE (? = '' OR category = ?)`
+	query, args := listProductsQuery(category)
 
-	rows, err := ps.db.Query(query, category, category)
+	rows, err := ps.db.Query(ps.dialect.rebind(query+` ORDER BY id`), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var products []*Product
+	products := []*Product{}
 	for rows.Next() {
 		p := &Product{}
 		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Quantity, &p.Category); err != nil {
@@ -175,47 +219,154 @@ func (ps *ProductStore) ListProducts(category string) ([]*Product, error) {
 	return products, nil
 }
 
-// BatchUpdateInventory updates the quantity of multiple products in a single transaction
-func (ps *ProductStore) BatchUpdateInventory(updates map[int64]int) error {
-	// TODO: Start a transaction
-	// TODO: For each product ID in the updates map, update its quantity
-	// TODO: If any update fails, roll back the transaction
-	// TODO: Otherwise, commit the transaction
-	tx, err := ps.db.Begin()
+// listProductsQuery builds the ListProducts query. An empty category means
+// every product, so it gets no WHERE clause at all rather than one the planner
+// has to see through.
+func listProductsQuery(category string) (string, []any) {
+	query := `SELECT id, name, price, quantity, category FROM products`
+	if category == "" {
+		return query, nil
+	}
+	return query + ` WHERE category = ?`, []any{category}
+}
+
+// DecrementStock takes qty units of a product in a single statement, so two
+// concurrent orders can never drive the quantity below zero.
+func (ps *ProductStore) DecrementStock(id int64, qty int) error {
+	defer ps.timeQuery("DecrementStock")()
+
+	return ps.decrementStock(ps.db, id, qty)
+}
+
+// execQuerier is what decrementStock needs; both *sql.DB and *sql.Tx have it.
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (ps *ProductStore) decrementStock(db execQuerier, id int64, qty int) error {
+	if qty <= 0 {
+		return fmt.Errorf("decrement quantity must be positive, got %d", qty)
+	}
+
+	query := `UPDATE products SET quantity = quantity - ? WHERE id = ? AND quantity >= ?`
+
+	result, err := db.Exec(ps.dialect.rebind(query), qty, id, qty)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	query := `UPDATE products SET quantity = ? WHERE id = ?`
 
-	stmt, err := tx.Prepare(query)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	if rowsAffected > 0 {
+		return nil
+	}
 
-	for id, newQuantity := range updates {
-		result, err := stmt.Exec(newQuantity, id)
-		if err != nil {
-			return fmt.Errorf("failed to update product %d: %w", id, err)
-		}
+	// Nothing matched: either the product is gone or it is short on stock.
+	var exists bool
+	if err := db.QueryRow(ps.dialect.rebind(`SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)`), id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("product with id %d not found", id)
+	}
+	return fmt.Errorf("product with id %d: %w", id, ErrInsufficientStock)
+}
+
+// MAX_TX_RETRIES is how many times a transaction that hit SQLITE_BUSY is run
+// again before the lock error is returned to the caller.
+const MAX_TX_RETRIES = 3
+
+// BatchUpdateInventory updates the quantity of multiple products in a single transaction.
+// If another connection holds the write lock, the whole batch is retried.
+func (ps *ProductStore) BatchUpdateInventory(updates map[int64]int) error {
+	defer ps.timeQuery("BatchUpdateInventory")()
+
+	return dbtx.WithRetryTx(ps.db, func(tx *sql.Tx) error {
+		query := `UPDATE products SET quantity = ? WHERE id = ?`
 
-		rowsAffected, err := result.RowsAffected()
+		stmt, err := tx.Prepare(ps.dialect.rebind(query))
 		if err != nil {
 			return err
 		}
-		if rowsAffected == 0 {
-			return fmt.Errorf("product with id %d not found", id)
+		defer stmt.Close()
+
+		for id, newQuantity := range updates {
+			result, err := stmt.Exec(newQuantity, id)
+			if err != nil {
+				return fmt.Errorf("failed to update product %d: %w", id, err)
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if rowsAffected == 0 {
+				return fmt.Errorf("product with id %d not found", id)
+			}
 		}
-	}
+		return nil
+	}, MAX_TX_RETRIES)
+}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
+// BatchUpdateInventoryPartial is the best-effort form of BatchUpdateInventory:
+// updates that succeed are committed together, and IDs that are missing or
+// fail on their own are reported in failed instead of aborting the batch.
+// Each update runs under a savepoint so a failed statement is undone without
+// losing the others. err is only set when the batch as a whole could not be
+// applied, for example because ctx expired; nothing is committed then.
+func (ps *ProductStore) BatchUpdateInventoryPartial(ctx context.Context, updates map[int64]int) (applied []int64, failed map[int64]error, err error) {
+	defer ps.timeQuery("BatchUpdateInventoryPartial")()
 
-	return nil
+	err = dbtx.Retry(MAX_TX_RETRIES, func() error {
+		applied, failed = nil, make(map[int64]error)
 
+		tx, err := ps.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.PrepareContext(ctx, ps.dialect.rebind(`UPDATE products SET quantity = ? WHERE id = ?`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, id := range slices.Sorted(maps.Keys(updates)) {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_item`); err != nil {
+				return err
+			}
+
+			result, err := stmt.ExecContext(ctx, updates[id], id)
+			if err != nil {
+				if ctx.Err() != nil || dbtx.IsBusy(err) {
+					return err
+				}
+				if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO batch_item`); rbErr != nil {
+					return rbErr
+				}
+				failed[id] = fmt.Errorf("failed to update product %d: %w", id, err)
+			} else if rowsAffected, err := result.RowsAffected(); err != nil {
+				return err
+			} else if rowsAffected == 0 {
+				failed[id] = fmt.Errorf("product with id %d not found", id)
+			} else {
+				applied = append(applied, id)
+			}
+
+			if _, err := tx.ExecContext(ctx, `RELEASE batch_item`); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return applied, failed, nil
 }
 
 func main() {
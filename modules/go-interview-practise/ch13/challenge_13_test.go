@@ -1,8 +1,12 @@
 package ch13
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"slices"
+	"sync"
 	"testing"
 )
 
@@ -286,6 +290,9 @@ func TestListProducts(t *testing.T) {
 			if len(products) != tc.expectedSize {
 				t.Errorf("Expected %d products, got %d", tc.expectedSize, len(products))
 			}
+			if products == nil {
+				t.Errorf("Expected an empty slice, got nil")
+			}
 
 			if tc.category != "" {
 				for _, p := range products {
@@ -298,6 +305,39 @@ func TestListProducts(t *testing.T) {
 	}
 }
 
+func TestListProductsQuery(t *testing.T) {
+	testCases := []struct {
+		name      string
+		category  string
+		wantQuery string
+		wantArgs  []any
+	}{
+		{
+			name:      "Empty Category Has No WHERE",
+			category:  "",
+			wantQuery: `SELECT id, name, price, quantity, category FROM products`,
+		},
+		{
+			name:      "Category Is Bound Once",
+			category:  "Books",
+			wantQuery: `SELECT id, name, price, quantity, category FROM products WHERE category = ?`,
+			wantArgs:  []any{"Books"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, args := listProductsQuery(tc.category)
+			if query != tc.wantQuery {
+				t.Errorf("Expected query %q, got %q", tc.wantQuery, query)
+			}
+			if !slices.Equal(args, tc.wantArgs) {
+				t.Errorf("Expected args %v, got %v", tc.wantArgs, args)
+			}
+		})
+	}
+}
+
 func TestBatchUpdateInventory(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -388,3 +428,179 @@ func TestBatchUpdateInventoryRollback(t *testing.T) {
 		t.Errorf("Expected quantity to remain 10 after rollback, got %d", p1.Quantity)
 	}
 }
+
+func TestBatchUpdateInventoryPartial(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	products := []Product{
+		{Name: "Product 1", Price: 9.99, Quantity: 10, Category: "Test"},
+		{Name: "Product 2", Price: 19.99, Quantity: 20, Category: "Test"},
+	}
+	for i := range products {
+		if err := store.CreateProduct(&products[i]); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	missing := products[1].ID + 99
+	updates := map[int64]int{
+		products[0].ID: 5,
+		products[1].ID: 15,
+		missing:        1,
+	}
+
+	applied, failed, err := store.BatchUpdateInventoryPartial(context.Background(), updates)
+	if err != nil {
+		t.Fatalf("Expected partial success, got error: %v", err)
+	}
+
+	if want := []int64{products[0].ID, products[1].ID}; !slices.Equal(applied, want) {
+		t.Errorf("Expected applied %v, got %v", want, applied)
+	}
+	if len(failed) != 1 || failed[missing] == nil {
+		t.Errorf("Expected only product %d to fail, got %v", missing, failed)
+	}
+
+	for i, want := range []int{5, 15} {
+		p, err := store.GetProduct(products[i].ID)
+		if err != nil {
+			t.Fatalf("Failed to retrieve product %d: %v", i+1, err)
+		}
+		if p.Quantity != want {
+			t.Errorf("Expected quantity %d for product %d, got %d", want, i+1, p.Quantity)
+		}
+	}
+}
+
+func TestBatchUpdateInventoryPartialExpiredContext(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	product := &Product{Name: "Product 1", Price: 9.99, Quantity: 10, Category: "Test"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := store.BatchUpdateInventoryPartial(ctx, map[int64]int{product.ID: 5})
+	if err == nil {
+		t.Fatalf("Expected an error for an expired context, got nil")
+	}
+
+	p, err := store.GetProduct(product.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if p.Quantity != 10 {
+		t.Errorf("Expected quantity to remain 10, got %d", p.Quantity)
+	}
+}
+
+func TestDecrementStock(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	testCases := []struct {
+		name    string
+		qty     int
+		wantQty int
+		wantErr error
+	}{
+		{name: "Within Stock", qty: 4, wantQty: 6},
+		{name: "Exactly To Zero", qty: 10, wantQty: 0},
+		{name: "Beyond Stock", qty: 11, wantQty: 10, wantErr: ErrInsufficientStock},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			product := &Product{Name: "Stocked", Price: 1, Quantity: 10, Category: "Test"}
+			if err := store.CreateProduct(product); err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
+			}
+
+			err := store.DecrementStock(product.ID, tc.qty)
+			if tc.wantErr == nil && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected %v, got %v", tc.wantErr, err)
+			}
+
+			p, err := store.GetProduct(product.ID)
+			if err != nil {
+				t.Fatalf("Failed to retrieve product: %v", err)
+			}
+			if p.Quantity != tc.wantQty {
+				t.Errorf("Expected quantity %d, got %d", tc.wantQty, p.Quantity)
+			}
+		})
+	}
+
+	t.Run("Missing Product", func(t *testing.T) {
+		err := store.DecrementStock(9999, 1)
+		if err == nil || errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("Expected a not found error, got %v", err)
+		}
+	})
+}
+
+func TestDecrementStockConcurrent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	product := &Product{Name: "Last Units", Price: 1, Quantity: 10, Category: "Test"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	// Two orders of 6 against 10 units: only one of them can be filled.
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.DecrementStock(product.ID, 6)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var succeeded, short int
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrInsufficientStock):
+			short++
+		default:
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || short != 1 {
+		t.Errorf("Expected 1 success and 1 insufficient stock, got %d and %d", succeeded, short)
+	}
+
+	p, err := store.GetProduct(product.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if p.Quantity != 4 {
+		t.Errorf("Expected quantity 4, got %d", p.Quantity)
+	}
+}
@@ -0,0 +1,77 @@
+package ch13
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Drivers InitDBWithDriver knows how to build a schema for. The postgres
+// driver itself is not linked in; import one that registers under this name
+// (github.com/lib/pq, or pgx's stdlib with a DSN for it) in the binary.
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// dialect is the handful of SQL differences between the supported drivers.
+type dialect struct {
+	idColumn   string // auto-incrementing int64 primary key
+	floatType  string
+	dollarArgs bool // $1, $2... placeholders instead of ?
+}
+
+var dialects = map[string]dialect{
+	DriverSQLite: {
+		idColumn:  "INTEGER PRIMARY KEY AUTOINCREMENT",
+		floatType: "REAL",
+	},
+	DriverPostgres: {
+		idColumn:   "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY",
+		floatType:  "DOUBLE PRECISION",
+		dollarArgs: true,
+	},
+}
+
+func dialectFor(driver string) (dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return d, nil
+}
+
+// schema is the DDL for every table the store uses.
+func (d dialect) schema() []string {
+	return []string{
+		fmt.Sprintf(`create TABLE IF NOT EXISTS products (
+		id %s,
+		name TEXT NOT NULL,
+		price %s NOT NULL,
+		quantity INTEGER NOT NULL DEFAULT 0,
+		category TEXT
+	)`, d.idColumn, d.floatType),
+		fmt.Sprintf(initReservationsTable, d.idColumn),
+	}
+}
+
+// rebind rewrites the ? placeholders the queries are written with into the
+// driver's own style. None of the queries contain a literal ?.
+func (d dialect) rebind(query string) string {
+	if !d.dollarArgs {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
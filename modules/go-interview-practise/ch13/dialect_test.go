@@ -0,0 +1,102 @@
+package ch13
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	query := `UPDATE products SET quantity = ? WHERE id = ? AND quantity >= ?`
+
+	testCases := []struct {
+		driver string
+		want   string
+	}{
+		{driver: DriverSQLite, want: query},
+		{driver: DriverPostgres, want: `UPDATE products SET quantity = $1 WHERE id = $2 AND quantity >= $3`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.driver, func(t *testing.T) {
+			d, err := dialectFor(tc.driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := d.rebind(query); got != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInitDBWithDriverUnsupported(t *testing.T) {
+	if _, err := InitDBWithDriver("mysql", "inventory"); err == nil {
+		t.Fatal("Expected an error for an unsupported driver, got nil")
+	}
+	if _, err := NewProductStoreWithDriver(nil, "mysql"); err == nil {
+		t.Fatal("Expected an error for an unsupported driver, got nil")
+	}
+}
+
+func TestInitDBWithDriverSQLite(t *testing.T) {
+	os.Remove(testDBPath)
+	defer cleanupTestDB()
+
+	db, err := InitDBWithDriver(DriverSQLite, testDBPath)
+	if err != nil {
+		t.Fatalf("Failed to initialize test database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := NewProductStoreWithDriver(db, DriverSQLite)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	exerciseStore(t, store)
+}
+
+// exerciseStore runs one product through the store's main operations, so the
+// same checks can be pointed at any driver.
+func exerciseStore(t *testing.T, store *ProductStore) {
+	t.Helper()
+
+	product := &Product{Name: "Driver Product", Price: 4.5, Quantity: 10, Category: "Driver"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if product.ID <= 0 {
+		t.Fatalf("Expected product ID to be set after creation, got %d", product.ID)
+	}
+
+	product.Price = 5.5
+	if err := store.UpdateProduct(product); err != nil {
+		t.Fatalf("Failed to update product: %v", err)
+	}
+
+	products, err := store.ListProducts("Driver")
+	if err != nil {
+		t.Fatalf("Failed to list products: %v", err)
+	}
+	if len(products) != 1 || products[0].Price != 5.5 {
+		t.Fatalf("Expected the updated product in the listing, got %+v", products)
+	}
+
+	if err := store.DecrementStock(product.ID, 3); err != nil {
+		t.Fatalf("Failed to decrement stock: %v", err)
+	}
+	id, err := store.Reserve(product.ID, 2)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+	if err := store.Release(id); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+
+	got, err := store.GetProduct(product.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if got.Quantity != 7 {
+		t.Errorf("Expected quantity 7, got %d", got.Quantity)
+	}
+}
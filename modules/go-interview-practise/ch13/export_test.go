@@ -0,0 +1,102 @@
+package ch13
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestExportCSV(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	productsToCreate := []Product{
+		{Name: "Widget", Price: 9.99, Quantity: 10, Category: "Tools"},
+		{Name: "Novel, Hardback", Price: 20, Quantity: 3, Category: "Books"},
+		{Name: `Hammer "Pro"`, Price: 14.5, Quantity: 0, Category: "Tools"},
+	}
+	for i := range productsToCreate {
+		if err := store.CreateProduct(&productsToCreate[i]); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		category string
+		want     [][]string
+	}{
+		{
+			name:     "All Products In ID Order",
+			category: "",
+			want: [][]string{
+				csvHeader,
+				{"1", "Widget", "9.99", "10", "Tools"},
+				{"2", "Novel, Hardback", "20", "3", "Books"},
+				{"3", `Hammer "Pro"`, "14.5", "0", "Tools"},
+			},
+		},
+		{
+			name:     "One Category",
+			category: "Tools",
+			want: [][]string{
+				csvHeader,
+				{"1", "Widget", "9.99", "10", "Tools"},
+				{"3", `Hammer "Pro"`, "14.5", "0", "Tools"},
+			},
+		},
+		{
+			name:     "No Matches Is Just The Header",
+			category: "NonExistent",
+			want:     [][]string{csvHeader},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := store.ExportCSV(context.Background(), &buf, tc.category); err != nil {
+				t.Fatalf("Failed to export: %v", err)
+			}
+
+			got, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if !slices.EqualFunc(got, tc.want, slices.Equal) {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("Handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ExportCSVHandler(store).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products.csv?category=Books", nil))
+
+		if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+			t.Errorf("Expected a CSV content type, got %q", ct)
+		}
+		got, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v", err)
+		}
+		if len(got) != 2 || got[1][1] != "Novel, Hardback" {
+			t.Errorf("Expected the header and the Books product, got %q", got)
+		}
+	})
+
+	t.Run("Cancelled Context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := store.ExportCSV(ctx, &bytes.Buffer{}, ""); err == nil {
+			t.Error("Expected an error for a cancelled context, got nil")
+		}
+	})
+}
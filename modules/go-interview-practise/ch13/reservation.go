@@ -0,0 +1,208 @@
+package ch13
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"shared/dbtx"
+	"time"
+)
+
+// RESERVATION_TTL is how long reserved stock is held before it is released
+// back to the product automatically.
+const RESERVATION_TTL = 15 * time.Minute
+
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+)
+
+// ErrReservationClosed is returned when committing or releasing a reservation
+// that was already committed, released, or reaped.
+var ErrReservationClosed = errors.New("reservation is no longer pending")
+
+// expires_at is stored as Unix nanoseconds so the reaper can compare it
+// numerically on every driver. The id column type is filled in per driver by
+// dialect.schema.
+const initReservationsTable = `create TABLE IF NOT EXISTS reservations (
+	id %s,
+	product_id BIGINT NOT NULL REFERENCES products(id),
+	quantity INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+)`
+
+// Reservation is stock taken off a product but not yet sold.
+type Reservation struct {
+	ID        int64
+	ProductID int64
+	Quantity  int
+	Status    string
+	ExpiresAt time.Time
+}
+
+// Reserve takes qty units of a product and records them as a pending
+// reservation, both in one transaction. The stock comes back on Release or
+// once the reservation expires; Commit makes the sale final.
+func (ps *ProductStore) Reserve(productID int64, qty int) (int64, error) {
+	defer ps.timeQuery("Reserve")()
+
+	var reservationID int64
+	err := dbtx.WithRetryTx(ps.db, func(tx *sql.Tx) error {
+		if err := ps.decrementStock(tx, productID, qty); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO reservations (product_id, quantity, status, expires_at) VALUES (?, ?, ?, ?) RETURNING id`
+		expiresAt := time.Now().Add(ps.reservationTTL).UnixNano()
+		return tx.QueryRow(ps.dialect.rebind(query), productID, qty, ReservationPending, expiresAt).Scan(&reservationID)
+	}, MAX_TX_RETRIES)
+	if err != nil {
+		return 0, err
+	}
+	return reservationID, nil
+}
+
+// Release cancels a pending reservation and returns its stock to the product.
+func (ps *ProductStore) Release(reservationID int64) error {
+	defer ps.timeQuery("Release")()
+
+	return dbtx.WithRetryTx(ps.db, func(tx *sql.Tx) error {
+		return ps.releaseReservation(tx, reservationID)
+	}, MAX_TX_RETRIES)
+}
+
+// Commit turns a pending reservation into a sale. The stock was already taken
+// by Reserve, so only the status changes.
+func (ps *ProductStore) Commit(reservationID int64) error {
+	defer ps.timeQuery("Commit")()
+
+	return dbtx.WithRetryTx(ps.db, func(tx *sql.Tx) error {
+		return ps.closeReservation(tx, reservationID, ReservationCommitted)
+	}, MAX_TX_RETRIES)
+}
+
+// GetReservation retrieves a reservation by ID
+func (ps *ProductStore) GetReservation(id int64) (*Reservation, error) {
+	defer ps.timeQuery("GetReservation")()
+
+	query := `SELECT id, product_id, quantity, status, expires_at FROM reservations WHERE id = ?`
+
+	r := &Reservation{}
+	var expiresAt int64
+	err := ps.db.QueryRow(ps.dialect.rebind(query), id).Scan(&r.ID, &r.ProductID, &r.Quantity, &r.Status, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("reservation with id %d not found", id)
+		}
+		return nil, err
+	}
+	r.ExpiresAt = time.Unix(0, expiresAt)
+	return r, nil
+}
+
+// ReleaseExpired releases every pending reservation that expired before now
+// and returns how many it released.
+func (ps *ProductStore) ReleaseExpired(now time.Time) (int, error) {
+	defer ps.timeQuery("ReleaseExpired")()
+
+	var released int
+	err := dbtx.WithRetryTx(ps.db, func(tx *sql.Tx) error {
+		released = 0
+
+		query := `SELECT id FROM reservations WHERE status = ? AND expires_at <= ?`
+		rows, err := tx.Query(ps.dialect.rebind(query), ReservationPending, now.UnixNano())
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := ps.releaseReservation(tx, id); err != nil {
+				return err
+			}
+			released++
+		}
+		return nil
+	}, MAX_TX_RETRIES)
+	return released, err
+}
+
+// StartReaper calls ReleaseExpired every interval until ctx is done.
+func (ps *ProductStore) StartReaper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if n, err := ps.ReleaseExpired(now); err != nil {
+					log.Printf("reservation reaper: %v", err)
+				} else if n > 0 {
+					log.Printf("reservation reaper: released %d expired reservations", n)
+				}
+			}
+		}
+	}()
+}
+
+func (ps *ProductStore) releaseReservation(tx *sql.Tx, reservationID int64) error {
+	if err := ps.closeReservation(tx, reservationID, ReservationReleased); err != nil {
+		return err
+	}
+
+	var productID int64
+	var qty int
+	query := `SELECT product_id, quantity FROM reservations WHERE id = ?`
+	if err := tx.QueryRow(ps.dialect.rebind(query), reservationID).Scan(&productID, &qty); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ps.dialect.rebind(`UPDATE products SET quantity = quantity + ? WHERE id = ?`), qty, productID)
+	return err
+}
+
+// closeReservation moves a pending reservation to status. Matching on the
+// pending status makes a second Commit or Release fail instead of counting
+// the stock twice.
+func (ps *ProductStore) closeReservation(tx *sql.Tx, reservationID int64, status string) error {
+	query := `UPDATE reservations SET status = ? WHERE id = ? AND status = ?`
+	result, err := tx.Exec(ps.dialect.rebind(query), status, reservationID, ReservationPending)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		var exists bool
+		if err := tx.QueryRow(ps.dialect.rebind(`SELECT EXISTS(SELECT 1 FROM reservations WHERE id = ?)`), reservationID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("reservation with id %d not found", reservationID)
+		}
+		return fmt.Errorf("reservation with id %d: %w", reservationID, ErrReservationClosed)
+	}
+	return nil
+}
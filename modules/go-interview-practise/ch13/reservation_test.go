@@ -0,0 +1,136 @@
+package ch13
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func setupReservationStore(t *testing.T, quantity int) (*ProductStore, *Product) {
+	t.Helper()
+	db := setupTestDB(t)
+	t.Cleanup(cleanupTestDB)
+	t.Cleanup(func() { db.Close() })
+
+	store := NewProductStore(db)
+	product := &Product{Name: "Reserved", Price: 1, Quantity: quantity, Category: "Test"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	return store, product
+}
+
+func assertQuantity(t *testing.T, store *ProductStore, id int64, want int) {
+	t.Helper()
+	p, err := store.GetProduct(id)
+	if err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if p.Quantity != want {
+		t.Errorf("Expected quantity %d, got %d", want, p.Quantity)
+	}
+}
+
+func assertStatus(t *testing.T, store *ProductStore, id int64, want string) {
+	t.Helper()
+	r, err := store.GetReservation(id)
+	if err != nil {
+		t.Fatalf("Failed to retrieve reservation: %v", err)
+	}
+	if r.Status != want {
+		t.Errorf("Expected reservation status %s, got %s", want, r.Status)
+	}
+}
+
+func TestReserveCommit(t *testing.T) {
+	store, product := setupReservationStore(t, 10)
+
+	id, err := store.Reserve(product.ID, 4)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+	assertQuantity(t, store, product.ID, 6)
+
+	if err := store.Commit(id); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	assertQuantity(t, store, product.ID, 6)
+	assertStatus(t, store, id, ReservationCommitted)
+
+	// A committed reservation can no longer give its stock back.
+	if err := store.Release(id); !errors.Is(err, ErrReservationClosed) {
+		t.Errorf("Expected ErrReservationClosed releasing a committed reservation, got %v", err)
+	}
+	assertQuantity(t, store, product.ID, 6)
+}
+
+func TestReserveRelease(t *testing.T) {
+	store, product := setupReservationStore(t, 10)
+
+	id, err := store.Reserve(product.ID, 4)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+
+	if err := store.Release(id); err != nil {
+		t.Fatalf("Failed to release: %v", err)
+	}
+	assertQuantity(t, store, product.ID, 10)
+	assertStatus(t, store, id, ReservationReleased)
+
+	if err := store.Release(id); !errors.Is(err, ErrReservationClosed) {
+		t.Errorf("Expected ErrReservationClosed on a second release, got %v", err)
+	}
+	assertQuantity(t, store, product.ID, 10)
+}
+
+func TestReserveInsufficientStock(t *testing.T) {
+	store, product := setupReservationStore(t, 3)
+
+	if _, err := store.Reserve(product.ID, 4); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	assertQuantity(t, store, product.ID, 3)
+}
+
+func TestReservationExpiry(t *testing.T) {
+	store, product := setupReservationStore(t, 10)
+	store.reservationTTL = 20 * time.Millisecond
+
+	expiring, err := store.Reserve(product.ID, 4)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+	committed, err := store.Reserve(product.ID, 2)
+	if err != nil {
+		t.Fatalf("Failed to reserve: %v", err)
+	}
+	if err := store.Commit(committed); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	assertQuantity(t, store, product.ID, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.StartReaper(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r, err := store.GetReservation(expiring)
+		if err != nil {
+			t.Fatalf("Failed to retrieve reservation: %v", err)
+		}
+		if r.Status == ReservationReleased {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the reaper to release reservation %d, status is %s", expiring, r.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Only the pending reservation comes back; the committed one stays sold.
+	assertQuantity(t, store, product.ID, 8)
+	assertStatus(t, store, committed, ReservationCommitted)
+}
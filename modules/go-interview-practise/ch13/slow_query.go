@@ -0,0 +1,46 @@
+package ch13
+
+import (
+	"log"
+	"time"
+)
+
+// QueryLogger is told about store operations that took longer than the
+// threshold set with SetSlowQueryLogger.
+type QueryLogger interface {
+	SlowQuery(name string, elapsed time.Duration)
+}
+
+// QueryLoggerFunc adapts a plain function to QueryLogger.
+type QueryLoggerFunc func(name string, elapsed time.Duration)
+
+func (f QueryLoggerFunc) SlowQuery(name string, elapsed time.Duration) { f(name, elapsed) }
+
+// StdQueryLogger writes slow queries through the standard log package.
+var StdQueryLogger = QueryLoggerFunc(func(name string, elapsed time.Duration) {
+	log.Printf("slow query: %s took %v", name, elapsed)
+})
+
+// SetSlowQueryLogger reports every operation slower than threshold to logger.
+// A nil logger, the default, turns timing off. Call it before the store is
+// shared between goroutines.
+func (ps *ProductStore) SetSlowQueryLogger(logger QueryLogger, threshold time.Duration) {
+	ps.slowLog = logger
+	ps.slowThreshold = threshold
+}
+
+// timeQuery starts timing the operation name; call the returned func when it
+// is done:
+//
+//	defer ps.timeQuery("GetProduct")()
+func (ps *ProductStore) timeQuery(name string) func() {
+	if ps.slowLog == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		if elapsed := time.Since(start); elapsed > ps.slowThreshold {
+			ps.slowLog.SlowQuery(name, elapsed)
+		}
+	}
+}
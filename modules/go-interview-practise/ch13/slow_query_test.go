@@ -0,0 +1,66 @@
+package ch13
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedQuery struct {
+	name    string
+	elapsed time.Duration
+}
+
+func TestSlowQueryLogger(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	var mu sync.Mutex
+	var slow []recordedQuery
+	store.SetSlowQueryLogger(QueryLoggerFunc(func(name string, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		slow = append(slow, recordedQuery{name, elapsed})
+	}), 50*time.Millisecond)
+
+	product := &Product{Name: "Slow", Price: 1, Quantity: 10, Category: "Test"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := store.GetProduct(product.ID); err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if len(slow) != 0 {
+		t.Fatalf("Expected no slow queries yet, got %v", slow)
+	}
+
+	// Another connection holds the write lock for a while, so the next
+	// update waits on SQLite's busy timeout before it can run.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`UPDATE products SET price = 2 WHERE id = ?`, product.ID); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tx.Commit()
+	}()
+
+	if err := store.DecrementStock(product.ID, 1); err != nil {
+		t.Fatalf("Failed to decrement stock: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(slow) != 1 || slow[0].name != "DecrementStock" {
+		t.Fatalf("Expected one slow DecrementStock, got %v", slow)
+	}
+	if slow[0].elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the reported duration to exceed the threshold, got %v", slow[0].elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package ch13
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrStoreClosed is returned by operations that need a cached statement once
+// Close has been called.
+var ErrStoreClosed = errors.New("product store is closed")
+
+// stmt returns the prepared statement for query, preparing it on first use.
+// query is the store's ? form; it is rebound for the dialect before preparing.
+func (ps *ProductStore) stmt(query string) (*sql.Stmt, error) {
+	ps.stmtMu.Lock()
+	defer ps.stmtMu.Unlock()
+
+	if ps.closed {
+		return nil, ErrStoreClosed
+	}
+	if s, ok := ps.stmts[query]; ok {
+		return s, nil
+	}
+
+	s, err := ps.db.Prepare(ps.dialect.rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	if ps.stmts == nil {
+		ps.stmts = make(map[string]*sql.Stmt)
+	}
+	ps.stmts[query] = s
+	return s, nil
+}
+
+// Close releases the store's prepared statements. The *sql.DB belongs to the
+// caller and stays open. Calling Close more than once is harmless.
+func (ps *ProductStore) Close() error {
+	ps.stmtMu.Lock()
+	defer ps.stmtMu.Unlock()
+
+	ps.closed = true
+	var errs []error
+	for query, s := range ps.stmts {
+		errs = append(errs, s.Close())
+		delete(ps.stmts, query)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,92 @@
+package ch13
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStoreClose(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer cleanupTestDB()
+
+	store := NewProductStore(db)
+
+	product := &Product{Name: "Cached", Price: 1, Quantity: 1, Category: "Test"}
+	if err := store.CreateProduct(product); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	if _, err := store.GetProduct(product.ID); err != nil {
+		t.Fatalf("Failed to retrieve product: %v", err)
+	}
+	if len(store.stmts) != 2 {
+		t.Fatalf("Expected 2 cached statements, got %d", len(store.stmts))
+	}
+
+	// Hold on to one statement to check Close really closes it.
+	get, err := store.stmt(`SELECT id, name, price, quantity, category FROM products WHERE id = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+	if len(store.stmts) != 0 {
+		t.Errorf("Expected no cached statements after Close, got %d", len(store.stmts))
+	}
+	if err := get.QueryRow(product.ID).Scan(new(int64), new(string), new(float64), new(int), new(string)); err == nil {
+		t.Error("Expected the cached statement to be closed, but it still ran")
+	}
+
+	if _, err := store.GetProduct(product.ID); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Expected ErrStoreClosed from GetProduct, got %v", err)
+	}
+	if err := store.CreateProduct(&Product{Name: "Late"}); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Expected ErrStoreClosed from CreateProduct, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("Expected a second Close to be harmless, got %v", err)
+	}
+
+	// The database belongs to the caller and is still usable.
+	if err := db.Ping(); err != nil {
+		t.Errorf("Expected the database to stay open, got %v", err)
+	}
+}
+
+func BenchmarkGetProduct(b *testing.B) {
+	db, err := InitDB(b.TempDir() + "/bench.db")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewProductStore(db)
+	defer store.Close()
+
+	product := &Product{Name: "Bench", Price: 1, Quantity: 1, Category: "Bench"}
+	if err := store.CreateProduct(product); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := store.GetProduct(product.ID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// What GetProduct did before statements were cached: the driver prepares
+	// and closes the query on every call.
+	b.Run("uncached", func(b *testing.B) {
+		query := `SELECT id, name, price, quantity, category FROM products WHERE id = ?`
+		for b.Loop() {
+			p := &Product{}
+			if err := db.QueryRow(query, product.ID).Scan(&p.ID, &p.Name, &p.Price, &p.Quantity, &p.Category); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
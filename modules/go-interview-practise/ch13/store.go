@@ -0,0 +1,93 @@
+package ch13
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Store is the product CRUD surface, so code that only needs those
+// operations can run against MemStore instead of a database.
+type Store interface {
+	CreateProduct(product *Product) error
+	GetProduct(id int64) (*Product, error)
+	UpdateProduct(product *Product) error
+	DeleteProduct(id int64) error
+	ListProducts(category string) ([]*Product, error)
+}
+
+var (
+	_ Store = (*ProductStore)(nil)
+	_ Store = (*MemStore)(nil)
+)
+
+// MemStore is an in-memory Store for tests. It follows ProductStore: IDs
+// start at 1 and are never reused, CreateProduct always assigns a fresh one,
+// listings come back in ID order, and missing products fail with the same
+// errors.
+type MemStore struct {
+	mu       sync.Mutex
+	products map[int64]Product
+	lastID   int64
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{products: make(map[int64]Product)}
+}
+
+func (m *MemStore) CreateProduct(product *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	product.ID = m.lastID
+	m.products[product.ID] = *product
+	return nil
+}
+
+func (m *MemStore) GetProduct(id int64) (*Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.products[id]
+	if !ok {
+		return nil, fmt.Errorf("product with id %d not found", id)
+	}
+	return &p, nil
+}
+
+func (m *MemStore) UpdateProduct(product *Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[product.ID]; !ok {
+		return fmt.Errorf("update failed: product with id %d not found", product.ID)
+	}
+	m.products[product.ID] = *product
+	return nil
+}
+
+func (m *MemStore) DeleteProduct(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[id]; !ok {
+		return fmt.Errorf("delete failed: product with id %d not found", id)
+	}
+	delete(m.products, id)
+	return nil
+}
+
+func (m *MemStore) ListProducts(category string) ([]*Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	products := []*Product{}
+	for _, id := range slices.Sorted(maps.Keys(m.products)) {
+		if p := m.products[id]; category == "" || p.Category == category {
+			products = append(products, &p)
+		}
+	}
+	return products, nil
+}
@@ -0,0 +1,128 @@
+package ch13
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// storeImpls builds a fresh, empty instance of every Store implementation.
+var storeImpls = []struct {
+	name    string
+	newFunc func(t *testing.T) Store
+}{
+	{
+		name: "SQLite",
+		newFunc: func(t *testing.T) Store {
+			db, err := InitDB(filepath.Join(t.TempDir(), "store.db"))
+			if err != nil {
+				t.Fatalf("Failed to initialize test database: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			store := NewProductStore(db)
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	},
+	{
+		name:    "Mem",
+		newFunc: func(t *testing.T) Store { return NewMemStore() },
+	},
+}
+
+// TestStoreParity runs the same script against every Store, so MemStore can
+// stand in for ProductStore in tests.
+func TestStoreParity(t *testing.T) {
+	for _, impl := range storeImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			store := impl.newFunc(t)
+
+			products := []Product{
+				{Name: "Laptop", Price: 999.5, Quantity: 3, Category: "Electronics"},
+				{Name: "Novel", Price: 12, Quantity: 40, Category: "Books"},
+				{Name: "Phone", Price: 599, Quantity: 7, Category: "Electronics"},
+			}
+			for i := range products {
+				if err := store.CreateProduct(&products[i]); err != nil {
+					t.Fatalf("Failed to create product: %v", err)
+				}
+				if want := int64(i + 1); products[i].ID != want {
+					t.Errorf("Expected ID %d, got %d", want, products[i].ID)
+				}
+			}
+
+			// Creating a product that already carries an ID still adds a new row.
+			dup := products[0]
+			if err := store.CreateProduct(&dup); err != nil {
+				t.Fatalf("Failed to create duplicate: %v", err)
+			}
+			if dup.ID != 4 {
+				t.Errorf("Expected the duplicate to get ID 4, got %d", dup.ID)
+			}
+
+			got, err := store.GetProduct(products[1].ID)
+			if err != nil {
+				t.Fatalf("Failed to retrieve product: %v", err)
+			}
+			if *got != products[1] {
+				t.Errorf("Expected %+v, got %+v", products[1], *got)
+			}
+
+			// The returned product is a copy.
+			got.Name = "Scribbled"
+			if again, _ := store.GetProduct(products[1].ID); again.Name != "Novel" {
+				t.Errorf("Expected the stored product to be unchanged, got %q", again.Name)
+			}
+
+			products[2].Quantity = 0
+			if err := store.UpdateProduct(&products[2]); err != nil {
+				t.Fatalf("Failed to update product: %v", err)
+			}
+			if err := store.DeleteProduct(dup.ID); err != nil {
+				t.Fatalf("Failed to delete product: %v", err)
+			}
+
+			listed, err := store.ListProducts("Electronics")
+			if err != nil {
+				t.Fatalf("Failed to list products: %v", err)
+			}
+			want := []Product{products[0], products[2]}
+			if !slices.EqualFunc(listed, want, func(a *Product, b Product) bool { return *a == b }) {
+				t.Errorf("Expected %+v, got %d products", want, len(listed))
+			}
+			if all, _ := store.ListProducts(""); len(all) != 3 {
+				t.Errorf("Expected 3 products, got %d", len(all))
+			}
+			if none, err := store.ListProducts("NonExistent"); err != nil || none == nil || len(none) != 0 {
+				t.Errorf("Expected an empty slice and no error, got %v, %v", none, err)
+			}
+
+			// A deleted ID is not handed out again.
+			next := Product{Name: "Tablet", Category: "Electronics"}
+			if err := store.CreateProduct(&next); err != nil {
+				t.Fatalf("Failed to create product: %v", err)
+			}
+			if next.ID != 5 {
+				t.Errorf("Expected ID 5 after a delete, got %d", next.ID)
+			}
+
+			missing := int64(1000)
+			notFound := []struct {
+				op   string
+				err  error
+				want string
+			}{
+				{"get", errOf(store.GetProduct(missing)), "product with id 1000 not found"},
+				{"update", store.UpdateProduct(&Product{ID: missing}), "update failed: product with id 1000 not found"},
+				{"delete", store.DeleteProduct(missing), "delete failed: product with id 1000 not found"},
+			}
+			for _, nf := range notFound {
+				if nf.err == nil || nf.err.Error() != nf.want {
+					t.Errorf("%s: expected error %q, got %v", nf.op, nf.want, nf.err)
+				}
+			}
+		})
+	}
+}
+
+func errOf(_ *Product, err error) error { return err }
@@ -2,8 +2,12 @@ package ch16
 
 import (
 	"bytes"
+	"cmp"
+	"io"
+	"math/big"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // SlowSort sorts a slice of integers using a very inefficient algorithm (bubble sort)
@@ -28,11 +32,11 @@ func SlowSort(data []int) []int {
 // partition partially sorts the array.
 // items smaller than pivot are moved to left side of pivot.
 // items greater than pivot are moved to riht side of pivot.
-func partition(data []int, i, j int) int {
+func partition[T any](data []T, i, j int, less func(a, b T) bool) int {
 	pivot := data[i]
 	x := i
 	for p := i + 1; p <= j; p++ {
-		if data[p] < pivot {
+		if less(data[p], pivot) {
 			x++
 			data[p], data[x] = data[x], data[p]
 		}
@@ -42,9 +46,9 @@ func partition(data []int, i, j int) int {
 	return x
 }
 
-// quickSort sorts a slice of integer partition smaller items on left side and
+// quickSort sorts a slice partition smaller items on left side and
 // bigger items on right side of pivot element selected in each iteration till slice is sorted.
-func quickSort(data []int, start, end int) {
+func quickSort[T any](data []T, start, end int, less func(a, b T) bool) {
 	if start >= end {
 		return
 	}
@@ -63,7 +67,7 @@ func quickSort(data []int, start, end int) {
 		i := stack[top]
 		top--
 
-		pivot := partition(data, i, j)
+		pivot := partition(data, i, j, less)
 
 		// If element are present on left side of pivot
 		if pivot-1 > i {
@@ -83,13 +87,25 @@ func quickSort(data []int, start, end int) {
 	}
 }
 
+// Sort returns a sorted copy of data using the non-recursive quicksort.
+// Floats are ordered as cmp.Less does, so NaNs sort first.
+func Sort[T cmp.Ordered](data []T) []T {
+	return SortFunc(data, cmp.Less[T])
+}
+
+// SortFunc returns a copy of data sorted by less using the non-recursive quicksort.
+// The sort is not stable: elements that compare equal may be reordered.
+func SortFunc[T any](data []T, less func(a, b T) bool) []T {
+	result := make([]T, len(data))
+	copy(result, data)
+	quickSort(result, 0, len(result)-1, less)
+	return result
+}
+
 // OptimizedSort is your optimized version of SlowSort
 // It should produce identical results but perform better
 func OptimizedSort(data []int) []int {
-	result := make([]int, len(data))
-	copy(result, data)
-	quickSort(result, 0, len(data)-1)
-	return result
+	return Sort(data)
 }
 
 // InefficientStringBuilder builds a string by repeatedly concatenating
@@ -121,6 +137,27 @@ func OptimizedStringBuilder(parts []string, repeatCount int) string {
 	return result.String()
 }
 
+// WriteRepeated is the streaming version of OptimizedStringBuilder: it writes
+// the joined parts repeatCount times straight to w, so the output never has to
+// fit in memory. It returns the number of bytes written and the first write error.
+func WriteRepeated(w io.Writer, parts []string, repeatCount int) (int64, error) {
+	temp := []byte(strings.Join(parts, ""))
+	if len(temp) == 0 {
+		return 0, nil
+	}
+
+	var written int64
+	for range repeatCount {
+		n, err := w.Write(temp)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
 // ExpensiveCalculation performs a computation with redundant work
 // It computes the sum of all fibonacci numbers up to n
 // TODO: Optimize this function to be more efficient
@@ -145,14 +182,16 @@ func fibonacci(n int) int {
 	return fibonacci(n-1) + fibonacci(n-2)
 }
 
-// myFib computes the fibbonaci num at n
+// Fib computes the fibonacci number at position n iteratively in O(n).
 //
-// myFib(1) = 1
+// Fib(1) = 1
 //
-// myFib(0) = 0
-func myFib(n int) int {
-	if n <= 1 {
-		return n
+// Fib(n) = 0 for n <= 0
+//
+// The result overflows int past n = 92; use FibBig for larger n.
+func Fib(n int) int {
+	if n <= 0 {
+		return 0
 	}
 	a := 1
 	b := 0
@@ -166,21 +205,34 @@ func myFib(n int) int {
 	return result
 }
 
-// OptimizedCalculation is your optimized version of ExpensiveCalculation
-// It should produce identical results but perform better
-func OptimizedCalculation(n int) int {
-
+// FibBig is the overflow-safe version of Fib for large n.
+func FibBig(n int) *big.Int {
 	if n <= 0 {
-		return 0
+		return big.NewInt(0)
 	}
+	a := big.NewInt(1)
+	b := big.NewInt(0)
 
-	sum := 0
-	for i := 1; i <= n; i++ {
-		sum += myFib(i)
+	for i := 2; i <= n; i++ {
+		b.Add(b, a)
+		a, b = b, a
 	}
+	return a
+}
 
-	return sum
+// SumFib returns Fib(1) + ... + Fib(n), or 0 for n <= 0.
+// It uses the identity sum(Fib(1..n)) = Fib(n+2) - 1, so it overflows int past n = 90.
+func SumFib(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return Fib(n+2) - 1
+}
 
+// OptimizedCalculation is your optimized version of ExpensiveCalculation
+// It should produce identical results but perform better
+func OptimizedCalculation(n int) int {
+	return SumFib(n)
 }
 
 // HighAllocationSearch searches for all occurrences of a substring and creates a map with their positions
@@ -211,6 +263,11 @@ func HighAllocationSearch(text, substr string) map[int]string {
 
 // OptimizedSearch is your optimized version of HighAllocationSearch
 // It should produce identical results but perform better with fewer allocations
+//
+// The haystack is never lowercased: each window of the original text is
+// compared with strings.EqualFold, and windows whose first byte cannot match
+// are rejected with a cheap ASCII check first. The only allocations left are
+// the result map itself. An empty substr yields no matches.
 func OptimizedSearch(text, substr string) map[int]string {
 	result := make(map[int]string)
 
@@ -218,21 +275,18 @@ func OptimizedSearch(text, substr string) map[int]string {
 		return result
 	}
 
-	// We lowercase the needle once, as it's usually small.
-	// We only lowercase the portion of the haystack we are checking
-	// to avoid massive heap allocations for large 'text' inputs.
-	lowerText := strings.ToLower(text)
-	lowerSubstr := strings.ToLower(substr)
 	substrLen := len(substr)
 	limit := len(text) - substrLen
+	first := substr[0]
 
 	for i := 0; i <= limit; i++ {
-		// Use EqualFold for a highly optimized, allocation-free
-		// case-insensitive comparison of the current segment.
-		if strings.EqualFold(lowerText[i:i+substrLen], lowerSubstr) {
+		// Non-ASCII bytes can fold to ASCII (e.g. the Kelvin sign to 'k'),
+		// so only take the shortcut when both bytes are plain ASCII.
+		if c := text[i]; c < utf8.RuneSelf && first < utf8.RuneSelf && lowerASCII(c) != lowerASCII(first) {
+			continue
+		}
+		if strings.EqualFold(text[i:i+substrLen], substr) {
 			result[i] = text[i : i+substrLen]
-			// Optional: Skip ahead to avoid overlapping matches
-			// i += substrLen - 1
 		}
 	}
 
@@ -240,6 +294,13 @@ func OptimizedSearch(text, substr string) map[int]string {
 
 }
 
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
 // A function to simulate CPU-intensive work for benchmarking
 // You don't need to optimize this; it's just used for testing
 func SimulateCPUWork(duration time.Duration) {
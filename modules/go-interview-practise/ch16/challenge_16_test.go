@@ -1,7 +1,10 @@
 package ch16
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"reflect"
 	"sort"
@@ -88,6 +91,75 @@ func TestOptimizedSort(t *testing.T) {
 	}
 }
 
+func TestSortGeneric(t *testing.T) {
+	t.Run("Strings", func(t *testing.T) {
+		input := []string{"pear", "apple", "fig", "banana", "apple"}
+		expected := []string{"apple", "apple", "banana", "fig", "pear"}
+		if got := Sort(input); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Sort(%v) = %v, expected %v", input, got, expected)
+		}
+		if input[0] != "pear" {
+			t.Errorf("Sort modified its input: %v", input)
+		}
+	})
+
+	t.Run("Floats", func(t *testing.T) {
+		input := []float64{3.5, -1.25, 0, 2, -7.5}
+		expected := []float64{-7.5, -1.25, 0, 2, 3.5}
+		if got := Sort(input); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Sort(%v) = %v, expected %v", input, got, expected)
+		}
+	})
+
+	t.Run("Empty and single element", func(t *testing.T) {
+		if got := Sort([]string{}); len(got) != 0 {
+			t.Errorf("Sort of empty slice = %v", got)
+		}
+		if got := Sort([]float64{1.5}); !reflect.DeepEqual(got, []float64{1.5}) {
+			t.Errorf("Sort of single element = %v", got)
+		}
+		if got := SortFunc([]int(nil), func(a, b int) bool { return a < b }); len(got) != 0 {
+			t.Errorf("SortFunc of nil slice = %v", got)
+		}
+	})
+}
+
+func TestSortFunc(t *testing.T) {
+	type person struct {
+		Name string
+		Age  int
+	}
+	input := []person{
+		{"carol", 35}, {"alice", 30}, {"dave", 30}, {"bob", 25}, {"erin", 35},
+	}
+
+	got := SortFunc(input, func(a, b person) bool { return a.Age < b.Age })
+
+	// SortFunc is not stable, so only the keys are guaranteed to be ordered;
+	// people with equal ages may come out in either order.
+	for i := 1; i < len(got); i++ {
+		if got[i-1].Age > got[i].Age {
+			t.Fatalf("SortFunc result not ordered by age: %v", got)
+		}
+	}
+	byName := func(a, b person) bool { return a.Name < b.Name }
+	if !reflect.DeepEqual(SortFunc(got, byName), SortFunc(input, byName)) {
+		t.Errorf("SortFunc lost or duplicated elements: %v", got)
+	}
+
+	// A tie-breaking less makes the order fully deterministic.
+	got = SortFunc(input, func(a, b person) bool {
+		if a.Age != b.Age {
+			return a.Age < b.Age
+		}
+		return a.Name < b.Name
+	})
+	expected := []person{{"bob", 25}, {"alice", 30}, {"dave", 30}, {"carol", 35}, {"erin", 35}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("SortFunc with tie-breaker = %v, expected %v", got, expected)
+	}
+}
+
 func BenchmarkSlowSort(b *testing.B) {
 	sizes := []int{10, 100, 1000}
 
@@ -168,6 +240,79 @@ func TestOptimizedStringBuilder(t *testing.T) {
 	}
 }
 
+// countingWriter discards its input but records how many bytes it saw.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// failingWriter accepts limit bytes and then fails.
+type failingWriter struct {
+	limit int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n := f.limit
+		f.limit = 0
+		return n, errors.New("writer full")
+	}
+	f.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteRepeated(t *testing.T) {
+	testCases := []struct {
+		name        string
+		parts       []string
+		repeatCount int
+	}{
+		{"Empty", []string{}, 10},
+		{"Zero Repeats", []string{"Hello"}, 0},
+		{"Single Part", []string{"Hello"}, 5},
+		{"Multiple Parts", []string{"Hello", " ", "World", "!"}, 3},
+		{"Large", []string{"abc", "def"}, 10000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := OptimizedStringBuilder(tc.parts, tc.repeatCount)
+
+			var buf bytes.Buffer
+			n, err := WriteRepeated(&buf, tc.parts, tc.repeatCount)
+			if err != nil {
+				t.Fatalf("WriteRepeated returned error: %v", err)
+			}
+			if n != int64(len(expected)) || buf.String() != expected {
+				t.Errorf("WriteRepeated wrote %d bytes %q, expected %d bytes %q", n, buf.String(), len(expected), expected)
+			}
+
+			var counter countingWriter
+			n, err = WriteRepeated(&counter, tc.parts, tc.repeatCount)
+			if err != nil {
+				t.Fatalf("WriteRepeated returned error: %v", err)
+			}
+			if n != int64(len(expected)) || counter.n != n {
+				t.Errorf("WriteRepeated reported %d bytes, writer saw %d, expected %d", n, counter.n, len(expected))
+			}
+		})
+	}
+
+	t.Run("Write Error", func(t *testing.T) {
+		n, err := WriteRepeated(&failingWriter{limit: 7}, []string{"abc"}, 5)
+		if err == nil {
+			t.Fatal("expected an error from the failing writer")
+		}
+		if n != 7 {
+			t.Errorf("expected 7 bytes written before the error, got %d", n)
+		}
+	})
+}
+
 func BenchmarkInefficientStringBuilder(b *testing.B) {
 	testCases := []struct {
 		name        string
@@ -208,6 +353,26 @@ func BenchmarkOptimizedStringBuilder(b *testing.B) {
 	}
 }
 
+func BenchmarkWriteRepeated(b *testing.B) {
+	testCases := []struct {
+		name        string
+		parts       []string
+		repeatCount int
+	}{
+		{"Small", []string{"Hello", " ", "World"}, 10},
+		{"Medium", []string{"This", " ", "is", " ", "a", " ", "test"}, 100},
+		{"Large", []string{"The", " ", "quick", " ", "brown", " ", "fox"}, 1000},
+	}
+
+	for _, tc := range testCases {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				WriteRepeated(io.Discard, tc.parts, tc.repeatCount)
+			}
+		})
+	}
+}
+
 func TestExpensiveCalculation(t *testing.T) {
 	testCases := []struct {
 		n        int
@@ -248,6 +413,52 @@ func TestOptimizedCalculation(t *testing.T) {
 	}
 }
 
+func TestFib(t *testing.T) {
+	for n := -2; n <= 30; n++ {
+		expected := 0
+		if n > 0 {
+			expected = fibonacci(n)
+		}
+		if got := Fib(n); got != expected {
+			t.Errorf("Fib(%d) = %d, expected %d", n, got, expected)
+		}
+	}
+}
+
+func TestSumFib(t *testing.T) {
+	for n := -1; n <= 25; n++ {
+		if got, expected := SumFib(n), ExpensiveCalculation(n); got != expected {
+			t.Errorf("SumFib(%d) = %d, expected %d", n, got, expected)
+		}
+	}
+}
+
+func TestFibBig(t *testing.T) {
+	testCases := []struct {
+		n        int
+		expected string
+	}{
+		{0, "0"},
+		{1, "1"},
+		{92, "7540113804746346429"},
+		{93, "12200160415121876738"}, // first value past int64
+		{100, "354224848179261915075"},
+		{200, "280571172992510140037611932413038677189525"},
+	}
+
+	for _, tc := range testCases {
+		if got := FibBig(tc.n).String(); got != tc.expected {
+			t.Errorf("FibBig(%d) = %s, expected %s", tc.n, got, tc.expected)
+		}
+	}
+
+	for n := 0; n <= 92; n++ {
+		if got := FibBig(n); !got.IsInt64() || got.Int64() != int64(Fib(n)) {
+			t.Errorf("FibBig(%d) = %s, expected %d", n, got, Fib(n))
+		}
+	}
+}
+
 func BenchmarkExpensiveCalculation(b *testing.B) {
 	benchmarks := []struct {
 		name string
@@ -321,6 +532,11 @@ func TestOptimizedSearch(t *testing.T) {
 		{"Multiple Matches", "banana", "an"},
 		{"Case Insensitive", "Hello World Hello", "hello"},
 		{"Long Text", strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100), "fox"},
+		{"Mixed Case Needle", "FoX fox FOX fOx", "fOX"},
+		{"Overlapping", "aAaAa", "aa"},
+		{"Needle Longer Than Text", "abc", "abcd"},
+		{"Match At End", "xyzHELLO", "hello"},
+		{"Punctuation", "a-b a-B A-b", "A-B"},
 	}
 
 	for _, tc := range testCases {
@@ -335,6 +551,29 @@ func TestOptimizedSearch(t *testing.T) {
 	}
 }
 
+func TestOptimizedSearchRandomASCII(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const alphabet = "aAbB -"
+
+	randomString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	for range 500 {
+		text := randomString(r.Intn(60))
+		substr := randomString(1 + r.Intn(3))
+
+		expected := HighAllocationSearch(text, substr)
+		if got := OptimizedSearch(text, substr); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("OptimizedSearch(%q, %q) = %v, expected %v", text, substr, got, expected)
+		}
+	}
+}
+
 func BenchmarkHighAllocationSearch(b *testing.B) {
 	benchmarks := []struct {
 		name   string
@@ -398,3 +637,24 @@ func BenchmarkMemoryOptimizedSearch(b *testing.B) {
 		OptimizedSearch(text, substr)
 	}
 }
+
+// BenchmarkMemorySearchMegabyte compares allocations on a ~1MB haystack with
+// rare matches, where lowercasing the whole text dominates the cost.
+func BenchmarkMemorySearchMegabyte(b *testing.B) {
+	text := strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 18000) + "The Quick Brown FOX"
+	substr := "fox"
+
+	b.Run("HighAllocation", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			HighAllocationSearch(text, substr)
+		}
+	})
+
+	b.Run("Optimized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			OptimizedSearch(text, substr)
+		}
+	})
+}
@@ -1,10 +1,31 @@
 package ch19
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"math"
 )
 
+// Integer is satisfied by every built-in signed and unsigned integer type.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Float is satisfied by the built-in floating-point types.
+type Float interface {
+	~float32 | ~float64
+}
+
+// Number is satisfied by every built-in integer and floating-point type.
+type Number interface {
+	Integer | Float
+}
+
+// ErrOverflow is returned by SafeSum when the total does not fit in T.
+var ErrOverflow = errors.New("integer overflow")
+
 func main() {
 	// Example slice for testing
 	numbers := []int{3, 1, 4, 1, 5, 9, 2, 6}
@@ -40,15 +61,102 @@ func FindMax(numbers []int) int {
 	return maxElement
 }
 
+// Max returns the largest element of s. ok is false for an empty slice, so a
+// genuine zero maximum can be told apart from "no elements".
+func Max[T cmp.Ordered](s []T) (T, bool) {
+	var zero T
+	if len(s) == 0 {
+		return zero, false
+	}
+	maxElement := s[0]
+	for _, x := range s[1:] {
+		maxElement = max(maxElement, x)
+	}
+	return maxElement, true
+}
+
+// Min returns the smallest element of s, with ok false for an empty slice.
+func Min[T cmp.Ordered](s []T) (T, bool) {
+	var zero T
+	if len(s) == 0 {
+		return zero, false
+	}
+	minElement := s[0]
+	for _, x := range s[1:] {
+		minElement = min(minElement, x)
+	}
+	return minElement, true
+}
+
+// Sum returns the sum of s, or 0 for an empty slice.
+// Integer sums wrap silently on overflow; use SafeSum to detect it.
+func Sum[T Number](s []T) T {
+	var total T
+	for _, x := range s {
+		total += x
+	}
+	return total
+}
+
+// SafeSum returns the sum of s, or ErrOverflow as soon as a partial sum wraps.
+// Adding a positive value must move the total up and adding a negative one
+// must move it down; a sign flip the other way means T ran out of bits. The
+// same check covers unsigned types, where only the upward case can happen.
+func SafeSum[T Integer](s []T) (T, error) {
+	var total T
+	for _, x := range s {
+		next := total + x
+		if (x > 0 && next < total) || (x < 0 && next > total) {
+			return 0, ErrOverflow
+		}
+		total = next
+	}
+	return total, nil
+}
+
+// KahanSum returns the sum of s using compensated summation, carrying the
+// low-order bits lost by each addition in a separate term. This is Neumaier's
+// variant, which also stays exact when an addend is larger than the running
+// total (e.g. 1, 1e100, 1, -1e100 sums to 2, where a naive loop gives 0).
+func KahanSum[T Float](s []T) T {
+	var total, compensation T
+	for _, x := range s {
+		next := total + x
+		if math.Abs(float64(total)) >= math.Abs(float64(x)) {
+			compensation += (total - next) + x
+		} else {
+			compensation += (x - next) + total
+		}
+		total = next
+	}
+	return total + compensation
+}
+
+// Average returns the arithmetic mean of s as a float64, with ok false for an
+// empty slice.
+func Average[T Number](s []T) (float64, bool) {
+	if len(s) == 0 {
+		return 0, false
+	}
+	var total float64
+	for _, x := range s {
+		total += float64(x)
+	}
+	return total / float64(len(s)), true
+}
+
 // RemoveDuplicates returns a new slice with duplicate values removed,
 // preserving the original order of elements.
 func RemoveDuplicates(numbers []int) []int {
-	if len(numbers) == 0 {
-		return numbers
-	}
-	marked := make(map[int]struct{})
-	var result []int
-	for _, x := range numbers {
+	return Unique(numbers)
+}
+
+// Unique returns a new slice holding the first occurrence of each element of
+// s, in their original order. s is never modified.
+func Unique[T comparable](s []T) []T {
+	marked := make(map[T]struct{}, len(s))
+	result := make([]T, 0, len(s))
+	for _, x := range s {
 		if _, ok := marked[x]; !ok {
 			marked[x] = struct{}{}
 			result = append(result, x)
@@ -57,27 +165,91 @@ func RemoveDuplicates(numbers []int) []int {
 	return result
 }
 
-// ReverseSlice returns a new slice with elements in reverse order.
-func ReverseSlice(slice []int) []int {
-	i := 0
-	j := len(slice) - 1
-	result := make([]int, len(slice))
-	for i <= j {
-		result[i], result[j] = slice[j], slice[i]
-		i++
-		j--
+// Union returns the distinct elements of a followed by the distinct elements
+// of b that are not in a, preserving first-seen order.
+func Union[T comparable](a, b []T) []T {
+	combined := make([]T, 0, len(a)+len(b))
+	combined = append(combined, a...)
+	combined = append(combined, b...)
+	return Unique(combined)
+}
+
+// Intersect returns the distinct elements of a that also appear in b, in the
+// order they appear in a.
+func Intersect[T comparable](a, b []T) []T {
+	inB := toSet(b)
+	result := make([]T, 0)
+	for _, x := range Unique(a) {
+		if _, ok := inB[x]; ok {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// Difference returns the distinct elements of a that do not appear in b, in
+// the order they appear in a.
+func Difference[T comparable](a, b []T) []T {
+	inB := toSet(b)
+	result := make([]T, 0)
+	for _, x := range Unique(a) {
+		if _, ok := inB[x]; !ok {
+			result = append(result, x)
+		}
 	}
 	return result
 }
 
+func toSet[T comparable](s []T) map[T]struct{} {
+	set := make(map[T]struct{}, len(s))
+	for _, x := range s {
+		set[x] = struct{}{}
+	}
+	return set
+}
+
+// ReverseSlice returns a new slice with elements in reverse order.
+func ReverseSlice(slice []int) []int {
+	i := len(slice)
+	return Reduce(slice, make([]int, len(slice)), func(result []int, x int) []int {
+		i--
+		result[i] = x
+		return result
+	})
+}
+
 // FilterEven returns a new slice containing only the even numbers
 // from the original slice.
 func FilterEven(numbers []int) []int {
-	result := []int{}
-	for _, x := range numbers {
-		if x%2 == 0 {
+	return Filter(numbers, func(x int) bool { return x%2 == 0 })
+}
+
+// Map returns a new slice holding f applied to each element of s.
+func Map[T, U any](s []T, f func(T) U) []U {
+	result := make([]U, len(s))
+	for i, x := range s {
+		result[i] = f(x)
+	}
+	return result
+}
+
+// Filter returns a new slice holding the elements of s for which pred is
+// true, in their original order. It never returns nil.
+func Filter[T any](s []T, pred func(T) bool) []T {
+	result := []T{}
+	for _, x := range s {
+		if pred(x) {
 			result = append(result, x)
 		}
 	}
 	return result
 }
+
+// Reduce folds s from left to right, starting from init.
+func Reduce[T, U any](s []T, init U, f func(U, T) U) U {
+	acc := init
+	for _, x := range s {
+		acc = f(acc, x)
+	}
+	return acc
+}
@@ -1,7 +1,10 @@
 package ch19
 
 import (
+	"errors"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -108,3 +111,292 @@ func TestFilterEven(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxMin(t *testing.T) {
+	t.Run("Empty slice", func(t *testing.T) {
+		if got, ok := Max([]int{}); ok {
+			t.Errorf("Max([]) = %v, true; want ok=false", got)
+		}
+		if got, ok := Min([]string(nil)); ok {
+			t.Errorf("Min(nil) = %q, true; want ok=false", got)
+		}
+	})
+
+	t.Run("Negative only", func(t *testing.T) {
+		numbers := []int{-7, -3, -12}
+		if got, ok := Max(numbers); !ok || got != -3 {
+			t.Errorf("Max(%v) = %v, %v; want -3, true", numbers, got, ok)
+		}
+		if got, ok := Min(numbers); !ok || got != -12 {
+			t.Errorf("Min(%v) = %v, %v; want -12, true", numbers, got, ok)
+		}
+		// The int helper cannot distinguish this from an empty slice's 0.
+		if FindMax([]int{}) != 0 {
+			t.Errorf("FindMax([]) should keep returning 0 for compatibility")
+		}
+	})
+
+	t.Run("Floats", func(t *testing.T) {
+		numbers := []float64{2.5, -0.5, 9.75, 3}
+		if got, ok := Max(numbers); !ok || got != 9.75 {
+			t.Errorf("Max(%v) = %v, %v; want 9.75, true", numbers, got, ok)
+		}
+		if got, ok := Min(numbers); !ok || got != -0.5 {
+			t.Errorf("Min(%v) = %v, %v; want -0.5, true", numbers, got, ok)
+		}
+	})
+
+	t.Run("Strings", func(t *testing.T) {
+		words := []string{"pear", "apple", "zucchini", "fig"}
+		if got, ok := Max(words); !ok || got != "zucchini" {
+			t.Errorf("Max(%v) = %q, %v; want zucchini, true", words, got, ok)
+		}
+		if got, ok := Min(words); !ok || got != "apple" {
+			t.Errorf("Min(%v) = %q, %v; want apple, true", words, got, ok)
+		}
+	})
+}
+
+func TestSumAverage(t *testing.T) {
+	t.Run("Empty slice", func(t *testing.T) {
+		if got := Sum([]int{}); got != 0 {
+			t.Errorf("Sum([]) = %v, want 0", got)
+		}
+		if got, ok := Average([]float64{}); ok {
+			t.Errorf("Average([]) = %v, true; want ok=false", got)
+		}
+	})
+
+	t.Run("Negative only", func(t *testing.T) {
+		numbers := []int{-1, -2, -3, -4}
+		if got := Sum(numbers); got != -10 {
+			t.Errorf("Sum(%v) = %v, want -10", numbers, got)
+		}
+		if got, ok := Average(numbers); !ok || got != -2.5 {
+			t.Errorf("Average(%v) = %v, %v; want -2.5, true", numbers, got, ok)
+		}
+	})
+
+	t.Run("Floats", func(t *testing.T) {
+		numbers := []float32{0.5, 1.5, 2}
+		if got := Sum(numbers); got != 4 {
+			t.Errorf("Sum(%v) = %v, want 4", numbers, got)
+		}
+		if got, ok := Average(numbers); !ok || math.Abs(got-4.0/3) > 1e-6 {
+			t.Errorf("Average(%v) = %v, %v; want 1.333..., true", numbers, got, ok)
+		}
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		if got := Sum([]uint8{10, 20, 30}); got != 60 {
+			t.Errorf("Sum = %v, want 60", got)
+		}
+	})
+}
+
+func TestSetOperations(t *testing.T) {
+	t.Run("Strings", func(t *testing.T) {
+		a := []string{"go", "rust", "go", "zig", "c"}
+		b := []string{"c", "python", "go", "python"}
+
+		cases := []struct {
+			name string
+			got  []string
+			want []string
+		}{
+			{"Unique", Unique(a), []string{"go", "rust", "zig", "c"}},
+			{"Union", Union(a, b), []string{"go", "rust", "zig", "c", "python"}},
+			{"Intersect", Intersect(a, b), []string{"go", "c"}},
+			{"Difference", Difference(a, b), []string{"rust", "zig"}},
+		}
+		for _, tc := range cases {
+			if !reflect.DeepEqual(tc.got, tc.want) {
+				t.Errorf("%s = %v, want %v", tc.name, tc.got, tc.want)
+			}
+		}
+	})
+
+	t.Run("Structs", func(t *testing.T) {
+		type point struct{ X, Y int }
+		a := []point{{1, 2}, {3, 4}, {1, 2}}
+		b := []point{{3, 4}, {5, 6}}
+
+		if got, want := Unique(a), []point{{1, 2}, {3, 4}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Unique = %v, want %v", got, want)
+		}
+		if got, want := Union(a, b), []point{{1, 2}, {3, 4}, {5, 6}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Union = %v, want %v", got, want)
+		}
+		if got, want := Intersect(a, b), []point{{3, 4}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Intersect = %v, want %v", got, want)
+		}
+		if got, want := Difference(a, b), []point{{1, 2}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Difference = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Empty inputs", func(t *testing.T) {
+		empty := []int{}
+		some := []int{1, 2}
+
+		if got := Unique(empty); len(got) != 0 {
+			t.Errorf("Unique([]) = %v", got)
+		}
+		if got := Union(empty, some); !reflect.DeepEqual(got, some) {
+			t.Errorf("Union([], %v) = %v", some, got)
+		}
+		if got := Intersect(some, empty); len(got) != 0 {
+			t.Errorf("Intersect(%v, []) = %v", some, got)
+		}
+		if got := Difference(some, nil); !reflect.DeepEqual(got, some) {
+			t.Errorf("Difference(%v, nil) = %v", some, got)
+		}
+		if got := Difference(nil, some); len(got) != 0 {
+			t.Errorf("Difference(nil, %v) = %v", some, got)
+		}
+	})
+
+	t.Run("Inputs are never mutated", func(t *testing.T) {
+		// Spare capacity would let a careless append write into a's backing array.
+		a := make([]int, 3, 10)
+		copy(a, []int{3, 1, 3})
+		b := []int{1, 7}
+		aBefore := append([]int(nil), a[:cap(a)]...)
+		bBefore := append([]int(nil), b...)
+
+		Unique(a)
+		Union(a, b)
+		Intersect(a, b)
+		Difference(a, b)
+
+		if !reflect.DeepEqual(a[:cap(a)], aBefore) {
+			t.Errorf("a was mutated: %v, was %v", a[:cap(a)], aBefore)
+		}
+		if !reflect.DeepEqual(b, bBefore) {
+			t.Errorf("b was mutated: %v, was %v", b, bBefore)
+		}
+	})
+}
+
+func TestMap(t *testing.T) {
+	got := Map([]int{1, 2, 3}, func(x int) string { return strings.Repeat("*", x) })
+	if want := []string{"*", "**", "***"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map = %v, want %v", got, want)
+	}
+
+	if got := Map([]int{}, func(x int) int { return x }); got == nil || len(got) != 0 {
+		t.Errorf("Map of empty slice = %#v, want empty non-nil slice", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	got := Filter([]string{"go", "", "rust", ""}, func(s string) bool { return s != "" })
+	if want := []string{"go", "rust"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter = %v, want %v", got, want)
+	}
+
+	if got := Filter([]int(nil), func(int) bool { return true }); got == nil || len(got) != 0 {
+		t.Errorf("Filter of nil slice = %#v, want empty non-nil slice", got)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	if got := Reduce([]int{1, 2, 3, 4}, 0, func(acc, x int) int { return acc + x }); got != 10 {
+		t.Errorf("Reduce sum = %d, want 10", got)
+	}
+
+	concat := Reduce([]string{"a", "b", "c"}, ">", func(acc, x string) string { return acc + x })
+	if concat != ">abc" {
+		t.Errorf("Reduce should fold left to right, got %q", concat)
+	}
+
+	if got := Reduce([]int{}, 42, func(acc, x int) int { return acc + x }); got != 42 {
+		t.Errorf("Reduce of empty slice = %d, want init 42", got)
+	}
+}
+
+func TestMapFilterReduceChain(t *testing.T) {
+	words := []string{"map", "filter", "reduce", "go", "generics"}
+
+	lengths := Map(words, func(w string) int { return len(w) })
+	long := Filter(lengths, func(n int) bool { return n > 3 })
+	total := Reduce(long, 0, func(acc, n int) int { return acc + n })
+
+	if total != 6+6+8 {
+		t.Errorf("chained total = %d, want %d", total, 6+6+8)
+	}
+}
+
+func TestSafeSum(t *testing.T) {
+	t.Run("int8 overflow", func(t *testing.T) {
+		if _, err := SafeSum([]int8{100, 27, 1}); !errors.Is(err, ErrOverflow) {
+			t.Errorf("err = %v, want ErrOverflow", err)
+		}
+	})
+	t.Run("int8 underflow", func(t *testing.T) {
+		if _, err := SafeSum([]int8{-100, -28, -1}); !errors.Is(err, ErrOverflow) {
+			t.Errorf("err = %v, want ErrOverflow", err)
+		}
+	})
+	t.Run("int8 at the limit", func(t *testing.T) {
+		got, err := SafeSum([]int8{100, 27, -127, -128, 1})
+		if err != nil || got != -127 {
+			t.Errorf("SafeSum = %d, %v; want -127, nil", got, err)
+		}
+	})
+	t.Run("uint8 wrap", func(t *testing.T) {
+		if _, err := SafeSum([]uint8{200, 56}); !errors.Is(err, ErrOverflow) {
+			t.Errorf("err = %v, want ErrOverflow", err)
+		}
+	})
+	t.Run("int64 max", func(t *testing.T) {
+		if _, err := SafeSum([]int64{math.MaxInt64, 1}); !errors.Is(err, ErrOverflow) {
+			t.Errorf("err = %v, want ErrOverflow", err)
+		}
+	})
+	t.Run("matches Sum when it fits", func(t *testing.T) {
+		s := []int{3, -1, 4, -1, 5, -9}
+		got, err := SafeSum(s)
+		if err != nil || got != Sum(s) {
+			t.Errorf("SafeSum = %d, %v; want %d, nil", got, err, Sum(s))
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		got, err := SafeSum([]int16{})
+		if err != nil || got != 0 {
+			t.Errorf("SafeSum = %d, %v; want 0, nil", got, err)
+		}
+	})
+}
+
+func TestKahanSum(t *testing.T) {
+	t.Run("large cancelling terms", func(t *testing.T) {
+		s := []float64{1, 1e100, 1, -1e100}
+		if naive := Sum(s); naive == 2 {
+			t.Fatalf("naive Sum = %v, expected it to lose precision", naive)
+		}
+		if got := KahanSum(s); got != 2 {
+			t.Errorf("KahanSum = %v, want 2", got)
+		}
+	})
+
+	t.Run("many tiny addends", func(t *testing.T) {
+		s := []float64{1}
+		for range 10_000 {
+			s = append(s, 1e-16)
+		}
+		want := 1 + 1e-12
+
+		naiveErr := math.Abs(Sum(s) - want)
+		kahanErr := math.Abs(KahanSum(s) - want)
+		if kahanErr >= naiveErr {
+			t.Errorf("KahanSum error %g is not below naive error %g", kahanErr, naiveErr)
+		}
+	})
+
+	t.Run("float32", func(t *testing.T) {
+		if got := KahanSum([]float32{0.5, 0.25, 0.25}); got != 1 {
+			t.Errorf("KahanSum = %v, want 1", got)
+		}
+	})
+}
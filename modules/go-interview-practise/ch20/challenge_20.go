@@ -53,6 +53,7 @@ type Config struct {
 	OperationTimeout time.Duration                           // Time to wait before half-open
 	ReadyToTrip      func(Metrics) bool                      // Function to determine when to trip
 	OnStateChange    func(name string, from State, to State) // State change callback
+	Clock            Clock                                   // Time source for Interval and Timeout; nil means the wall clock
 }
 
 // CircuitBreaker interface defines the operations for a circuit breaker
@@ -98,6 +99,9 @@ func NewCircuitBreaker(config Config) CircuitBreaker {
 	if config.Timeout == 0 {
 		config.Timeout = 30 * time.Second
 	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
 	if config.ReadyToTrip == nil {
 		config.ReadyToTrip = func(m Metrics) bool {
 			if m.Requests < 20 {
@@ -107,12 +111,13 @@ func NewCircuitBreaker(config Config) CircuitBreaker {
 		}
 	}
 
+	now := config.Clock.Now()
 	return &circuitBreakerImpl{
 		name:            "circuit-breaker",
 		config:          config,
 		state:           StateClosed,
-		lastStateChange: time.Now(),
-		windowStart:     time.Now(),
+		lastStateChange: now,
+		windowStart:     now,
 	}
 }
 
@@ -194,7 +199,7 @@ func (cb *circuitBreakerImpl) setState(newState State) func() {
 	if cb.state != newState {
 		oldState := cb.state
 		cb.state = newState
-		cb.lastStateChange = time.Now()
+		cb.lastStateChange = cb.config.Clock.Now()
 
 		if newState == StateClosed {
 			cb.resetMetrics()
@@ -219,7 +224,7 @@ func (cb *circuitBreakerImpl) resetMetrics() {
 	cb.metrics = Metrics{}
 	cb.halfOpenRequests = 0
 	cb.halfOpenSuccess = 0
-	cb.windowStart = time.Now()
+	cb.windowStart = cb.config.Clock.Now()
 }
 
 // canExecute determines if a request can be executed in the current state
@@ -259,7 +264,7 @@ func (cb *circuitBreakerImpl) canExecute() (stateChangeNotifier, error) {
 }
 
 func (cb *circuitBreakerImpl) checkWindow() {
-	if cb.state == StateClosed && time.Since(cb.windowStart) > cb.config.Interval {
+	if cb.state == StateClosed && cb.config.Clock.Now().Sub(cb.windowStart) > cb.config.Interval {
 		cb.resetMetrics()
 	}
 }
@@ -308,7 +313,7 @@ func (cb *circuitBreakerImpl) recordFailure() stateChangeNotifier {
 	cb.metrics.Requests++
 	cb.metrics.Failures++
 	cb.metrics.ConsecutiveFailures++
-	cb.metrics.LastFailureTime = time.Now()
+	cb.metrics.LastFailureTime = cb.config.Clock.Now()
 
 	if cb.state == StateHalfOpen {
 		cb.halfOpenSuccess = 0
@@ -331,7 +336,7 @@ func (cb *circuitBreakerImpl) shouldTrip() bool {
 
 // isReady checks if the circuit breaker is ready to transition from open to half-open
 func (cb *circuitBreakerImpl) isReady() bool {
-	return time.Since(cb.lastStateChange) > cb.config.Timeout
+	return cb.config.Clock.Now().Sub(cb.lastStateChange) > cb.config.Timeout
 }
 
 // Example usage and testing helper functions
@@ -0,0 +1,84 @@
+package ch20
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFakeClockOpenToHalfOpen(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var transitions []State
+	cb := NewCircuitBreaker(Config{
+		Timeout:     time.Minute,
+		ReadyToTrip: func(m Metrics) bool { return m.ConsecutiveFailures >= 2 },
+		OnStateChange: func(name string, from, to State) {
+			transitions = append(transitions, to)
+		},
+		Clock: clock,
+	})
+	ctx := context.Background()
+	op := &mockOperation{shouldFail: true}
+
+	for i := 0; i < 2; i++ {
+		cb.Call(ctx, op.execute)
+	}
+	if cb.GetState() != StateOpen {
+		t.Fatalf("Expected state to be Open, got %v", cb.GetState())
+	}
+	if got := cb.GetMetrics().LastFailureTime; !got.Equal(clock.Now()) {
+		t.Errorf("Expected LastFailureTime %v from the fake clock, got %v", clock.Now(), got)
+	}
+
+	// Exactly Timeout is not enough; the breaker waits for longer than it.
+	clock.Advance(time.Minute)
+	if _, err := cb.Call(ctx, op.execute); !errors.Is(err, ErrCircuitBreakerOpen) {
+		t.Fatalf("Expected ErrCircuitBreakerOpen at exactly Timeout, got %v", err)
+	}
+
+	clock.Advance(time.Nanosecond)
+	op.shouldFail = false
+	if _, err := cb.Call(ctx, op.execute); err != nil {
+		t.Fatalf("Expected the half-open probe to succeed, got %v", err)
+	}
+	if cb.GetState() != StateClosed {
+		t.Errorf("Expected state to be Closed after the probe, got %v", cb.GetState())
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateClosed}
+	if len(transitions) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("Expected transitions %v, got %v", want, transitions)
+			break
+		}
+	}
+}
+
+func TestFakeClockIntervalResetsWindow(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cb := NewCircuitBreaker(Config{
+		Interval:    10 * time.Second,
+		ReadyToTrip: func(m Metrics) bool { return m.Failures >= 3 },
+		Clock:       clock,
+	})
+	ctx := context.Background()
+	op := &mockOperation{shouldFail: true}
+
+	cb.Call(ctx, op.execute)
+	cb.Call(ctx, op.execute)
+
+	// The window rolls over before the third failure, so it counts alone.
+	clock.Advance(11 * time.Second)
+	cb.Call(ctx, op.execute)
+
+	if cb.GetState() != StateClosed {
+		t.Errorf("Expected state to stay Closed across windows, got %v", cb.GetState())
+	}
+	if m := cb.GetMetrics(); m.Failures != 1 {
+		t.Errorf("Expected 1 failure in the new window, got %d", m.Failures)
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 /*
-#cgo LDFLAGS: -lm -L/Users/manik/Documents/workspace/go/projects/learn_go/modules/learn-cgo -lcommon
+#cgo LDFLAGS: -lm -L${SRCDIR} -Wl,-rpath,${SRCDIR} -lcommon
 #include <math.h>
 #include <stdlib.h>
 #include "hello.h"
@@ -9,10 +9,50 @@ package main
 import "C"
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"unsafe"
 )
 
+var ErrDivideByZero = errors.New("divide by zero")
+
+// SafeDivide calls the C safe_divide and turns its status code into a Go
+// error. out is a Go variable; passing its address is fine because C only
+// writes a double through it and does not keep the pointer.
+func SafeDivide(a, b float64) (float64, error) {
+	var out C.double
+	switch rc := C.safe_divide(C.double(a), C.double(b), &out); rc {
+	case C.SAFE_DIVIDE_OK:
+		return float64(out), nil
+	case C.SAFE_DIVIDE_BY_ZERO:
+		return 0, ErrDivideByZero
+	default:
+		return 0, fmt.Errorf("safe_divide failed with status %d", int(rc))
+	}
+}
+
+// UpperASCII uppercases the ASCII letters of b using the C upper_ascii and
+// returns a new slice; b itself is never modified.
+//
+// Memory ownership:
+//   - C.CBytes copies b into C.malloc'd memory. That buffer belongs to Go code
+//     here, so it is freed with C.free before returning.
+//   - C may write through the pointer only for the length of the call.
+//   - C.GoBytes copies the result back into Go memory before the free, so
+//     nothing returned to the caller points into the C heap.
+func UpperASCII(b []byte) []byte {
+	if len(b) == 0 {
+		return []byte{}
+	}
+
+	cbuf := C.CBytes(b)
+	defer C.free(cbuf)
+
+	C.upper_ascii((*C.uchar)(cbuf), C.size_t(len(b)))
+	return C.GoBytes(cbuf, C.int(len(b)))
+}
+
 func main() {
 	log.Println("--- learn_cgo ---")
 
@@ -34,4 +74,17 @@ func main() {
 	defer C.free(unsafe.Pointer(cName))
 
 	C.greet_user(cName)
+
+	// 5. Status codes: C reports failure through its return value
+	for _, b := range []float64{2, 0} {
+		q, err := SafeDivide(10, b)
+		if err != nil {
+			log.Printf("SafeDivide(10, %v): %v\n", b, err)
+			continue
+		}
+		log.Printf("SafeDivide(10, %v) = %v\n", b, q)
+	}
+
+	// 6. Buffers: copy a []byte into C, transform it, copy it back
+	log.Printf("UpperASCII(%q) = %q\n", "hello, cgo!", UpperASCII([]byte("hello, cgo!")))
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSafeDivide(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    float64
+		want    float64
+		wantErr error
+	}{
+		{"divides", 10, 4, 2.5, nil},
+		{"negative", -9, 3, -3, nil},
+		{"divide by zero", 1, 0, 0, ErrDivideByZero},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SafeDivide(tt.a, tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SafeDivide(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpperASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"lowercase", "hello", "HELLO"},
+		{"mixed", "Hello, World 42!", "HELLO, WORLD 42!"},
+		{"non-ascii untouched", "héllo\x00z", "HéLLO\x00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := []byte(tt.in)
+			got := UpperASCII(in)
+			if string(got) != tt.want {
+				t.Errorf("UpperASCII(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if string(in) != tt.in {
+				t.Errorf("input was modified to %q", in)
+			}
+		})
+	}
+}
+
+// TestUpperASCIIRepeated hammers the wrapper from several goroutines. Run it
+// with -race (and -asan where available): a missing C.free or a Go pointer
+// kept by C shows up there rather than as a test failure.
+func TestUpperASCIIRepeated(t *testing.T) {
+	in := bytes.Repeat([]byte("abc"), 1024)
+	want := bytes.ToUpper(in)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 2000 {
+				if got := UpperASCII(in); !bytes.Equal(got, want) {
+					t.Error("UpperASCII returned the wrong bytes")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -1,7 +1,27 @@
+#include "hello.h"
 #include <stdio.h>
 
 void hello_from_c() { printf("Hello from C\n"); }
 
 void greet_user(const char *name) {
   printf("Hello, %s! (Greetings from C processing a Go string)\n", name);
-}
\ No newline at end of file
+}
+
+int safe_divide(double a, double b, double *out) {
+  if (out == NULL) {
+    return SAFE_DIVIDE_NULL_OUT;
+  }
+  if (b == 0) {
+    return SAFE_DIVIDE_BY_ZERO;
+  }
+  *out = a / b;
+  return SAFE_DIVIDE_OK;
+}
+
+void upper_ascii(unsigned char *buf, size_t len) {
+  for (size_t i = 0; i < len; i++) {
+    if (buf[i] >= 'a' && buf[i] <= 'z') {
+      buf[i] -= 'a' - 'A';
+    }
+  }
+}
@@ -64,6 +64,8 @@ writes an object-file index. ar rcs libcommonlib.a cpp_part.o c_part.o
 
 
 */
+#include <stddef.h>
+
 #ifdef __cplusplus
 extern "C" {
 #endif // __cplusplus
@@ -71,6 +73,23 @@ extern "C" {
 void hello_from_cpp();
 void greet_user(const char *name);
 
+/*
+Status-code style error handling: the return value says whether the call
+worked and the real result goes through an out-parameter owned by the caller.
+Returns SAFE_DIVIDE_OK and writes a / b to *out, or a nonzero code and leaves
+*out untouched.
+*/
+#define SAFE_DIVIDE_OK 0
+#define SAFE_DIVIDE_BY_ZERO 1
+#define SAFE_DIVIDE_NULL_OUT 2
+int safe_divide(double a, double b, double *out);
+
+/*
+Uppercases the ASCII letters of buf[0..len) in place. The caller owns buf;
+the function neither keeps nor frees it, and bytes outside a-z are untouched.
+*/
+void upper_ascii(unsigned char *buf, size_t len);
+
 #ifdef __cplusplus
 }
 #endif // __cplusplus
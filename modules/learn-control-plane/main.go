@@ -41,6 +41,8 @@ func main() {
 	}()
 
 	<-ctx.Done()
+	// ctx is also what DrainMiddleware watches, so from here new requests get 503
+	// while Shutdown waits for the in-flight ones.
 	log.Println("Shutting down gracefully...")
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,26 @@
+package v1
+
+import "time"
+
+// Clock is where the lease and reconcile logic read the time from, so tests
+// can expire a lease by moving a fake clock instead of sleeping through
+// the lease duration. The reconcile timer itself still runs on real time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// getClock is the Provisioner's clock, or the wall clock when none was set.
+func (p *Provisioner) getClock() Clock {
+	if p.clock == nil {
+		return realClock{}
+	}
+	return p.clock
+}
+
+func (p *Provisioner) now() time.Time {
+	return p.getClock().Now()
+}
@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// WATCH_BUFFER is how many events a watcher may fall behind before new
+	// ones are dropped for it; a slow client must never stall provisioning.
+	WATCH_BUFFER = 64
+
+	// DELETED is the state reported when scale-down removes a resource. It
+	// is never stored in the ledger.
+	DELETED = "DELETED"
+)
+
+// String names the state the way the API and events report it.
+func (s ProvisioningState) String() string {
+	switch s {
+	case PROVISIONING:
+		return "PROVISIONING"
+	case PROVISIONED:
+		return "PROVISIONED"
+	case FAILED:
+		return "FAILED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ResourceEvent is one ledger state change, as streamed by GET /v1/watch.
+type ResourceEvent struct {
+	ID    string    `json:"id"`
+	State string    `json:"state"`
+	At    time.Time `json:"at"`
+}
+
+// EventHub fans resource events out to watchers. Events are only seen by
+// watchers on this node; other nodes' changes show up through their own hub.
+type EventHub struct {
+	mu   sync.Mutex
+	subs map[chan ResourceEvent]string // watcher -> resource ID filter, "" for all
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: make(map[chan ResourceEvent]string)}
+}
+
+// Subscribe returns a channel of events for resourceID, or for every
+// resource when it is empty, and the func that ends the subscription.
+func (h *EventHub) Subscribe(resourceID string) (<-chan ResourceEvent, func()) {
+	ch := make(chan ResourceEvent, WATCH_BUFFER)
+
+	h.mu.Lock()
+	h.subs[ch] = resourceID
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Publish hands ev to every matching watcher without blocking. A nil hub
+// drops everything, so a Provisioner built without one still works.
+func (h *EventHub) Publish(ev ResourceEvent) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, filter := range h.subs {
+		if filter != "" && filter != ev.ID {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (p *Provisioner) publish(id string, state string) {
+	p.events.Publish(ResourceEvent{ID: id, State: state, At: time.Now()})
+}
+
+// watchHandler streams ResourceEvents as server-sent events until the client
+// leaves or the server shuts down. ?id= limits the stream to one resource.
+func (p *Provisioner) watchHandler(serverCtx context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, unsubscribe := p.events.Subscribe(c.Query("id"))
+		defer unsubscribe()
+
+		// Send the headers now, so the client knows it is subscribed before
+		// the first event arrives.
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-serverCtx.Done():
+				return false
+			case <-c.Request.Context().Done():
+				return false
+			case ev := <-events:
+				c.SSEvent("state", ev)
+				return true
+			}
+		})
+	}
+}
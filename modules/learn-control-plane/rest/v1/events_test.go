@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchStreamsStateChanges(t *testing.T) {
+	db := setupRegistryDB(t)
+	p := &Provisioner{
+		DB:       db,
+		simulate: func(context.Context) error { return nil },
+		events:   NewEventHub(),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/watch", p.watchHandler(context.Background()))
+	router.POST("/provision", p.resourceProvisioningHandler)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/watch?id=res-watched", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Headers arriving means the watcher is subscribed.
+	for _, id := range []string{"res-other", "res-watched"} {
+		body, _ := json.Marshal(ResourceRequest{ID: id})
+		w, err := http.Post(srv.URL+"/provision", "application/json", bytes.NewBuffer(body))
+		require.NoError(t, err)
+		w.Body.Close()
+		require.Equal(t, http.StatusCreated, w.StatusCode)
+	}
+
+	var got []ResourceEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev ResourceEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &ev))
+		got = append(got, ev)
+		if ev.State == PROVISIONED.String() {
+			break
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, got, 2, "want PROVISIONING then PROVISIONED, got %+v", got)
+	assert.Equal(t, PROVISIONING.String(), got[0].State)
+	assert.Equal(t, PROVISIONED.String(), got[1].State)
+	for _, ev := range got {
+		assert.Equal(t, "res-watched", ev.ID, "the id filter let another resource through")
+	}
+}
+
+func TestEventHubDropsForSlowWatchers(t *testing.T) {
+	hub := NewEventHub()
+	events, unsubscribe := hub.Subscribe("")
+
+	// Nobody reads; publishing past the buffer must not block.
+	done := make(chan struct{})
+	go func() {
+		for range WATCH_BUFFER + 10 {
+			hub.Publish(ResourceEvent{ID: "res", State: PROVISIONED.String()})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full watcher")
+	}
+	assert.Len(t, events, WATCH_BUFFER)
+
+	unsubscribe()
+	hub.Publish(ResourceEvent{ID: "res"})
+	assert.Len(t, events, WATCH_BUFFER, "unsubscribed watcher still received events")
+}
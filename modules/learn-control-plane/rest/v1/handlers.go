@@ -3,14 +3,29 @@ package v1
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"shared/bodylimit"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Per-route admission limits: provisioning holds a request open for
+	// seconds, while /state is a cheap read that should stay responsive.
+	MAX_PROVISION_IN_FLIGHT = 8
+	MAX_STATE_IN_FLIGHT     = 64
+
+	// MAX_RESOURCE_ID_LEN bounds the ledger's primary key.
+	MAX_RESOURCE_ID_LEN = 128
 )
 
 type ProvisioningState int
@@ -21,53 +36,79 @@ const (
 	FAILED
 )
 
+// Provisioner holds the desired/observed counts behind the control loop.
+//
+// Invariant: Observed is only ever assigned from a DB count of PROVISIONED
+// rows — once at startup and then by refreshObserved on every reconcile,
+// leader or follower. Handlers change the ledger, never the counter, so a
+// resource is counted exactly once no matter which path (handler or shard
+// reconcile) provisioned it.
+//
+// The counters are atomics so concurrent handlers never queue behind each
+// other for a single increment. mu is only for compound operations that read
+// the counters and then act on them, like a reconcile pass.
 type Provisioner struct {
-	Desired  int64 `json:"desired"`
-	Observed int64 `json:"observed"`
+	Desired  atomic.Int64
+	Observed atomic.Int64
 	DB       *gorm.DB
-	mu       sync.RWMutex
-}
+	mu       sync.Mutex
 
-func (p *Provisioner) incDesired() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.Desired++
-}
+	// simulate does the actual provisioning for the handler. nil means
+	// randomProvisioningDelay; tests swap in instant or failing stubs.
+	simulate func(ctx context.Context) error
 
-func (p *Provisioner) decDesired() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.Desired--
+	// events carries ledger state changes to /v1/watch; nil publishes nowhere.
+	events *EventHub
+
+	// clock drives lease expiry and heartbeats; nil means the wall clock.
+	clock Clock
+
+	// interval is the reconcile interval; zero means RECONCILE_INTERVAL.
+	interval time.Duration
+
+	// shard is this node's shard config, parsed once by SetupV1 for
+	// shardStateHandler so the [SHARD] line is not logged per request.
+	shard ShardConfig
 }
 
-func (p *Provisioner) incObserved() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.Observed++
+func (p *Provisioner) incDesired() {
+	p.Desired.Add(1)
 }
 
-func (p *Provisioner) decObserved() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.Observed--
+func (p *Provisioner) decDesired() {
+	p.Desired.Add(-1)
 }
 
 func (p *Provisioner) getDesired() int64 {
-	p.mu.RLock()
-	desired := p.Desired
-	p.mu.RUnlock()
-	return desired
+	return p.Desired.Load()
 }
 
 func (p *Provisioner) getObserved() int64 {
-	p.mu.RLock()
-	observed := p.Observed
-	p.mu.RUnlock()
-	return observed
+	return p.Observed.Load()
 }
 
 type ResourceRequest struct {
-	ID string `json:"id"`
+	ID string `json:"id" binding:"required"`
+}
+
+// validateResourceID rejects IDs that would make a useless or awkward ledger
+// key: blank, longer than MAX_RESOURCE_ID_LEN, or outside [A-Za-z0-9._:-].
+func validateResourceID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return errors.New("id must not be empty")
+	}
+	if len(id) > MAX_RESOURCE_ID_LEN {
+		return fmt.Errorf("id must be at most %d characters", MAX_RESOURCE_ID_LEN)
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return fmt.Errorf("id contains invalid character %q; allowed are letters, digits and - _ . :", r)
+		}
+	}
+	return nil
 }
 
 type DesiredRequest struct {
@@ -89,58 +130,94 @@ type ResourceLedger struct {
 
 type IdempotencyExecution struct {
 	Key          string    `gorm:"primaryKey"`
+	RequestHash  string    `json:"request_hash"` // SHA-256 of the body the key was first used with
 	StatusCode   int       `json:"status_code"`
 	ResponseBody []byte    `json:"response_body"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
 func SetupV1(serverCtx context.Context, r *gin.Engine, db *gorm.DB) {
+	reconcile := ParseReconcileConfig()
 	p := &Provisioner{
-		Desired:  0,
-		Observed: 0,
 		DB:       db,
-		mu:       sync.RWMutex{},
+		events:   NewEventHub(),
+		interval: reconcile.Interval,
+		shard:    ParseShardConfig(),
 	}
 
-	p.DB.AutoMigrate(&ResourceLedger{}, &IdempotencyExecution{}, &ControlPlaneLease{})
+	p.DB.AutoMigrate(&ResourceLedger{}, &IdempotencyExecution{}, &ControlPlaneLease{}, &NodeHeartbeat{})
 
 	// Sync state from Database (Source of Truth)
-	p.DB.Model(&ResourceLedger{}).Count(&p.Desired)
-	p.DB.Model(&ResourceLedger{}).Where("state = ?", PROVISIONED).Count(&p.Observed)
+	var desired, observed int64
+	p.DB.Model(&ResourceLedger{}).Count(&desired)
+	p.DB.Model(&ResourceLedger{}).Where("state = ?", PROVISIONED).Count(&observed)
+	p.Desired.Store(desired)
+	p.Observed.Store(observed)
 
-	go startReconciler(serverCtx, p)
+	go startReconciler(serverCtx, p, reconcile)
 
 	v1 := r.Group("v1")
+	v1.Use(RecoveryMiddleware())
+	// Stop taking new work as soon as the server starts shutting down.
+	v1.Use(DrainMiddleware(serverCtx))
 	v1.Use(AuthMiddleware())
+	// Ahead of idempotency, which reads the whole body to hash it.
+	// MAX_BODY_BYTES overrides the default 1 MiB cap.
+	v1.Use(BodyLimitMiddleware(bodylimit.FromEnv("MAX_BODY_BYTES")))
 	// Phase 5.1 Idempotency Key Implementation with Caching
 	v1.Use(IdempotencyMiddleware(db))
 
-	v1.GET("/state", func(c *gin.Context) {
+	admission := NewAdmissionLimits()
+
+	v1.GET("/state", admission.Limit("state", MAX_STATE_IN_FLIGHT), func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
-			"desired":  p.Desired,
-			"observed": p.Observed,
-			"status":   "reconciling",
+			"desired":   p.getDesired(),
+			"observed":  p.getObserved(),
+			"status":    "reconciling",
+			"in_flight": admission.InFlight(),
 		})
 	})
 
-	v1.POST("/provision", p.resourceProvisioningHandler)
+	v1.GET("/state/shards", admission.Limit("state", MAX_STATE_IN_FLIGHT), p.shardStateHandler)
+
+	v1.POST("/provision", admission.Limit("provision", MAX_PROVISION_IN_FLIGHT), p.resourceProvisioningHandler)
+	v1.GET("/desired", p.getDesiredHandler)
+	v1.GET("/watch", p.watchHandler(serverCtx))
 	v1.POST("/desired", p.setDesiredHandler)
+
+	// Leader-election debugging
+	v1.GET("/lease", p.getLeaseHandler)
+
+	// Stealing the lease is an operator action: the client token alone
+	// cannot reach it.
+	admin := v1.Group("/lease", AdminMiddleware())
+	admin.POST("/steal", p.stealLeaseHandler)
 }
 
 func (p *Provisioner) resourceProvisioningHandler(c *gin.Context) {
-	// Phase 1: Increment the desired state
-	p.incDesired()
-
 	var req ResourceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		badBody(c, err)
+		return
+	}
+	if err := validateResourceID(req.ID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var resourceLedger ResourceLedger
-	err := p.DB.Where("id = ?", req.ID).First(&resourceLedger).Error
+	// Phase 1: Increment the desired state, only for requests we will act on
+	p.incDesired()
+
+	resourceLedger, created, err := p.claimResource(req.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create resource ledger"})
+		return
+	}
+	if created {
+		p.publish(req.ID, PROVISIONING.String())
+	}
 
-	if err == nil {
+	if !created {
 		// ALREADY EXISTS: Check the state
 		log.Printf("[IDEMPOTENCY] Resource found for Id %s, current state: %v", req.ID, resourceLedger.State)
 
@@ -159,45 +236,150 @@ func (p *Provisioner) resourceProvisioningHandler(c *gin.Context) {
 		}
 	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		resourceLedger = ResourceLedger{
-			ID:    req.ID,
-			State: PROVISIONING,
-		}
-		if err := p.DB.Create(&resourceLedger).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create resource ledger"})
+	simulate := p.simulate
+	if simulate == nil {
+		simulate = randomProvisioningDelay
+	}
+
+	ctx := c.Request.Context()
+	if err := simulate(ctx); err != nil {
+		if ctx.Err() != nil {
+			// Left PROVISIONING: the shard reconciler finishes it.
+			log.Printf("Client Disconnected for Id %s", req.ID)
 			return
 		}
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		log.Printf("Resource provisioning failed for Id %s: %v", req.ID, err)
+		p.DB.Model(&resourceLedger).Update("state", FAILED)
+		p.publish(req.ID, FAILED.String())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "provisioning failed"})
 		return
 	}
 
+	log.Printf("Resource provisioning completed for Id %s", req.ID)
+	// Observed catches up on the next reconcile, which counts this row.
+	p.DB.Model(&resourceLedger).Update("state", PROVISIONED)
+	p.publish(req.ID, PROVISIONED.String())
+	c.JSON(http.StatusCreated, gin.H{"message": "successfully provisioned"})
+}
+
+// randomProvisioningDelay stands in for the real backend: 0-4s of "work",
+// cut short if the client goes away.
+func randomProvisioningDelay(ctx context.Context) error {
 	select {
-	case <-c.Done():
-		log.Printf("Client Disconnected for Id %s", req.ID)
-		return
+	case <-ctx.Done():
+		return ctx.Err()
 	case <-time.After(time.Duration(rand.Intn(5)) * time.Second):
-		log.Printf("Resource provisioning completed for Id %s", req.ID)
-		p.DB.Model(&resourceLedger).Update("state", PROVISIONED)
-		p.incObserved()
-		c.JSON(http.StatusCreated, gin.H{"message": "successfully provisioned"})
+		return nil
+	}
+}
+
+// claimResource creates the PROVISIONING ledger row for id, or loads the row
+// that is already there. A read-then-insert would let two first-time requests
+// both see "not found" and both insert; instead the insert itself is the check
+// (ON CONFLICT DO NOTHING on the primary key), so exactly one concurrent
+// caller gets created == true and the rest see the winner's row.
+func (p *Provisioner) claimResource(id string) (ResourceLedger, bool, error) {
+	ledger := ResourceLedger{ID: id, State: PROVISIONING}
+	res := p.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ledger)
+	if res.Error != nil {
+		return ResourceLedger{}, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return ledger, true, nil
+	}
+
+	if err := p.DB.Where("id = ?", id).First(&ledger).Error; err != nil {
+		return ResourceLedger{}, false, err
+	}
+	return ledger, false, nil
+}
+
+// badBody answers a request whose JSON body could not be bound: 413 when it
+// ran past the BodyLimitMiddleware cap, 400 otherwise.
+func badBody(c *gin.Context, err error) {
+	if bodylimit.IsTooLarge(err) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
 	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+func (p *Provisioner) getDesiredHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"desired": p.getDesired()})
 }
 
 func (p *Provisioner) setDesiredHandler(c *gin.Context) {
 	var req DesiredRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badBody(c, err)
 		return
 	}
 
-	p.mu.Lock()
-	p.Desired = req.Count
-	p.mu.Unlock()
+	p.Desired.Store(req.Count)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Desired state updated",
-		"desired": p.Desired,
+		"desired": req.Count,
 	})
 }
+
+// shardStateHandler reports, per shard index, how many resources that shard
+// owns right now and in which states, using the same ownership check and
+// live-node view as reconcileShard.
+func (p *Provisioner) shardStateHandler(c *gin.Context) {
+	var resources []ResourceLedger
+	if err := p.DB.Find(&resources).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	shard := withLiveNodes(p.DB, currentNodeID(), p.shard)
+	c.JSON(http.StatusOK, gin.H{
+		"total_nodes": shard.TotalNodes,
+		"strategy":    shard.Strategy,
+		"total":       len(resources),
+		"shards":      shardBreakdown(resources, shard),
+	})
+}
+
+// LeaseResponse is the lease as seen from the node answering the request.
+type LeaseResponse struct {
+	Holder         string    `json:"holder"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Expired        bool      `json:"expired"`
+	NodeID         string    `json:"node_id"`
+	HeldByThisNode bool      `json:"held_by_this_node"`
+}
+
+func newLeaseResponse(lease ControlPlaneLease, now time.Time) LeaseResponse {
+	nodeID := currentNodeID()
+	expired := now.After(lease.ExpiresAt)
+	return LeaseResponse{
+		Holder:         lease.NodeID,
+		ExpiresAt:      lease.ExpiresAt,
+		Expired:        expired,
+		NodeID:         nodeID,
+		HeldByThisNode: lease.NodeID == nodeID && !expired,
+	}
+}
+
+func (p *Provisioner) getLeaseHandler(c *gin.Context) {
+	lease, err := getLease(p.DB)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no node has acquired the lease yet"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, newLeaseResponse(lease, p.now()))
+}
+
+func (p *Provisioner) stealLeaseHandler(c *gin.Context) {
+	lease, err := stealLease(currentNodeID(), p.DB, p.now(), leaseDuration(p.reconcileInterval()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to acquire lease"})
+		return
+	}
+	c.JSON(http.StatusOK, newLeaseResponse(lease, p.now()))
+}
@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
 
@@ -53,7 +60,7 @@ func TestAuthMiddleware(t *testing.T) {
 }
 
 func TestIdempotencyMiddleware(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, db := setupTestRouter()
 
 	t.Run("Missing Idempotency Key", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -62,6 +69,41 @@ func TestIdempotencyMiddleware(t *testing.T) {
 		router.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
+
+	provision := func(key string, id string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ResourceRequest{ID: id})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/provision", bytes.NewBuffer(body))
+		req.Header.Set("X-Auth-Token", "secret")
+		req.Header.Set("X-Idempotency-Key", key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Same Key Same Body Returns Cached Result", func(t *testing.T) {
+		db.Create(&ResourceLedger{ID: "res-cached", State: PROVISIONED})
+
+		first := provision("key-cached", "res-cached")
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		// Without the cache, a missing ledger row would start a new provisioning run.
+		db.Delete(&ResourceLedger{ID: "res-cached"})
+
+		second := provision("key-cached", "res-cached")
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+	})
+
+	t.Run("Same Key Different Body Is Rejected", func(t *testing.T) {
+		db.Create(&ResourceLedger{ID: "res-original", State: PROVISIONED})
+
+		first := provision("key-reused", "res-original")
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		second := provision("key-reused", "res-other")
+		assert.Equal(t, http.StatusUnprocessableEntity, second.Code)
+		assert.Contains(t, second.Body.String(), "different request body")
+	})
 }
 
 func TestProvisioningFlow(t *testing.T) {
@@ -76,8 +118,8 @@ func TestProvisioningFlow(t *testing.T) {
 
 		router.ServeHTTP(w, req)
 
-		// Note: The handler has a random sleep. In a real test we might mock time
-		// or use a shorter sleep for testing.
+		// Note: The handler has a random sleep here; TestProvisioningSimulator
+		// covers the same path deterministically with stubbed provisioning.
 		assert.Contains(t, []int{http.StatusCreated, http.StatusOK}, w.Code)
 	})
 
@@ -95,3 +137,371 @@ func TestProvisioningFlow(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "res-done")
 	})
 }
+
+func TestProvisioningSimulator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	provision := func(p *Provisioner, id string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/provision", p.resourceProvisioningHandler)
+
+		body, _ := json.Marshal(ResourceRequest{ID: id})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/provision", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+		return w
+	}
+	state := func(db *gorm.DB, id string) ProvisioningState {
+		var r ResourceLedger
+		require.NoError(t, db.Where("id = ?", id).First(&r).Error)
+		return r.State
+	}
+
+	t.Run("Instant stub provisions deterministically", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		p := &Provisioner{DB: db, simulate: func(context.Context) error { return nil }}
+
+		start := time.Now()
+		w := provision(p, "res-instant")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, PROVISIONED, state(db, "res-instant"))
+	})
+
+	t.Run("Failing stub marks the resource FAILED", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		p := &Provisioner{DB: db, simulate: func(context.Context) error { return errors.New("backend unavailable") }}
+
+		w := provision(p, "res-broken")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "provisioning failed")
+		assert.Equal(t, FAILED, state(db, "res-broken"))
+
+		// A FAILED resource is retried on the next request.
+		p.simulate = func(context.Context) error { return nil }
+		assert.Equal(t, http.StatusCreated, provision(p, "res-broken").Code)
+		assert.Equal(t, PROVISIONED, state(db, "res-broken"))
+	})
+}
+
+func TestProvisioningRejectsBadIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupRegistryDB(t)
+	p := &Provisioner{DB: db, simulate: func(context.Context) error { return nil }}
+	router := gin.New()
+	router.POST("/provision", p.resourceProvisioningHandler)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"Missing ID", `{}`, "required"},
+		{"Empty ID", `{"id":""}`, "required"},
+		{"Whitespace-only ID", `{"id":"   "}`, "must not be empty"},
+		{"Over-long ID", fmt.Sprintf(`{"id":%q}`, strings.Repeat("r", MAX_RESOURCE_ID_LEN+1)), "at most"},
+		{"Invalid character", `{"id":"res/1"}`, "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/provision", strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.want)
+		})
+	}
+
+	var rows int64
+	db.Model(&ResourceLedger{}).Count(&rows)
+	assert.Equal(t, int64(0), rows, "rejected requests must not touch the ledger")
+	assert.Equal(t, int64(0), p.getDesired())
+
+	t.Run("Longest valid ID is accepted", func(t *testing.T) {
+		body, _ := json.Marshal(ResourceRequest{ID: strings.Repeat("r", MAX_RESOURCE_ID_LEN)})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/provision", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func TestConcurrentCounterUpdates(t *testing.T) {
+	const (
+		incWorkers = 8
+		decWorkers = 4
+		perWorker  = 1000
+	)
+	p := &Provisioner{}
+	p.Desired.Store(100)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range incWorkers + decWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for range perWorker {
+				if i < incWorkers {
+					p.incDesired()
+				} else {
+					p.decDesired()
+				}
+			}
+		}()
+	}
+
+	// Readers and the leader's Observed sync run alongside the increments.
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for n := int64(0); ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+				p.Observed.Store(n)
+				_ = p.getDesired() + p.getObserved()
+			}
+		}
+	}()
+
+	close(start)
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	assert.Equal(t, int64(100+(incWorkers-decWorkers)*perWorker), p.getDesired())
+}
+
+func TestConcurrentFirstProvisionCreatesOneRow(t *testing.T) {
+	// ":memory:" gives every pooled connection its own empty database, so
+	// concurrent requests need a real file shared by all connections.
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cp.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{})
+	require.NoError(t, err)
+	SetupV1(context.Background(), router, db)
+
+	provision := func(key string) int {
+		body, _ := json.Marshal(ResourceRequest{ID: "res-race"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/provision", bytes.NewBuffer(body))
+		req.Header.Set("X-Auth-Token", "secret")
+		req.Header.Set("X-Idempotency-Key", key)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes[i] = provision(fmt.Sprintf("key-race-%d", i))
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	var rows int64
+	db.Model(&ResourceLedger{}).Where("id = ?", "res-race").Count(&rows)
+	assert.Equal(t, int64(1), rows, "concurrent first-time provisions must converge on one ledger row")
+
+	// One request does the provisioning; the other sees its row, either still
+	// in progress or already done.
+	assert.Contains(t, codes, http.StatusCreated)
+	assert.NotContains(t, codes, http.StatusInternalServerError)
+	for _, code := range codes {
+		assert.Contains(t, []int{http.StatusCreated, http.StatusAccepted, http.StatusOK}, code)
+	}
+}
+
+func TestClaimResourceIsAtomic(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cp.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&ResourceLedger{}))
+	p := &Provisioner{DB: db}
+
+	for i := range 20 {
+		id := fmt.Sprintf("res-claim-%d", i)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		winners := 0
+		start := make(chan struct{})
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				ledger, created, err := p.claimResource(id)
+				assert.NoError(t, err)
+				assert.Equal(t, id, ledger.ID)
+				if created {
+					mu.Lock()
+					winners++
+					mu.Unlock()
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		assert.Equal(t, 1, winners, "exactly one caller must create %s", id)
+	}
+}
+
+func TestDesiredReadBack(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	body, _ := json.Marshal(DesiredRequest{Count: 7})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/desired", bytes.NewBuffer(body))
+	req.Header.Set("X-Auth-Token", "secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// No X-Idempotency-Key: reads are exempt, just like the POST.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/desired", nil)
+	req.Header.Set("X-Auth-Token", "secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Desired int64 `json:"desired"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, int64(7), resp.Desired)
+}
+
+func TestProvisioningBodyTooLarge(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "64")
+	router, db := setupTestRouter()
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Auth-Token", "secret")
+		if key != "" {
+			req.Header.Set("X-Idempotency-Key", key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	huge := fmt.Sprintf(`{"id":%q,"count":1}`, strings.Repeat("x", 128))
+
+	t.Run("Provision", func(t *testing.T) {
+		w := post("/v1/provision", "key-huge", huge)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		var stored int64
+		db.Model(&IdempotencyExecution{}).Where("key = ?", "key-huge").Count(&stored)
+		assert.Equal(t, int64(0), stored)
+	})
+
+	t.Run("Desired", func(t *testing.T) {
+		// /v1/desired skips the idempotency hash, so the handler's own bind
+		// is what trips the limit.
+		w := post("/v1/desired", "", huge)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("Small body still accepted", func(t *testing.T) {
+		w := post("/v1/desired", "", `{"count":3}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestLeaseAdmin(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	router, db := setupTestRouter()
+
+	getLease := func() (int, LeaseResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/lease", nil)
+		req.Header.Set("X-Auth-Token", "secret")
+		router.ServeHTTP(w, req)
+		var resp LeaseResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	steal := func(router *gin.Engine, adminToken, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/lease/steal", nil)
+		req.Header.Set("X-Auth-Token", "secret")
+		if adminToken != "" {
+			req.Header.Set("X-Admin-Token", adminToken)
+		}
+		if key != "" {
+			req.Header.Set("X-Idempotency-Key", key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("No Lease Yet", func(t *testing.T) {
+		code, _ := getLease()
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	db.Create(&ControlPlaneLease{ID: LEASE_ID, NodeID: "node-9", ExpiresAt: time.Now().Add(time.Minute)})
+
+	t.Run("Held By Another Node", func(t *testing.T) {
+		code, resp := getLease()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "node-9", resp.Holder)
+		assert.False(t, resp.Expired)
+		assert.False(t, resp.HeldByThisNode)
+	})
+
+	t.Run("Steal Requires Auth", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/lease/steal", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Client Token Cannot Steal", func(t *testing.T) {
+		w := steal(router, "", "steal-client")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = steal(router, "wrong", "steal-client")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		_, resp := getLease()
+		assert.Equal(t, "node-9", resp.Holder)
+	})
+
+	t.Run("Steal Requires Idempotency Key", func(t *testing.T) {
+		w := steal(router, "admin-secret", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Steal Takes The Unexpired Lease", func(t *testing.T) {
+		w := steal(router, "admin-secret", "steal-1")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		code, resp := getLease()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, currentNodeID(), resp.Holder)
+		assert.True(t, resp.HeldByThisNode)
+	})
+
+	t.Run("Disabled Without ADMIN_TOKEN", func(t *testing.T) {
+		t.Setenv("ADMIN_TOKEN", "")
+		router, _ := setupTestRouter()
+
+		w := steal(router, "admin-secret", "steal-2")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// NODE_STALE_INTERVALS is how many reconcile intervals a node may go
+	// without a heartbeat before the leader evicts it and its shard is handed
+	// to the live nodes. Three missed reconciles, with room for jitter.
+	NODE_STALE_INTERVALS = 3
+	// NODE_STALE_AFTER is that cutoff at the default RECONCILE_INTERVAL.
+	NODE_STALE_AFTER = NODE_STALE_INTERVALS * RECONCILE_INTERVAL
+)
+
+// nodeStaleAfter is the eviction cutoff for nodes reconciling every interval.
+func nodeStaleAfter(interval time.Duration) time.Duration {
+	return NODE_STALE_INTERVALS * interval
+}
+
+// NodeHeartbeat is one row per NODE_INDEX, refreshed every reconcile cycle.
+// The rows present are the cluster membership reconcileShard works from.
+type NodeHeartbeat struct {
+	NodeIndex int       `gorm:"primaryKey;autoIncrement:false" json:"node_index"`
+	NodeID    string    `json:"node_id"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// heartbeat records that nodeIndex was alive at now, re-registering it if it
+// had been evicted.
+func heartbeat(db *gorm.DB, nodeID string, nodeIndex int, now time.Time) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_index"}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_id", "last_seen"}),
+	}).Create(&NodeHeartbeat{NodeIndex: nodeIndex, NodeID: nodeID, LastSeen: now}).Error
+}
+
+// evictStaleNodes deletes every heartbeat older than staleAfter and returns
+// the evicted rows. Only the leader calls it, so membership changes have a
+// single author.
+func evictStaleNodes(db *gorm.DB, now time.Time, staleAfter time.Duration) ([]NodeHeartbeat, error) {
+	var stale []NodeHeartbeat
+	cutoff := now.Add(-staleAfter)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("last_seen < ?", cutoff).Find(&stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Where("last_seen < ?", cutoff).Delete(&NodeHeartbeat{}).Error
+	})
+	return stale, err
+}
+
+// liveNodes returns the registered node indexes in ascending order.
+func liveNodes(db *gorm.DB) ([]int, error) {
+	var live []int
+	err := db.Model(&NodeHeartbeat{}).Order("node_index").Pluck("node_index", &live).Error
+	return live, err
+}
+
+// withLiveNodes fills in shard.Live from the registry. On a read error the
+// shard falls back to static ownership rather than skipping the cycle.
+func withLiveNodes(db *gorm.DB, nodeID string, shard ShardConfig) ShardConfig {
+	live, err := liveNodes(db)
+	if err != nil {
+		log.Printf("[NODE %s][SHARD] Failed to read node registry, using static shards: %v", nodeID, err)
+		return shard
+	}
+	shard.Live = live
+	return shard
+}
@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupRegistryDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1) // one connection, one in-memory database
+	require.NoError(t, db.AutoMigrate(&ResourceLedger{}, &ControlPlaneLease{}, &NodeHeartbeat{}))
+	return db
+}
+
+func TestStaleNodeShardIsReassigned(t *testing.T) {
+	db := setupRegistryDB(t)
+	now := time.Now()
+
+	require.NoError(t, heartbeat(db, "node-1", 0, now))
+	require.NoError(t, heartbeat(db, "node-2", 1, now))
+	require.NoError(t, heartbeat(db, "node-3", 2, now.Add(-2*NODE_STALE_AFTER)))
+
+	// Resources that live in node-3's shard; nobody reconciles them while it is down.
+	dead := ShardConfig{NodeIndex: 2, TotalNodes: 3}
+	var orphans []string
+	for i := 0; len(orphans) < 5; i++ {
+		id := fmt.Sprintf("res-%d", i)
+		if dead.OwnsShard(id) {
+			orphans = append(orphans, id)
+			require.NoError(t, db.Create(&ResourceLedger{ID: id, State: PROVISIONING}).Error)
+		}
+	}
+
+	p := &Provisioner{DB: db}
+	p.Desired.Store(int64(len(orphans)))
+	p.reconcileGlobalState("node-1")
+
+	live, err := liveNodes(db)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, live, "node-3 should have been evicted")
+
+	for i, nodeID := range []string{"node-1", "node-2"} {
+		shard := ShardConfig{NodeIndex: i, TotalNodes: 3}
+		p.reconcileShard(nodeID, withLiveNodes(db, nodeID, shard))
+	}
+
+	var ledgers []ResourceLedger
+	require.NoError(t, db.Where("id IN ?", orphans).Find(&ledgers).Error)
+	assert.Len(t, ledgers, len(orphans))
+	for _, r := range ledgers {
+		assert.Equal(t, PROVISIONED, r.State, "resource %s from the dead shard was not picked up", r.ID)
+	}
+
+	t.Run("Heartbeat re-registers an evicted node", func(t *testing.T) {
+		require.NoError(t, heartbeat(db, "node-3", 2, time.Now()))
+		live, err := liveNodes(db)
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2}, live)
+	})
+}
+
+func TestOwnsShardWithLiveNodes(t *testing.T) {
+	// With node 1 gone, every resource is still owned by exactly one of the
+	// survivors, and nothing moves between the survivors.
+	for i := range 100 {
+		id := fmt.Sprintf("resource-%d", i)
+		owners := 0
+		for _, n := range []int{0, 2} {
+			full := ShardConfig{NodeIndex: n, TotalNodes: 3}
+			degraded := ShardConfig{NodeIndex: n, TotalNodes: 3, Live: []int{0, 2}}
+			if degraded.OwnsShard(id) {
+				owners++
+			}
+			if full.OwnsShard(id) {
+				assert.True(t, degraded.OwnsShard(id), "%s moved off its live home node %d", id, n)
+			}
+		}
+		assert.Equal(t, 1, owners, "%s must be owned by exactly 1 live node", id)
+	}
+}
+
+func TestStaleCutoffScalesWithReconcileInterval(t *testing.T) {
+	db := setupRegistryDB(t)
+	clock := newFakeClock()
+	// At a 30s interval a healthy node heartbeats every ~30s, well past the
+	// 15s that the default cutoff and lease allow.
+	p := &Provisioner{DB: db, clock: clock, interval: 30 * time.Second}
+
+	reconcileAs := func(nodeID, nodeIndex string) {
+		t.Setenv("NODE_ID", nodeID)
+		t.Setenv("NODE_INDEX", nodeIndex)
+		t.Setenv("TOTAL_NODES", "2")
+		p.Reconcile()
+	}
+
+	reconcileAs("node-1", "0")
+	reconcileAs("node-2", "1")
+
+	clock.advance(p.reconcileInterval() + 5*time.Second)
+	reconcileAs("node-1", "0")
+
+	live, err := liveNodes(db)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, live, "node-2 missed no heartbeat and must not be evicted")
+
+	clock.advance(p.reconcileInterval())
+	reconcileAs("node-2", "1")
+	lease, err := getLease(db)
+	require.NoError(t, err)
+	assert.Equal(t, "node-1", lease.NodeID, "the leader's lease must outlive one reconcile interval")
+
+	t.Run("A node silent for the full cutoff is still evicted", func(t *testing.T) {
+		clock.advance(nodeStaleAfter(p.reconcileInterval()) + time.Second)
+		reconcileAs("node-1", "0")
+		live, err := liveNodes(db)
+		require.NoError(t, err)
+		assert.Equal(t, []int{0}, live)
+	})
+}
@@ -3,59 +3,131 @@ package v1
 import (
 	"errors"
 	"log"
+	"os"
+	"shared/dbtx"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const (
+	LEASE_ID = "reconciler-lock"
+	// LEASE_INTERVALS is the lease length in reconcile intervals, so a leader
+	// renewing every interval keeps it through a couple of slow cycles however
+	// RECONCILE_INTERVAL is set.
+	LEASE_INTERVALS = 3
+	// LEASE_DURATION is the lease length at the default RECONCILE_INTERVAL.
+	LEASE_DURATION = LEASE_INTERVALS * RECONCILE_INTERVAL
+)
+
+// leaseDuration is the lease length for nodes reconciling every interval.
+func leaseDuration(interval time.Duration) time.Duration {
+	return LEASE_INTERVALS * interval
+}
+
 type ControlPlaneLease struct {
 	ID        string    `gorm:"primaryKey"` // Always "reconciler-lock"
 	NodeID    string    `json:"node_id"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-func tryAcquireLease(nodeID string, db *gorm.DB) bool {
+// currentNodeID is this node's NODE_ID, or "local" when running alone.
+func currentNodeID() string {
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		return nodeID
+	}
+	return "local"
+}
+
+// getLease returns the lease row, or gorm.ErrRecordNotFound before any node
+// has ever acquired it.
+func getLease(db *gorm.DB) (ControlPlaneLease, error) {
+	var lease ControlPlaneLease
+	err := db.Where("id = ?", LEASE_ID).First(&lease).Error
+	return lease, err
+}
+
+// stealLease makes nodeID the leader for a full ttl whoever holds the lease
+// now. It is a debugging tool: the old holder only notices on its next
+// heartbeat, so for up to one reconcile cycle both nodes act as leader.
+func stealLease(nodeID string, db *gorm.DB, now time.Time, ttl time.Duration) (ControlPlaneLease, error) {
+	lease := ControlPlaneLease{ID: LEASE_ID, NodeID: nodeID, ExpiresAt: now.Add(ttl)}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_id", "expires_at"}),
+	}).Create(&lease).Error
+	if err != nil {
+		return ControlPlaneLease{}, err
+	}
+	log.Printf("[NODE %s][LEASE] Lease force-acquired", nodeID)
+	return lease, nil
+}
+
+// tryAcquireLease reports whether nodeID holds the lease after this call.
+// A busy SQLite file is retried with backoff (dbtx.Retry), so a moment of
+// lock contention does not read as "lost leadership" and hand the lease to
+// another node; a lease held by another node is an answer, not an error,
+// and is never retried. Expiry is judged against clock, so every attempt
+// reads the time afresh; a won or renewed lease runs for ttl.
+func tryAcquireLease(nodeID string, db *gorm.DB, clock Clock, ttl time.Duration) bool {
+	var held bool
+	err := dbtx.Retry(MAX_TX_RETRIES, func() error {
+		var err error
+		held, err = acquireLease(nodeID, db, clock.Now(), ttl)
+		return err
+	})
+	if err != nil {
+		log.Printf("[NODE %s][LEASE] DB error during lease attempt: %v", nodeID, err)
+		return false
+	}
+	return held
+}
+
+// acquireLease is one attempt at tryAcquireLease. It returns false with a nil
+// error when another node holds an unexpired lease.
+func acquireLease(nodeID string, db *gorm.DB, now time.Time, ttl time.Duration) (bool, error) {
 	var lease ControlPlaneLease
-	now := time.Now()
-	leaseDuration := 15 * time.Second
 
 	// 1. Try to Refresh or Takeover using a single Atomic UPDATE
 	// We only succeed if:
 	//   a) We are the current leader (Heartbeat)
 	//   b) The current lease has expired (Takeover)
 	result := db.Model(&ControlPlaneLease{}).
-		Where("id = ?", "reconciler-lock").
+		Where("id = ?", LEASE_ID).
 		Where("(node_id = ? OR expires_at < ?)", nodeID, now).
 		Updates(map[string]interface{}{
 			"node_id":    nodeID,
-			"expires_at": now.Add(leaseDuration),
+			"expires_at": now.Add(ttl),
 		})
 
 	if result.Error != nil {
-		log.Printf("[NODE %s][LEASE] DB error during lease attempt: %v", nodeID, result.Error)
-		return false
+		return false, result.Error
 	}
 
 	if result.RowsAffected > 0 {
 		// Log only when we take over, not on every heartbeat to keep logs clean
 		// But for learning purposes, let's log the current leader
 		log.Printf("[NODE %s][LEASE] Node %s acquired lease", nodeID, nodeID)
-		return true
+		return true, nil
 	}
 
 	// 2. If no rows were affected, the lease might not exist at all OR it's held by another active node
 	// Check if it exists
-	err := db.Where("id = ?", "reconciler-lock").First(&lease).Error
+	err := db.Where("id = ?", LEASE_ID).First(&lease).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Create the initial lease
 		err = db.Create(&ControlPlaneLease{
-			ID:        "reconciler-lock",
+			ID:        LEASE_ID,
 			NodeID:    nodeID,
-			ExpiresAt: now.Add(leaseDuration),
+			ExpiresAt: now.Add(ttl),
 		}).Error
-		return err == nil
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
 	}
 
-	log.Printf("[NODE %s][LEASE] Held by node: %s (Active for %v more)", nodeID, lease.NodeID, time.Until(lease.ExpiresAt).Round(time.Second))
-	return false
+	log.Printf("[NODE %s][LEASE] Held by node: %s (Active for %v more)", nodeID, lease.NodeID, lease.ExpiresAt.Sub(now).Round(time.Second))
+	return false, nil
 }
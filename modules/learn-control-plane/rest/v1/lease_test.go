@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeClock is a Clock that only moves when advance is called.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// failUpdates makes the next n UPDATEs on db fail with err and returns a
+// pointer to the number of UPDATEs attempted so far.
+func failUpdates(t *testing.T, db *gorm.DB, n int, err error) *int {
+	t.Helper()
+	attempts := 0
+	require.NoError(t, db.Callback().Update().Before("gorm:update").Register("test:fail_updates", func(tx *gorm.DB) {
+		attempts++
+		if attempts <= n {
+			tx.AddError(err)
+		}
+	}))
+	return &attempts
+}
+
+func TestLeaseRetriesTransientErrors(t *testing.T) {
+	t.Run("Busy database is retried and the lease is still acquired", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		require.NoError(t, db.Create(&ControlPlaneLease{ID: LEASE_ID, NodeID: "node-1", ExpiresAt: time.Now().Add(LEASE_DURATION)}).Error)
+		attempts := failUpdates(t, db, 2, errors.New("database is locked (5) (SQLITE_BUSY)"))
+
+		assert.True(t, tryAcquireLease("node-1", db, realClock{}, LEASE_DURATION), "a transient lock must not cost the leader its lease")
+		assert.Equal(t, 3, *attempts)
+
+		lease, err := getLease(db)
+		require.NoError(t, err)
+		assert.Equal(t, "node-1", lease.NodeID)
+	})
+
+	t.Run("Lease held by another node is not retried", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		require.NoError(t, db.Create(&ControlPlaneLease{ID: LEASE_ID, NodeID: "node-2", ExpiresAt: time.Now().Add(LEASE_DURATION)}).Error)
+		attempts := failUpdates(t, db, 0, nil)
+
+		assert.False(t, tryAcquireLease("node-1", db, realClock{}, LEASE_DURATION))
+		assert.Equal(t, 1, *attempts)
+	})
+
+	t.Run("Non-transient errors fail fast", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		attempts := failUpdates(t, db, 10, errors.New("no such table: control_plane_leases"))
+
+		assert.False(t, tryAcquireLease("node-1", db, realClock{}, LEASE_DURATION))
+		assert.Equal(t, 1, *attempts)
+	})
+
+	t.Run("Retries are bounded", func(t *testing.T) {
+		db := setupRegistryDB(t)
+		attempts := failUpdates(t, db, 100, errors.New("database is locked"))
+
+		assert.False(t, tryAcquireLease("node-1", db, realClock{}, LEASE_DURATION))
+		assert.Equal(t, MAX_TX_RETRIES+1, *attempts)
+	})
+}
+
+func TestLeaseExpiresOnFakeClock(t *testing.T) {
+	db := setupRegistryDB(t)
+	clock := newFakeClock()
+
+	require.True(t, tryAcquireLease("node-1", db, clock, LEASE_DURATION))
+
+	clock.advance(LEASE_DURATION - time.Second)
+	assert.False(t, tryAcquireLease("node-2", db, clock, LEASE_DURATION), "node-2 must wait while node-1's lease is live")
+
+	// node-1 stops renewing; once the lease runs out node-2 takes over.
+	clock.advance(2 * time.Second)
+	assert.True(t, tryAcquireLease("node-2", db, clock, LEASE_DURATION))
+	assert.False(t, tryAcquireLease("node-1", db, clock, LEASE_DURATION), "the old leader must not win the lease back")
+
+	lease, err := getLease(db)
+	require.NoError(t, err)
+	assert.Equal(t, "node-2", lease.NodeID)
+	assert.Equal(t, clock.Now().Add(LEASE_DURATION), lease.ExpiresAt.UTC())
+	assert.False(t, newLeaseResponse(lease, clock.Now()).Expired)
+}
+
+func TestLeaseFailoverOnReconcile(t *testing.T) {
+	db := setupRegistryDB(t)
+	clock := newFakeClock()
+	p := &Provisioner{DB: db, clock: clock}
+
+	reconcileAs := func(nodeID string) string {
+		t.Setenv("NODE_ID", nodeID)
+		p.Reconcile()
+		lease, err := getLease(db)
+		require.NoError(t, err)
+		return lease.NodeID
+	}
+
+	assert.Equal(t, "node-1", reconcileAs("node-1"))
+	assert.Equal(t, "node-1", reconcileAs("node-2"), "a live lease is not taken over")
+
+	clock.advance(LEASE_DURATION + time.Second)
+	assert.Equal(t, "node-2", reconcileAs("node-2"))
+}
@@ -2,25 +2,57 @@ package v1
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"runtime/debug"
+	"shared/bodylimit"
+	"shared/lru"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+// bodyWriter tees the response into body so it can be stored for replay.
+// Once more than limit bytes have been written it stops capturing and drops
+// what it had, so a huge response streams through without being buffered.
 type bodyWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body     *bytes.Buffer
+	limit    int
+	tooLarge bool
 }
 
-func (w bodyWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	w.capture(b)
 	return w.ResponseWriter.Write(b)
 }
 
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyWriter) capture(b []byte) {
+	if w.tooLarge {
+		return
+	}
+	if w.body.Len()+len(b) > w.limit {
+		w.tooLarge = true
+		w.body = nil
+		return
+	}
+	w.body.Write(b)
+}
+
 func loggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Logic before the handler (e.g., log start time, IP)
@@ -31,6 +63,57 @@ func loggerMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RecoveryMiddleware is the outermost v1 middleware: a panic anywhere below
+// it becomes a 500 and a [RECOVERY] log line with the caller's X-Request-ID.
+// The panic unwinds IdempotencyMiddleware before its store step, so nothing
+// is cached for the key and a retry runs the handler again.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			log.Printf("[RECOVERY] panic serving %s %s request_id=%s: %v\n%s",
+				c.Request.Method, c.Request.URL.Path, c.GetHeader("X-Request-ID"), r, debug.Stack())
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}()
+		c.Next()
+	}
+}
+
+// DrainMiddleware rejects new requests with 503 once the shutdown context is
+// cancelled. Requests already past it run to completion, and Connection: close
+// tells keep-alive clients to reconnect elsewhere instead of reusing a
+// connection to a node that is going away.
+func DrainMiddleware(shutdown context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		select {
+		case <-shutdown.Done():
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		default:
+			c.Next()
+		}
+	}
+}
+
+// BodyLimitMiddleware bounds what IdempotencyMiddleware hashes and the
+// handlers bind to maxBytes; both answer an overrun with 413 (see badBody).
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodylimit.Wrap(c.Writer, c.Request, maxBytes)
+		c.Next()
+	}
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// TODO: Implement the logic:
@@ -52,10 +135,49 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware guards operator-only routes such as /v1/lease/steal. The
+// client token is not enough: X-Admin-Token must match ADMIN_TOKEN, and with
+// ADMIN_TOKEN unset every admin route answers 403.
+func AdminMiddleware() gin.HandlerFunc {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled"})
+			return
+		}
+		token := c.Request.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+const (
+	// IDEMPOTENCY_CACHE_SIZE caps how many completed executions are kept in
+	// memory in front of the IdempotencyExecution table.
+	IDEMPOTENCY_CACHE_SIZE = 1024
+
+	// IDEMPOTENCY_MAX_CAPTURE is the largest response body, in bytes, that is
+	// buffered and stored for replay. Larger responses are still delivered
+	// but not cached, so a retry with the same key runs the handler again.
+	IDEMPOTENCY_MAX_CAPTURE = 1 << 20
+)
+
 func IdempotencyMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return idempotencyMiddleware(db, IDEMPOTENCY_MAX_CAPTURE)
+}
+
+func idempotencyMiddleware(db *gorm.DB, maxCapture int) gin.HandlerFunc {
+	// Cached executions are immutable once stored, so the LRU can never serve a
+	// stale one; a miss just falls through to the table.
+	cache := lru.New[string, IdempotencyExecution](IDEMPOTENCY_CACHE_SIZE)
+
 	return func(c *gin.Context) {
 		// Only apply to state-changing methods
 		// EXCEPTION: Skip for /v1/desired as it's a control-plane update that shouldn't require client-side keys for learning
+		// (GET /v1/desired is a read and is covered by the method check anyway)
 		if c.Request.Method == http.MethodGet || c.Request.URL.Path == "/v1/desired" {
 			c.Next()
 			return
@@ -67,10 +189,26 @@ func IdempotencyMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// The key alone is not enough: a client reusing a key with a different
+		// body would otherwise get the first request's response back silently.
+		requestHash, err := hashRequestBody(c)
+		if bodylimit.IsTooLarge(err) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+
 		// 1. Check if we have a cached result
-		var execution IdempotencyExecution
-		err := db.Where("key = ?", key).First(&execution).Error
+		execution, err := lookupExecution(cache, db, key)
 		if err == nil {
+			if execution.RequestHash != requestHash {
+				log.Printf("[IDEMPOTENCY] Key %s reused with a different request body", key)
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "X-Idempotency-Key was already used with a different request body"})
+				return
+			}
 			log.Printf("[IDEMPOTENCY] Returning cached result for key: %s", key)
 			c.Data(execution.StatusCode, "application/json", execution.ResponseBody)
 			c.Abort()
@@ -84,33 +222,77 @@ func IdempotencyMiddleware(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 2. Wrap the response writer to capture the result
-		bw := &bodyWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		bw := &bodyWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer, limit: maxCapture}
 		c.Writer = bw
 
 		c.Next()
 
 		// 3. Store the result if the request was successful
+		if bw.tooLarge {
+			log.Printf("[IDEMPOTENCY] Response for key %s too large to cache (over %d bytes)", key, maxCapture)
+			return
+		}
 		if c.Writer.Status() < 400 {
 			log.Printf("[IDEMPOTENCY] Caching result for key: %s", key)
 			capture := IdempotencyExecution{
 				Key:          key,
+				RequestHash:  requestHash,
 				StatusCode:   c.Writer.Status(),
 				ResponseBody: bw.body.Bytes(),
 				CreatedAt:    time.Now(),
 			}
 			if err := db.Create(&capture).Error; err != nil {
 				log.Printf("[IDEMPOTENCY] Failed to cache result for key %s: %v", key, err)
+				return
 			}
+			cache.Set(key, capture)
 		}
 	}
 }
 
+// lookupExecution returns the stored execution for key, trying the in-memory
+// cache before the database and remembering what the database returns.
+func lookupExecution(cache *lru.Cache[string, IdempotencyExecution], db *gorm.DB, key string) (IdempotencyExecution, error) {
+	if execution, ok := cache.Get(key); ok {
+		return execution, nil
+	}
+
+	var execution IdempotencyExecution
+	if err := db.Where("key = ?", key).First(&execution).Error; err != nil {
+		return IdempotencyExecution{}, err
+	}
+	cache.Set(key, execution)
+	return execution, nil
+}
+
+// hashRequestBody returns the hex SHA-256 of the request body and puts the
+// body back so the handler can still bind it.
+func hashRequestBody(c *gin.Context) (string, error) {
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			return "", err
+		}
+		c.Request.Body.Close()
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 func MaxConcurrentMiddleware(admissionTokens int) gin.HandlerFunc {
-	concurrencyLimiter := make(chan struct{}, admissionTokens)
+	return admit(make(chan struct{}, admissionTokens))
+}
+
+// admit lets a request through while sem has room and rejects it with 429
+// otherwise. The slot is held until the rest of the chain returns.
+func admit(sem chan struct{}) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		select {
-		case concurrencyLimiter <- struct{}{}:
-			defer func() { <-concurrencyLimiter }()
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
 			c.Next()
 		default:
 			c.AbortWithStatus(http.StatusTooManyRequests)
@@ -118,35 +300,41 @@ func MaxConcurrentMiddleware(admissionTokens int) gin.HandlerFunc {
 	}
 }
 
-func RateLimiterMiddleware(requestPerSecond int, rate time.Duration) gin.HandlerFunc {
-	rateLimiter := make(chan struct{}, requestPerSecond)
+// AdmissionLimits hands out an independent semaphore per route, so a burst on
+// an expensive route like /provision cannot starve a cheap one like /state the
+// way a single MaxConcurrentMiddleware on the whole group would.
+type AdmissionLimits struct {
+	mu     sync.Mutex
+	routes map[string]chan struct{}
+}
+
+func NewAdmissionLimits() *AdmissionLimits {
+	return &AdmissionLimits{routes: make(map[string]chan struct{})}
+}
+
+// Limit returns a middleware admitting at most n concurrent requests for
+// route. Calling it again for the same route shares the existing semaphore
+// and ignores n.
+func (a *AdmissionLimits) Limit(route string, n int) gin.HandlerFunc {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	// Fill the bucket with initial tokens
-	for range requestPerSecond {
-		rateLimiter <- struct{}{}
+	sem, ok := a.routes[route]
+	if !ok {
+		sem = make(chan struct{}, n)
+		a.routes[route] = sem
 	}
+	return admit(sem)
+}
 
-	go func() {
-		t := time.NewTicker(rate)
-		defer t.Stop()
-		for range t.C {
-			for range requestPerSecond {
-				select {
-				case rateLimiter <- struct{}{}:
-				default:
-					goto nextTick
-				}
-			}
-		nextTick:
-		}
-	}()
+// InFlight reports how many requests each route is currently serving.
+func (a *AdmissionLimits) InFlight() map[string]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	return func(c *gin.Context) {
-		select {
-		case <-rateLimiter:
-			c.Next()
-		default:
-			c.AbortWithStatus(http.StatusTooManyRequests)
-		}
+	out := make(map[string]int, len(a.routes))
+	for route, sem := range a.routes {
+		out[route] = len(sem)
 	}
+	return out
 }
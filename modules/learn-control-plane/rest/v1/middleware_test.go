@@ -0,0 +1,267 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"shared/lru"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAdmissionLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	admission := NewAdmissionLimits()
+
+	release := make(chan struct{})
+	r.POST("/slow", admission.Limit("slow", 1), func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fast", admission.Limit("fast", 1), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Saturate /slow with one request parked in the handler.
+	done := make(chan int)
+	go func() { done <- do("POST", "/slow") }()
+	assert.Eventually(t, func() bool { return admission.InFlight()["slow"] == 1 },
+		time.Second, 5*time.Millisecond)
+
+	t.Run("Saturated route rejects", func(t *testing.T) {
+		assert.Equal(t, http.StatusTooManyRequests, do("POST", "/slow"))
+	})
+
+	t.Run("Other route keeps its own limit", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("GET", "/fast"))
+		assert.Equal(t, 0, admission.InFlight()["fast"])
+	})
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, map[string]int{"slow": 0, "fast": 0}, admission.InFlight())
+}
+
+func TestDrainMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	shutdown, beginShutdown := context.WithCancel(context.Background())
+	defer beginShutdown()
+	r.Use(DrainMiddleware(shutdown))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Serves before shutdown", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("/fast").Code)
+	})
+
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() { inFlight <- do("/slow") }()
+	<-entered
+
+	beginShutdown()
+
+	t.Run("Rejects new requests while draining", func(t *testing.T) {
+		w := do("/fast")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "close", w.Header().Get("Connection"))
+	})
+
+	t.Run("In-flight request finishes", func(t *testing.T) {
+		close(release)
+		assert.Equal(t, http.StatusOK, (<-inFlight).Code)
+	})
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	router, db := setupTestRouter()
+
+	provision := func(key, id string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ResourceRequest{ID: id})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/provision", bytes.NewBuffer(body))
+		req.Header.Set("X-Auth-Token", "secret")
+		req.Header.Set("X-Idempotency-Key", key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Cache miss falls back to the DB", func(t *testing.T) {
+		// Stored by another node, so this node's cache has never seen it.
+		body, _ := json.Marshal(ResourceRequest{ID: "res-elsewhere"})
+		sum := sha256.Sum256(body)
+		db.Create(&IdempotencyExecution{
+			Key:          "key-elsewhere",
+			RequestHash:  hex.EncodeToString(sum[:]),
+			StatusCode:   http.StatusCreated,
+			ResponseBody: []byte(`{"message":"from another node"}`),
+		})
+
+		w := provision("key-elsewhere", "res-elsewhere")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, `{"message":"from another node"}`, w.Body.String())
+	})
+
+	t.Run("Cache hit does not need the DB row", func(t *testing.T) {
+		db.Create(&ResourceLedger{ID: "res-hot", State: PROVISIONED})
+		first := provision("key-hot", "res-hot")
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		db.Where("key = ?", "key-hot").Delete(&IdempotencyExecution{})
+		db.Delete(&ResourceLedger{ID: "res-hot"})
+
+		second := provision("key-hot", "res-hot")
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+	})
+}
+
+func TestIdempotencyMaxCapture(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&IdempotencyExecution{}))
+
+	const maxCapture = 64
+	calls := 0
+	router := gin.New()
+	router.Use(idempotencyMiddleware(db, maxCapture))
+	router.POST("/:size", func(c *gin.Context) {
+		calls++
+		size, _ := strconv.Atoi(c.Param("size"))
+		// Several writes, so the limit is crossed part-way through.
+		for range size / 16 {
+			c.Writer.WriteString(strings.Repeat("x", 16))
+		}
+	})
+
+	post := func(key string, size int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/"+strconv.Itoa(size), nil)
+		req.Header.Set("X-Idempotency-Key", key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	stored := func(key string) int64 {
+		var n int64
+		db.Model(&IdempotencyExecution{}).Where("key = ?", key).Count(&n)
+		return n
+	}
+
+	t.Run("Small response is cached", func(t *testing.T) {
+		calls = 0
+		w := post("key-small", maxCapture)
+		assert.Equal(t, maxCapture, w.Body.Len())
+		assert.Equal(t, int64(1), stored("key-small"))
+
+		again := post("key-small", maxCapture)
+		assert.Equal(t, w.Body.String(), again.Body.String())
+		assert.Equal(t, 1, calls, "replay should not run the handler")
+	})
+
+	t.Run("Large response is delivered but not cached", func(t *testing.T) {
+		calls = 0
+		w := post("key-large", 4*maxCapture)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, strings.Repeat("x", 4*maxCapture), w.Body.String())
+		assert.Equal(t, int64(0), stored("key-large"))
+
+		again := post("key-large", 4*maxCapture)
+		assert.Equal(t, w.Body.String(), again.Body.String())
+		assert.Equal(t, 2, calls, "uncached key should run the handler again")
+	})
+}
+
+func TestIdempotencyPanicIsNotCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&IdempotencyExecution{}))
+
+	calls := 0
+	router := gin.New()
+	router.Use(RecoveryMiddleware(), IdempotencyMiddleware(db))
+	router.POST("/boom", func(c *gin.Context) {
+		calls++
+		panic("boom")
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/boom", nil)
+		req.Header.Set("X-Idempotency-Key", "key-panic")
+		req.Header.Set("X-Request-ID", "req-panic")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post()
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"internal server error"}`, w.Body.String())
+
+	var stored int64
+	db.Model(&IdempotencyExecution{}).Count(&stored)
+	assert.Equal(t, int64(0), stored, "a panicked response must not be cached")
+
+	// Nothing was cached in memory either, so the retry reaches the handler.
+	assert.Equal(t, http.StatusInternalServerError, post().Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestLookupExecution(t *testing.T) {
+	_, db := setupTestRouter()
+	cache := lru.New[string, IdempotencyExecution](2)
+
+	_, err := lookupExecution(cache, db, "missing")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	assert.Equal(t, 0, cache.Len())
+
+	db.Create(&IdempotencyExecution{Key: "stored", StatusCode: http.StatusOK})
+	got, err := lookupExecution(cache, db, "stored")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, got.StatusCode)
+
+	cached, ok := cache.Get("stored")
+	assert.True(t, ok, "DB hit should be remembered in the cache")
+	assert.Equal(t, "stored", cached.Key)
+}
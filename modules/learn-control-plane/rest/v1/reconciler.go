@@ -4,29 +4,106 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
+	"shared/dbtx"
+	"strconv"
 	"time"
+
+	"gorm.io/gorm"
 )
 
-func startReconciler(ctx context.Context, p *Provisioner) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+const (
+	// MAX_TX_RETRIES bounds how often a transaction that hit SQLITE_BUSY is rerun.
+	MAX_TX_RETRIES = 3
+
+	// RECONCILE_INTERVAL is the base time between reconciles; every wait is
+	// moved by up to ±RECONCILE_JITTER of it so nodes drift out of lockstep.
+	RECONCILE_INTERVAL = 5 * time.Second
+	RECONCILE_JITTER   = 0.2
+)
+
+// ReconcileConfig is how often a node reconciles. A node started at the same
+// moment as its peers with a fixed ticker would hit the DB in lockstep with
+// them forever; a random offset per wait spreads the load out.
+type ReconcileConfig struct {
+	Interval time.Duration
+	Jitter   float64 // fraction of Interval, 0 <= Jitter < 1
+	rng      *rand.Rand
+}
+
+// NewReconcileConfig clamps jitter into [0, 1) and seeds the per-node random
+// source; nodes with different seeds pick different waits.
+func NewReconcileConfig(interval time.Duration, jitter float64, seed uint64) ReconcileConfig {
+	jitter = max(0, min(jitter, 0.99))
+	return ReconcileConfig{
+		Interval: interval,
+		Jitter:   jitter,
+		rng:      rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// ParseReconcileConfig reads RECONCILE_INTERVAL (a Go duration) and
+// RECONCILE_JITTER (a fraction) from the env. The seed mixes NODE_INDEX into
+// the start time so nodes started in the same instant still diverge.
+func ParseReconcileConfig() ReconcileConfig {
+	interval := RECONCILE_INTERVAL
+	if v := os.Getenv("RECONCILE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		}
+	}
+
+	jitter := RECONCILE_JITTER
+	if v := os.Getenv("RECONCILE_JITTER"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			jitter = f
+		}
+	}
+
+	seed := uint64(time.Now().UnixNano()) + uint64(ParseShardConfig().NodeIndex)
+	cfg := NewReconcileConfig(interval, jitter, seed)
+	log.Printf("[RECONCILER] Interval %v ±%.0f%%", cfg.Interval, cfg.Jitter*100)
+	return cfg
+}
+
+// Next returns the wait before the next reconcile, uniformly spread over
+// Interval ± Jitter*Interval.
+func (c ReconcileConfig) Next() time.Duration {
+	if c.Jitter == 0 {
+		return c.Interval
+	}
+	spread := c.Jitter * float64(c.Interval)
+	return c.Interval + time.Duration((c.rng.Float64()*2-1)*spread)
+}
+
+// reconcileInterval is the interval the reconciler was started with, or
+// RECONCILE_INTERVAL when it was not. The lease and stale-node cutoffs are
+// multiples of it, so they keep up with a longer RECONCILE_INTERVAL.
+func (p *Provisioner) reconcileInterval() time.Duration {
+	if p.interval <= 0 {
+		return RECONCILE_INTERVAL
+	}
+	return p.interval
+}
+
+func startReconciler(ctx context.Context, p *Provisioner, cfg ReconcileConfig) {
+	timer := time.NewTimer(cfg.Next())
+	defer timer.Stop()
 
-	for range ticker.C {
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
+		case <-timer.C:
 			p.Reconcile()
+			timer.Reset(cfg.Next())
 		}
 	}
 }
 
 func (p *Provisioner) Reconcile() {
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		nodeID = "local"
-	}
+	nodeID := currentNodeID()
 
 	// --- Architecture Decision ---
 	//
@@ -46,35 +123,66 @@ func (p *Provisioner) Reconcile() {
 
 	shard := ParseShardConfig()
 
+	// Announce this node to the registry before anything else, so the leader
+	// never evicts a node that is still reconciling.
+	if err := heartbeat(p.DB, nodeID, shard.NodeIndex, p.now()); err != nil {
+		log.Printf("[NODE %s][HEARTBEAT] Failed to record heartbeat: %v", nodeID, err)
+	}
+
 	// STEP 1: Global gate — only the leader adjusts Desired state cluster-wide.
-	isLeader := tryAcquireLease(nodeID, p.DB)
+	isLeader := tryAcquireLease(nodeID, p.DB, p.getClock(), leaseDuration(p.reconcileInterval()))
 
 	if isLeader {
 		p.reconcileGlobalState(nodeID)
 	} else {
+		// Counting is a read, not a cluster-wide decision: a follower still
+		// refreshes Observed so its own /v1/state does not go stale.
+		p.refreshObserved()
 		log.Printf("[NODE %s][RECONCILER] Follower — skipping global state management", nodeID)
 	}
 
 	// STEP 2: Per-shard work — ALL nodes do this, regardless of leader status.
 	// Safety: two nodes share a shard ONLY if they have the same NODE_INDEX.
 	// The deployment layer must prevent this (K8s StatefulSet, Docker --name uniqueness).
-	p.reconcileShard(nodeID, shard)
+	p.reconcileShard(nodeID, withLiveNodes(p.DB, nodeID, shard))
+}
+
+// refreshObserved is the SOLE writer of p.Observed (the cluster-wide reality):
+// it assigns the DB count of PROVISIONED rows, never increments, which is what
+// keeps the count from drifting. Every node runs it each reconcile; on a DB
+// error Observed keeps its last value.
+func (p *Provisioner) refreshObserved() int64 {
+	var observedCount int64
+	if err := p.DB.Model(&ResourceLedger{}).Where("state = ?", PROVISIONED).Count(&observedCount).Error; err != nil {
+		log.Printf("[RECONCILER] Observed count failed: %v", err)
+		return p.getObserved()
+	}
+	p.Observed.Store(observedCount)
+	return observedCount
 }
 
 // reconcileGlobalState is only run by the current leader.
 // It is responsible for cluster-wide decisions: scaling up/down total resource count.
-// It is also the SOLE authority on updating p.Observed (the cluster-wide reality).
+// It holds p.mu throughout, so two passes can never both see the same gap
+// between Desired and the DB and scale for it twice.
 func (p *Provisioner) reconcileGlobalState(nodeID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	var totalCount int64
-	var observedCount int64
 	p.DB.Model(&ResourceLedger{}).Count(&totalCount)
-	p.DB.Model(&ResourceLedger{}).Where("state = ?", PROVISIONED).Count(&observedCount)
+	observedCount := p.refreshObserved()
 
-	// Keep in-memory p.Observed in sync with cluster-wide DB reality.
-	// Only the leader does this to avoid race conditions across nodes.
-	p.mu.Lock()
-	p.Observed = observedCount
-	p.mu.Unlock()
+	// Nodes that stopped heartbeating lose their shard to the live nodes.
+	now := p.now()
+	stale, err := evictStaleNodes(p.DB, now, nodeStaleAfter(p.reconcileInterval()))
+	if err != nil {
+		log.Printf("[NODE %s][LEADER] Stale node check failed: %v", nodeID, err)
+	}
+	for _, n := range stale {
+		log.Printf("[NODE %s][LEADER] Evicted node %s (index %d), last seen %v ago; its shard is reassigned",
+			nodeID, n.NodeID, n.NodeIndex, now.Sub(n.LastSeen).Round(time.Second))
+	}
 
 	desired := p.getDesired()
 
@@ -84,9 +192,29 @@ func (p *Provisioner) reconcileGlobalState(nodeID string) {
 	if desired > totalCount {
 		diff := desired - totalCount
 		log.Printf("[NODE %s][LEADER] ScaleUp: Creating %d new resource stubs", nodeID, diff)
-		for i := 0; i < int(diff); i++ {
-			id := fmt.Sprintf("global-auto-%d-%d", time.Now().UnixNano(), i)
-			p.DB.Create(&ResourceLedger{ID: id, State: PROVISIONING})
+		// One transaction for the whole batch, retried if the shared SQLite file
+		// is locked by another node, so a busy DB never leaves half the stubs.
+		var created []string
+		err := dbtx.Retry(MAX_TX_RETRIES, func() error {
+			created = created[:0]
+			return p.DB.Transaction(func(tx *gorm.DB) error {
+				for i := 0; i < int(diff); i++ {
+					id := fmt.Sprintf("global-auto-%d-%d", time.Now().UnixNano(), i)
+					if err := tx.Create(&ResourceLedger{ID: id, State: PROVISIONING}).Error; err != nil {
+						return err
+					}
+					created = append(created, id)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			log.Printf("[NODE %s][LEADER] ScaleUp failed: %v", nodeID, err)
+		} else {
+			// Only announce stubs once they are committed.
+			for _, id := range created {
+				p.publish(id, PROVISIONING.String())
+			}
 		}
 	} else if desired < totalCount {
 		diff := totalCount - desired
@@ -95,6 +223,7 @@ func (p *Provisioner) reconcileGlobalState(nodeID string) {
 		p.DB.Where("state = ?", PROVISIONED).Limit(int(diff)).Find(&surplus)
 		for _, r := range surplus {
 			p.DB.Delete(&r)
+			p.publish(r.ID, DELETED)
 		}
 	}
 }
@@ -103,7 +232,7 @@ func (p *Provisioner) reconcileGlobalState(nodeID string) {
 // whose ID hashes to its NODE_INDEX. No lock needed — natural partitioning.
 //
 // IMPORTANT: This function does NOT write to p.Observed.
-// p.Observed is a cluster-wide counter owned exclusively by reconcileGlobalState().
+// p.Observed is a cluster-wide counter owned exclusively by refreshObserved().
 // Using a local variable here prevents stomping the global count with a per-shard slice.
 func (p *Provisioner) reconcileShard(nodeID string, shard ShardConfig) {
 	// Load all resources, filter to this node's shard in-memory.
@@ -113,8 +242,9 @@ func (p *Provisioner) reconcileShard(nodeID string, shard ShardConfig) {
 
 	// Local count — never written to p.Observed
 	myObserved := int64(0)
+	owns := shard.Owner()
 	for _, r := range allResources {
-		if !shard.OwnsShard(r.ID) {
+		if !owns(r.ID) {
 			continue
 		}
 
@@ -126,6 +256,7 @@ func (p *Provisioner) reconcileShard(nodeID string, shard ShardConfig) {
 			log.Printf("[NODE %s][SHARD %d/%d] Completing resource: %s",
 				nodeID, shard.NodeIndex, shard.TotalNodes, r.ID)
 			p.DB.Model(&r).Update("state", PROVISIONED)
+			p.publish(r.ID, PROVISIONED.String())
 			myObserved++
 		}
 	}
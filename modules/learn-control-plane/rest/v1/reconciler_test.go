@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileJitter(t *testing.T) {
+	const base = 5 * time.Second
+	node0 := NewReconcileConfig(base, 0.2, 0)
+	node1 := NewReconcileConfig(base, 0.2, 1)
+
+	lo, hi := 4*time.Second, 6*time.Second
+	differ := false
+	for range 20 {
+		a, b := node0.Next(), node1.Next()
+		assert.GreaterOrEqual(t, a, lo)
+		assert.LessOrEqual(t, a, hi)
+		assert.GreaterOrEqual(t, b, lo)
+		assert.LessOrEqual(t, b, hi)
+		if a != b {
+			differ = true
+		}
+	}
+	assert.True(t, differ, "nodes with different seeds should not reconcile in lockstep")
+
+	t.Run("Zero jitter keeps the base interval", func(t *testing.T) {
+		cfg := NewReconcileConfig(base, 0, 0)
+		assert.Equal(t, base, cfg.Next())
+	})
+}
+
+func TestParseReconcileConfig(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg := ParseReconcileConfig()
+		assert.Equal(t, RECONCILE_INTERVAL, cfg.Interval)
+		assert.Equal(t, RECONCILE_JITTER, cfg.Jitter)
+	})
+
+	t.Run("Reads RECONCILE_INTERVAL and RECONCILE_JITTER from env", func(t *testing.T) {
+		t.Setenv("RECONCILE_INTERVAL", "2s")
+		t.Setenv("RECONCILE_JITTER", "0.5")
+		cfg := ParseReconcileConfig()
+		assert.Equal(t, 2*time.Second, cfg.Interval)
+		assert.Equal(t, 0.5, cfg.Jitter)
+	})
+}
+
+func TestObservedConvergesToDB(t *testing.T) {
+	db := setupRegistryDB(t)
+	p := &Provisioner{DB: db, simulate: func(context.Context) error { return nil }}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/provision", p.resourceProvisioningHandler)
+
+	ids := []string{"res-obs-1", "res-obs-2", "res-obs-3"}
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(ResourceRequest{ID: id})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/provision", bytes.NewBuffer(body))
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusCreated, w.Code)
+		}()
+	}
+	wg.Wait()
+
+	var provisioned int64
+	require.NoError(t, db.Model(&ResourceLedger{}).Where("state = ?", PROVISIONED).Count(&provisioned).Error)
+	require.Equal(t, int64(len(ids)), provisioned)
+
+	// The handler only writes the ledger; the counter waits for the reconciler.
+	assert.Equal(t, int64(0), p.getObserved())
+
+	// However often the leader reconciles, Observed lands on the DB count
+	// and stays there.
+	for range 3 {
+		p.reconcileGlobalState("node-1")
+		assert.Equal(t, provisioned, p.getObserved())
+	}
+}
+
+func TestFollowerRefreshesObserved(t *testing.T) {
+	db := setupRegistryDB(t)
+	p := &Provisioner{DB: db}
+
+	// node-1 leads; this node is a follower with a stale Observed of 0.
+	require.NoError(t, db.Create(&ControlPlaneLease{ID: LEASE_ID, NodeID: "node-1", ExpiresAt: time.Now().Add(LEASE_DURATION)}).Error)
+	for _, id := range []string{"res-f-1", "res-f-2"} {
+		require.NoError(t, db.Create(&ResourceLedger{ID: id, State: PROVISIONED}).Error)
+	}
+
+	t.Setenv("NODE_ID", "node-2")
+	p.Reconcile()
+
+	assert.Equal(t, int64(2), p.getObserved())
+
+	// Desired is 0 here, but scaling down is the leader's call, not ours.
+	var rows int64
+	require.NoError(t, db.Model(&ResourceLedger{}).Count(&rows).Error)
+	assert.Equal(t, int64(2), rows)
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+const (
+	// SHARD_STRATEGY picks how resources map to nodes: "modulo" (default)
+	// hashes mod TotalNodes, "ring" uses the consistent-hash ring below.
+	SHARD_STRATEGY_MODULO = "modulo"
+	SHARD_STRATEGY_RING   = "ring"
+
+	// RING_VNODES is how many points each node gets on the ring. More points
+	// even out the arc each node owns at the cost of a bigger ring.
+	RING_VNODES = 128
+)
+
+// HashRing is a consistent-hash ring: every node is hashed onto a circle of
+// (mixed) FNV-1a values RING_VNODES times, and a key belongs to the first node point
+// at or after its own hash. Adding or removing a node only moves the keys on
+// the arcs next to that node's points, about 1/N of them, where modulo
+// reshuffles nearly everything.
+type HashRing struct {
+	points []uint32       // sorted
+	owners map[uint32]int // point -> node index
+}
+
+// NewHashRing places each node in nodes onto the ring vnodes times.
+func NewHashRing(nodes []int, vnodes int) *HashRing {
+	r := &HashRing{owners: make(map[uint32]int, len(nodes)*vnodes)}
+	for _, node := range nodes {
+		for v := range vnodes {
+			p := ringHash("node-" + strconv.Itoa(node) + "#" + strconv.Itoa(v))
+			// On the rare collision the lower index wins, so every node
+			// building the ring agrees.
+			if owner, ok := r.owners[p]; ok {
+				r.owners[p] = min(owner, node)
+				continue
+			}
+			r.points = append(r.points, p)
+			r.owners[p] = node
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// Owner returns the node index key belongs to, or -1 for an empty ring.
+func (r *HashRing) Owner(key string) int {
+	if len(r.points) == 0 {
+		return -1
+	}
+	h := ringHash(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0 // wrap around the circle
+	}
+	return r.owners[r.points[i]]
+}
+
+// Ring builds the ring for this config: the Live nodes when membership is
+// known, otherwise every index below TotalNodes.
+func (cfg ShardConfig) Ring() *HashRing {
+	nodes := cfg.Live
+	if len(nodes) == 0 {
+		nodes = make([]int, cfg.TotalNodes)
+		for i := range nodes {
+			nodes[i] = i
+		}
+	}
+	return NewHashRing(nodes, RING_VNODES)
+}
+
+// OwnsShardRing is OwnsShard on the consistent-hash ring. It builds the ring
+// on every call; loops should use Owner, which builds it once.
+func (cfg ShardConfig) OwnsShardRing(resourceID string) bool {
+	return cfg.Ring().Owner(resourceID) == cfg.NodeIndex
+}
+
+// Owner returns the ownership check for cfg.Strategy, with any ring built
+// up front so filtering a whole table does not rebuild it per resource.
+func (cfg ShardConfig) Owner() func(resourceID string) bool {
+	if cfg.Strategy != SHARD_STRATEGY_RING {
+		return cfg.OwnsShard
+	}
+	ring := cfg.Ring()
+	return func(resourceID string) bool {
+		return ring.Owner(resourceID) == cfg.NodeIndex
+	}
+}
+
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// ringHash is FNV-1a run through murmur3's finalizer. Raw FNV-1a barely
+// moves for strings that differ only in their last character, like the
+// "node-1#7", "node-1#8" point labels, which clumps a node's points together
+// on the ring; the finalizer spreads them out.
+func ringHash(s string) uint32 {
+	h := hash32(s)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,89 @@
+package v1
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRing(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("resource-%d", i)
+	}
+
+	t.Run("Every key has exactly one owner", func(t *testing.T) {
+		nodes := []ShardConfig{
+			{NodeIndex: 0, TotalNodes: 3, Strategy: SHARD_STRATEGY_RING},
+			{NodeIndex: 1, TotalNodes: 3, Strategy: SHARD_STRATEGY_RING},
+			{NodeIndex: 2, TotalNodes: 3, Strategy: SHARD_STRATEGY_RING},
+		}
+		owners := make([]func(string) bool, len(nodes))
+		for i, cfg := range nodes {
+			owners[i] = cfg.Owner()
+		}
+
+		for _, k := range keys[:500] {
+			count := 0
+			for i, owns := range owners {
+				if owns(k) {
+					count++
+					assert.Equal(t, owns(k), nodes[i].OwnsShardRing(k), "Owner and OwnsShardRing disagree on %q", k)
+				}
+			}
+			assert.Equal(t, 1, count, "Resource %q must be owned by exactly 1 node", k)
+		}
+	})
+
+	t.Run("Virtual nodes keep the split roughly even", func(t *testing.T) {
+		ring := NewHashRing([]int{0, 1, 2}, RING_VNODES)
+		counts := map[int]int{}
+		for _, k := range keys {
+			counts[ring.Owner(k)]++
+		}
+		for n := range 3 {
+			assert.InDelta(t, len(keys)/3, counts[n], float64(len(keys))*0.1,
+				"Node %d owns %d/%d resources — distribution is skewed", n, counts[n], len(keys))
+		}
+	})
+
+	t.Run("Growing 3 to 4 nodes moves far fewer keys than modulo", func(t *testing.T) {
+		three := NewHashRing([]int{0, 1, 2}, RING_VNODES)
+		four := NewHashRing([]int{0, 1, 2, 3}, RING_VNODES)
+
+		var ringMoved, moduloMoved int
+		for _, k := range keys {
+			before, after := three.Owner(k), four.Owner(k)
+			if before != after {
+				ringMoved++
+				// The only keys that move are the ones the new node takes.
+				require.Equal(t, 3, after, "%q moved between existing nodes", k)
+			}
+			if hash32(k)%3 != hash32(k)%4 {
+				moduloMoved++
+			}
+		}
+
+		ringFrac := float64(ringMoved) / float64(len(keys))
+		moduloFrac := float64(moduloMoved) / float64(len(keys))
+		t.Logf("moved on 3→4: ring %.1f%%, modulo %.1f%%", ringFrac*100, moduloFrac*100)
+
+		// Ideal is 1/4 for the ring and 3/4 for modulo.
+		assert.InDelta(t, 0.25, ringFrac, 0.08)
+		assert.Greater(t, moduloFrac, 0.6)
+	})
+
+	t.Run("Modulo stays the default", func(t *testing.T) {
+		cfg := ShardConfig{NodeIndex: 1, TotalNodes: 3}
+		owns := cfg.Owner()
+		for _, k := range keys[:200] {
+			assert.Equal(t, cfg.OwnsShard(k), owns(k))
+		}
+	})
+
+	t.Run("Empty ring has no owner", func(t *testing.T) {
+		assert.Equal(t, -1, NewHashRing(nil, RING_VNODES).Owner("x"))
+	})
+}
@@ -1,9 +1,9 @@
 package v1
 
 import (
-	"hash/fnv"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 )
 
@@ -16,19 +16,36 @@ type ShardConfig struct {
 
 	// TotalNodes is the total number of nodes in the cluster.
 	TotalNodes int
+
+	// Live lists the node indexes with a heartbeat in the registry, sorted.
+	// Empty means membership is unknown and every node is assumed alive.
+	Live []int
+
+	// Strategy is SHARD_STRATEGY_MODULO (the default, also used when empty)
+	// or SHARD_STRATEGY_RING.
+	Strategy string
 }
 
 // OwnsShard returns true if this node is responsible for the given resourceID.
 // Uses FNV-1a: deterministic, fast, no coordination needed — pure math.
+//
+// A resource whose home node is missing from Live is handed to one of the
+// live nodes instead, picked by the same hash, so a dead node's shard keeps
+// being reconciled while everyone else's resources stay where they are.
 func (cfg ShardConfig) OwnsShard(resourceID string) bool {
-	h := fnv.New32a()
-	h.Write([]byte(resourceID))
-	return h.Sum32()%uint32(cfg.TotalNodes) == uint32(cfg.NodeIndex)
+	sum := hash32(resourceID)
+
+	home := int(sum % uint32(cfg.TotalNodes))
+	if len(cfg.Live) == 0 || slices.Contains(cfg.Live, home) {
+		return home == cfg.NodeIndex
+	}
+	return cfg.Live[sum%uint32(len(cfg.Live))] == cfg.NodeIndex
 }
 
-// ParseShardConfig reads NODE_INDEX and TOTAL_NODES from the environment.
+// ParseShardConfig reads NODE_INDEX, TOTAL_NODES and SHARD_STRATEGY from the environment.
 //   - Missing / invalid NODE_INDEX → defaults to 0
 //   - Missing / invalid TOTAL_NODES → defaults to 1 (single-node: owns everything)
+//   - Missing / unknown SHARD_STRATEGY → defaults to modulo
 func ParseShardConfig() ShardConfig {
 	nodeIndex := 0
 	if v := os.Getenv("NODE_INDEX"); v != "" {
@@ -44,8 +61,52 @@ func ParseShardConfig() ShardConfig {
 		}
 	}
 
-	cfg := ShardConfig{NodeIndex: nodeIndex, TotalNodes: totalNodes}
-	log.Printf("[SHARD] Config: node %d of %d (owns ~%.0f%% of resources)",
-		nodeIndex, totalNodes, float64(100)/float64(totalNodes))
+	strategy := SHARD_STRATEGY_MODULO
+	if os.Getenv("SHARD_STRATEGY") == SHARD_STRATEGY_RING {
+		strategy = SHARD_STRATEGY_RING
+	}
+
+	cfg := ShardConfig{NodeIndex: nodeIndex, TotalNodes: totalNodes, Strategy: strategy}
+	log.Printf("[SHARD] Config: node %d of %d, %s (owns ~%.0f%% of resources)",
+		nodeIndex, totalNodes, strategy, float64(100)/float64(totalNodes))
 	return cfg
 }
+
+// ShardState is one shard's slice of the ledger, as reported by
+// GET /v1/state/shards.
+type ShardState struct {
+	Index  int            `json:"index"`
+	Live   bool           `json:"live"`
+	Owned  int            `json:"owned"`
+	States map[string]int `json:"states"`
+}
+
+// shardBreakdown assigns every resource to the shard that owns it under cfg
+// (strategy and live membership included) and counts states per shard. cfg's
+// NodeIndex is ignored: every index below TotalNodes gets an entry, so the
+// Owned counts always add up to len(resources).
+func shardBreakdown(resources []ResourceLedger, cfg ShardConfig) []ShardState {
+	shards := make([]ShardState, cfg.TotalNodes)
+	owners := make([]func(string) bool, cfg.TotalNodes)
+	for i := range shards {
+		node := cfg
+		node.NodeIndex = i
+		owners[i] = node.Owner()
+		shards[i] = ShardState{
+			Index:  i,
+			Live:   len(cfg.Live) == 0 || slices.Contains(cfg.Live, i),
+			States: map[string]int{},
+		}
+	}
+
+	for _, r := range resources {
+		for i, owns := range owners {
+			if owns(r.ID) {
+				shards[i].Owned++
+				shards[i].States[r.State.String()]++
+				break
+			}
+		}
+	}
+	return shards
+}
@@ -1,9 +1,15 @@
 package v1
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOwnsShard(t *testing.T) {
@@ -85,4 +91,84 @@ func TestParseShardConfig(t *testing.T) {
 		assert.Equal(t, 2, cfg.NodeIndex)
 		assert.Equal(t, 5, cfg.TotalNodes)
 	})
+
+	t.Run("Reads SHARD_STRATEGY, falling back to modulo", func(t *testing.T) {
+		assert.Equal(t, SHARD_STRATEGY_MODULO, ParseShardConfig().Strategy)
+
+		t.Setenv("SHARD_STRATEGY", "ring")
+		assert.Equal(t, SHARD_STRATEGY_RING, ParseShardConfig().Strategy)
+
+		t.Setenv("SHARD_STRATEGY", "bogus")
+		assert.Equal(t, SHARD_STRATEGY_MODULO, ParseShardConfig().Strategy)
+	})
+}
+
+func TestShardStateBreakdown(t *testing.T) {
+	db := setupRegistryDB(t)
+	states := []ProvisioningState{PROVISIONING, PROVISIONED, FAILED}
+	const total = 60
+	for i := range total {
+		require.NoError(t, db.Create(&ResourceLedger{ID: fmt.Sprintf("res-%d", i), State: states[i%len(states)]}).Error)
+	}
+
+	t.Run("Counts add up to the ledger", func(t *testing.T) {
+		t.Setenv("TOTAL_NODES", "3")
+		p := &Provisioner{DB: db, shard: ParseShardConfig()}
+
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/state/shards", p.shardStateHandler)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/state/shards", nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			TotalNodes int          `json:"total_nodes"`
+			Total      int          `json:"total"`
+			Shards     []ShardState `json:"shards"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 3, resp.TotalNodes)
+		assert.Equal(t, total, resp.Total)
+		require.Len(t, resp.Shards, 3)
+
+		owned, byState := 0, map[string]int{}
+		for i, s := range resp.Shards {
+			assert.Equal(t, i, s.Index)
+			assert.Positive(t, s.Owned, "shard %d owns nothing", i)
+			owned += s.Owned
+			stateSum := 0
+			for state, n := range s.States {
+				byState[state] += n
+				stateSum += n
+			}
+			assert.Equal(t, s.Owned, stateSum, "shard %d states do not add up", i)
+		}
+		assert.Equal(t, total, owned)
+		assert.Equal(t, map[string]int{"PROVISIONING": 20, "PROVISIONED": 20, "FAILED": 20}, byState)
+	})
+
+	t.Run("Matches OwnsShard and follows live nodes", func(t *testing.T) {
+		var resources []ResourceLedger
+		require.NoError(t, db.Find(&resources).Error)
+
+		all := shardBreakdown(resources, ShardConfig{TotalNodes: 3})
+		for i, s := range all {
+			cfg := ShardConfig{NodeIndex: i, TotalNodes: 3}
+			want := 0
+			for _, r := range resources {
+				if cfg.OwnsShard(r.ID) {
+					want++
+				}
+			}
+			assert.Equal(t, want, s.Owned, "shard %d", i)
+		}
+
+		// With node 2 dead its resources move to 0 and 1.
+		live := shardBreakdown(resources, ShardConfig{TotalNodes: 3, Live: []int{0, 1}})
+		assert.False(t, live[2].Live)
+		assert.Zero(t, live[2].Owned)
+		assert.Equal(t, len(resources), live[0].Owned+live[1].Owned)
+	})
 }
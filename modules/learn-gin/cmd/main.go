@@ -2,19 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"learn-gin/db"
+	"learn-gin/metrics"
 	v1 "learn-gin/routes/v1"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DEFAULT_PORT = "8081"
+
+	// Timeouts that stop a slow or idle client (slowloris) from holding a
+	// connection, and a goroutine, open indefinitely.
+	READ_HEADER_TIMEOUT = 5 * time.Second
+	READ_TIMEOUT        = 10 * time.Second
+	WRITE_TIMEOUT       = 10 * time.Second
+	IDLE_TIMEOUT        = 60 * time.Second
+
+	// SHUTDOWN_TIMEOUT is how long in-flight requests get to finish.
+	SHUTDOWN_TIMEOUT = 10 * time.Second
 )
 
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	router := gin.Default()
 
@@ -23,26 +43,69 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Registered first so the middleware wraps every v1 route.
+	metrics.Register(router, prometheus.NewRegistry())
+
 	if err := v1.SetupV1Routes(router, db); err != nil {
 		log.Fatal(err)
 	}
 
-	server := &http.Server{
-		Addr:    ":8081",
-		Handler: router.Handler(),
+	server := newServer(router.Handler())
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	if err := serve(ctx, server, ln); err != nil {
+		log.Println("error in shutting down", err.Error())
+	}
+
+	log.Println("exiting service")
+}
+
+// newServer builds the http.Server for handler, listening on PORT (default
+// DEFAULT_PORT) with every timeout set.
+func newServer(handler http.Handler) *http.Server {
+	port := DEFAULT_PORT
+	if p := os.Getenv("PORT"); p != "" {
+		port = p
+	}
+
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: READ_HEADER_TIMEOUT,
+		ReadTimeout:       READ_TIMEOUT,
+		WriteTimeout:      WRITE_TIMEOUT,
+		IdleTimeout:       IDLE_TIMEOUT,
+	}
+}
+
+// serve runs server on ln until ctx is done, then shuts it down gracefully.
+// Shutdown gets its own SHUTDOWN_TIMEOUT context: ctx is already cancelled by
+// then, and handing it to Shutdown would return at once without waiting for
+// in-flight requests.
+func serve(ctx context.Context, server *http.Server, ln net.Listener) error {
+	errCh := make(chan error, 1)
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
-			log.Printf("error : listen: %s\n", err)
-		}
+		log.Printf("listening on %s", ln.Addr())
+		errCh <- server.Serve(ln)
 	}()
 
-	<-ctx.Done()
-	log.Println("Shutting down server")
-	if err := server.Shutdown(ctx); err != nil {
-		log.Println("error in shutting down", err.Error())
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
 	}
 
-	log.Println("exiting service")
+	log.Println("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
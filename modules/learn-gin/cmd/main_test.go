@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		port     string
+		wantAddr string
+	}{
+		{"default port", "", ":" + DEFAULT_PORT},
+		{"PORT from env", "9090", ":9090"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PORT", tt.port)
+			s := newServer(http.NotFoundHandler())
+
+			if s.Addr != tt.wantAddr {
+				t.Errorf("Addr = %q, want %q", s.Addr, tt.wantAddr)
+			}
+			timeouts := map[string][2]time.Duration{
+				"ReadHeaderTimeout": {s.ReadHeaderTimeout, READ_HEADER_TIMEOUT},
+				"ReadTimeout":       {s.ReadTimeout, READ_TIMEOUT},
+				"WriteTimeout":      {s.WriteTimeout, WRITE_TIMEOUT},
+				"IdleTimeout":       {s.IdleTimeout, IDLE_TIMEOUT},
+			}
+			for name, d := range timeouts {
+				if d[0] == 0 || d[0] != d[1] {
+					t.Errorf("%s = %v, want %v", name, d[0], d[1])
+				}
+			}
+		})
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, newServer(handler), ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{string(body), err}
+	}()
+
+	// Signal shutdown while the request is still being handled.
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serve = %v, want a clean shutdown", err)
+		}
+	case <-time.After(SHUTDOWN_TIMEOUT):
+		t.Fatal("shutdown did not complete")
+	}
+
+	if r := <-inFlight; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request = %q, %v; want it to finish during shutdown", r.body, r.err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Error("server still accepting after shutdown")
+	}
+}
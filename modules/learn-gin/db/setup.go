@@ -2,15 +2,45 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+const (
+	DB_PATH = "test.db"
+
+	// BUSY_TIMEOUT_MS is how long a writer waits on a locked database before
+	// SQLite gives up with "database is locked".
+	BUSY_TIMEOUT_MS   = 5000
+	MAX_OPEN_CONNS    = 10
+	CONN_MAX_LIFETIME = 30 * time.Minute
+)
+
 func SetupDB() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	return openDB(DB_PATH)
+}
+
+// openDB opens the SQLite file at path tuned for concurrent use: WAL lets
+// readers run alongside the single writer, the busy timeout makes writers
+// queue instead of failing, and _txlock=immediate takes the write lock at
+// BEGIN so two transactions cannot deadlock upgrading from a read lock.
+func openDB(path string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, BUSY_TIMEOUT_MS)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		// Surface unique-constraint failures as gorm.ErrDuplicatedKey.
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database %w", err)
 	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(MAX_OPEN_CONNS)
+	sqlDB.SetConnMaxLifetime(CONN_MAX_LIFETIME)
 	return db, nil
 }
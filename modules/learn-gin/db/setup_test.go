@@ -0,0 +1,63 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type counter struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func TestOpenDBConcurrentWrites(t *testing.T) {
+	db, err := openDB(filepath.Join(t.TempDir(), "concurrent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&counter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mode string
+	if err := db.Raw("PRAGMA journal_mode").Scan(&mode).Error; err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want %q", mode, "wal")
+	}
+	var timeout int
+	if err := db.Raw("PRAGMA busy_timeout").Scan(&timeout).Error; err != nil {
+		t.Fatal(err)
+	}
+	if timeout != BUSY_TIMEOUT_MS {
+		t.Errorf("busy_timeout = %d, want %d", timeout, BUSY_TIMEOUT_MS)
+	}
+
+	const writers = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Create(&counter{Name: fmt.Sprintf("w%d", i)}).Error
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	}
+
+	var n int64
+	db.Model(&counter{}).Count(&n)
+	if n != writers {
+		t.Errorf("rows = %d, want %d", n, writers)
+	}
+}
@@ -0,0 +1,81 @@
+// Package metrics records per-route request counts, in-flight requests and
+// latency for the gin server and exposes them in Prometheus format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// UNMATCHED_ROUTE labels requests no route matched, so 404 probes for
+// arbitrary paths cannot blow up the label cardinality.
+const UNMATCHED_ROUTE = "unmatched"
+
+// HTTPMetrics holds the collectors behind Middleware.
+type HTTPMetrics struct {
+	requests *prometheus.CounterVec
+	inFlight prometheus.Gauge
+	latency  *prometheus.HistogramVec
+}
+
+// New creates the collectors and registers them with reg. Tests pass their
+// own prometheus.NewRegistry(); the server shares one registry between this
+// and the /metrics handler.
+func New(reg prometheus.Registerer) *HTTPMetrics {
+	m := &HTTPMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being handled.",
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+	}
+	reg.MustRegister(m.requests, m.inFlight, m.latency)
+	return m
+}
+
+// Middleware records every request that passes through it. The route label
+// is the registered pattern (/v1/user/:id), never the raw path.
+func (m *HTTPMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = UNMATCHED_ROUTE
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.requests.WithLabelValues(route, c.Request.Method, status).Inc()
+		m.latency.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves everything gathered from g in the Prometheus text format.
+func Handler(g prometheus.Gatherer) gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
+}
+
+// Register installs Middleware on every route added to router after it and
+// serves reg at GET /metrics, outside any versioned group. Call it before the
+// routes it should measure.
+func Register(router *gin.Engine, reg *prometheus.Registry) *HTTPMetrics {
+	m := New(reg)
+	router.Use(m.Middleware())
+	router.GET("/metrics", Handler(reg))
+	return m
+}
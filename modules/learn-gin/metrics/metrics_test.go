@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddlewareRecordsRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	router := gin.New()
+	m := Register(router, reg)
+	router.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/users", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+
+	do := func(method, path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		do(http.MethodGet, "/users/"+id)
+	}
+	do(http.MethodPost, "/users")
+	do(http.MethodGet, "/nope/1")
+	do(http.MethodGet, "/nope/2")
+
+	tests := map[string]struct {
+		labels []string
+		want   float64
+	}{
+		"templated route":   {[]string{"/users/:id", "GET", "200"}, 3},
+		"error status":      {[]string{"/users", "POST", "400"}, 1},
+		"unmatched grouped": {[]string{UNMATCHED_ROUTE, "GET", "404"}, 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := testutil.ToFloat64(m.requests.WithLabelValues(tt.labels...)); got != tt.want {
+				t.Errorf("http_requests_total%v = %v, want %v", tt.labels, got, tt.want)
+			}
+		})
+	}
+
+	// Only the three label sets above exist: 404s for different paths share
+	// one series.
+	if n := testutil.CollectAndCount(m.requests); n != 3 {
+		t.Errorf("request series = %d, want 3", n)
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP http_requests_in_flight HTTP requests currently being handled.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 0
+`), "http_requests_in_flight"); err != nil {
+		t.Error(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var observations uint64
+	for _, f := range families {
+		if f.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			observations += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if observations != 6 {
+		t.Errorf("latency observations = %d, want 6", observations)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `http_requests_total{method="GET",route="/users/:id",status="200"} 3`) {
+		t.Errorf("/metrics = %d:\n%s", w.Code, w.Body.String())
+	}
+}
@@ -2,19 +2,87 @@ package v1
 
 import (
 	"log"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
 	"time"
 
+	"shared/bodylimit"
+	"shared/ratelimit"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	REQUEST_ID_KEY    = "request_id"
 )
 
+// RequestIDMiddleware tags each request with a correlation ID: the caller's
+// X-Request-ID when it sent one, otherwise a fresh UUID. The ID is stored in
+// the gin context for RequestIDFromCtx and echoed in the response header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(REQUEST_ID_HEADER)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		c.Set(REQUEST_ID_KEY, id)
+		c.Header(REQUEST_ID_HEADER, id)
+		c.Next()
+	}
+}
+
+// RequestIDFromCtx returns the ID set by RequestIDMiddleware, or "" when the
+// middleware did not run.
+func RequestIDFromCtx(c *gin.Context) string {
+	return c.GetString(REQUEST_ID_KEY)
+}
+
+// RecoveryMiddleware answers a panicking handler with a 500 JSON error and
+// logs the stack under the request's ID, so it goes right after
+// RequestIDMiddleware. A partly written response is left as it is, and
+// http.ErrAbortHandler is passed on to net/http.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			log.Printf("panic serving %s %s request_id=%s: %v\n%s", c.Request.Method, c.Request.URL.Path, RequestIDFromCtx(c), r, debug.Stack())
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}()
+		c.Next()
+	}
+}
+
+// BodyLimitMiddleware puts every v1 request body behind bodylimit.Wrap;
+// createUser turns a bind that ran past maxBytes into a 413.
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bodylimit.Wrap(c.Writer, c.Request, maxBytes)
+		c.Next()
+	}
+}
+
 func loggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Logic before the handler (e.g., log start time, IP)
-		log.Printf("Request received: %s %s", c.Request.Method, c.Request.URL.Path)
+		log.Printf("Request received: %s %s request_id=%s", c.Request.Method, c.Request.URL.Path, RequestIDFromCtx(c))
 		c.Next() // Pass control to the next middleware or handler
 		// Logic after the handler (e.g., log response time, status)
-		log.Printf("Request finished: %s %s", c.Request.Method, c.Request.URL.Path)
+		log.Printf("Request finished: %s %s request_id=%s", c.Request.Method, c.Request.URL.Path, RequestIDFromCtx(c))
 	}
 }
 
@@ -52,34 +120,88 @@ func MaxConcurrentMiddleware(admissionTokens int) gin.HandlerFunc {
 	}
 }
 
-func RateLimiterMiddleware(requestPerSecond int, rate time.Duration) gin.HandlerFunc {
-	rateLimiter := make(chan struct{}, requestPerSecond)
+// RateLimiterMiddleware is the global limiter shared by every client: a single
+// token bucket refilling at rate tokens per second up to burst. Rejected
+// requests get 429 with a Retry-After header in whole seconds.
+func RateLimiterMiddleware(rate float64, burst int) gin.HandlerFunc {
+	bucket := ratelimit.NewTokenBucket(rate, burst)
 
-	// Fill the bucket with initial tokens
-	for range requestPerSecond {
-		rateLimiter <- struct{}{}
+	return func(c *gin.Context) {
+		ok, wait := bucket.AllowAt(time.Now())
+		if !ok {
+			tooManyRequests(c, wait)
+			return
+		}
+		c.Next()
 	}
+}
 
-	go func() {
-		t := time.NewTicker(rate)
-		defer t.Stop()
-		for range t.C {
-			for range requestPerSecond {
-				select {
-				case rateLimiter <- struct{}{}:
-				default:
-					goto nextTick
-				}
-			}
-		nextTick:
+func tooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatus(http.StatusTooManyRequests)
+}
+
+// perIPLimiter keeps one token bucket per client IP. Buckets refill at rate
+// tokens per second up to burst, and buckets idle for longer than idleTTL are
+// swept on the next request after that, so the map does not grow forever.
+type perIPLimiter struct {
+	rate    float64
+	burst   int
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*ratelimit.TokenBucket
+	lastSweep time.Time
+}
+
+func newPerIPLimiter(rate float64, burst int, idleTTL time.Duration) *perIPLimiter {
+	return &perIPLimiter{
+		rate:      rate,
+		burst:     burst,
+		idleTTL:   idleTTL,
+		buckets:   make(map[string]*ratelimit.TokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from ip's bucket. When the bucket is empty it reports
+// how long until the next token is available.
+func (l *perIPLimiter) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= l.idleTTL {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = ratelimit.NewTokenBucket(l.rate, l.burst)
+		l.buckets[ip] = b
+	}
+	return b.AllowAt(now)
+}
+
+func (l *perIPLimiter) sweep(now time.Time) {
+	for ip, b := range l.buckets {
+		if now.Sub(b.LastUsed()) >= l.idleTTL {
+			delete(l.buckets, ip)
 		}
-	}()
+	}
+	l.lastSweep = now
+}
+
+// PerIPRateLimiter throttles each client IP on its own, so one noisy client
+// cannot use up the shared RateLimiterMiddleware tokens. Rejected requests get
+// 429 with a Retry-After header in whole seconds.
+func PerIPRateLimiter(rate float64, burst int, idleTTL time.Duration) gin.HandlerFunc {
+	limiter := newPerIPLimiter(rate, burst, idleTTL)
 	return func(c *gin.Context) {
-		select {
-		case <-rateLimiter:
-			c.Next()
-		default:
-			c.AbortWithStatus(http.StatusTooManyRequests)
+		ok, wait := limiter.allow(c.ClientIP(), time.Now())
+		if !ok {
+			tooManyRequests(c, wait)
+			return
 		}
+		c.Next()
 	}
 }
@@ -0,0 +1,188 @@
+package v1
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestPerIPRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(PerIPRateLimiter(0.5, 2, time.Minute))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := range 2 {
+		if w := get("10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+
+	w := get("10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	if w := get("10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("other IP: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestPerIPLimiterRefillAndSweep(t *testing.T) {
+	l := newPerIPLimiter(1, 1, time.Minute)
+	now := time.Now()
+
+	if ok, _ := l.allow("a", now); !ok {
+		t.Fatal("first request rejected")
+	}
+	ok, wait := l.allow("a", now)
+	if ok || wait != time.Second {
+		t.Fatalf("allow = %v, %v; want false, 1s", ok, wait)
+	}
+	if ok, _ := l.allow("a", now.Add(time.Second)); !ok {
+		t.Error("request after refill rejected")
+	}
+
+	// a has been idle for over a minute when b arrives, so b's request sweeps it.
+	l.allow("b", now.Add(90*time.Second))
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("idle bucket a was not swept")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Error("active bucket b was swept")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimiterMiddleware(0.25, 3))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := range 3 {
+		if w := get("10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+
+	// The bucket is shared, so a different client is throttled as well.
+	w := get("10.0.0.2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "4" {
+		t.Errorf("Retry-After = %q, want %q", got, "4")
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), loggerMiddleware())
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, RequestIDFromCtx(c)) })
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	tests := []struct {
+		name    string
+		inbound string
+	}{
+		{name: "inbound ID is echoed", inbound: "client-req-42"},
+		{name: "missing ID is generated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inbound != "" {
+				req.Header.Set(REQUEST_ID_HEADER, tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(REQUEST_ID_HEADER)
+			if tt.inbound != "" && id != tt.inbound {
+				t.Errorf("%s = %q, want %q", REQUEST_ID_HEADER, id, tt.inbound)
+			}
+			if tt.inbound == "" {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("%s = %q, want a UUID: %v", REQUEST_ID_HEADER, id, err)
+				}
+			}
+			if got := w.Body.String(); got != id {
+				t.Errorf("RequestIDFromCtx = %q, want %q", got, id)
+			}
+			if n := strings.Count(logs.String(), "request_id="+id); n != 2 {
+				t.Errorf("request_id logged %d times, want 2:\n%s", n, logs.String())
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), RecoveryMiddleware())
+	router.GET("/boom", func(c *gin.Context) { panic("boom") })
+	router.GET("/partial", func(c *gin.Context) {
+		c.String(http.StatusOK, "half")
+		panic("too late")
+	})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	req := httptest.NewRequest(http.MethodGet, "/boom", nil)
+	req.Header.Set(REQUEST_ID_HEADER, "req-panic")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if got, want := w.Body.String(), `{"error":"internal server error"}`; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+	for _, want := range []string{"request_id=req-panic", "boom", "runtime/debug.Stack"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log is missing %q:\n%s", want, logs.String())
+		}
+	}
+
+	// Once the handler has written, the response is left as it was.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "half" {
+		t.Errorf("got %d %q, want the handler's partial response", w.Code, w.Body.String())
+	}
+}
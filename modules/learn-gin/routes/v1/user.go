@@ -1,25 +1,47 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"shared/bodylimit"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 const (
 	MAX_CONCURRENT_REQUESTS = 10
-	MAX_REQUEST_PER_SEC     = 10
-	RATE                    = 1 * time.Second
+	MAX_REQUEST_PER_SEC     = 10 // tokens per second, shared by all clients
+	MAX_REQUEST_BURST       = 10
+
+	PER_IP_RATE     = 5 // tokens per second
+	PER_IP_BURST    = 10
+	PER_IP_IDLE_TTL = 5 * time.Minute
+
+	DEFAULT_PAGE_LIMIT = 20
+	MAX_PAGE_LIMIT     = 100
 )
 
 type User struct {
-	Name      string    `json:"name,omitempty" binding:"required"`
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name,omitempty" binding:"required" gorm:"uniqueIndex;not null"`
+	Email     string    `json:"email,omitempty" binding:"required,email" gorm:"uniqueIndex;not null"`
 	CreatedAt time.Time `json:"created_at,omitzero"`
 }
 
+// UserPage is the envelope returned by GET /v1/users. Total counts every
+// user, not just the ones on this page.
+type UserPage struct {
+	Users  []User `json:"users"`
+	Total  int64  `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
 type UserHandler struct {
 	db *gorm.DB
 }
@@ -37,12 +59,19 @@ func setupUserHandler(v1 *gin.RouterGroup, db *gorm.DB) error {
 
 	userHandler := newUserHandler(db)
 
+	v1.Use(RequestIDMiddleware())
+	v1.Use(RecoveryMiddleware())
 	v1.Use(loggerMiddleware())
 	v1.Use(AuthMiddleware())
-	v1.Use(RateLimiterMiddleware(MAX_REQUEST_PER_SEC, RATE))
+	v1.Use(PerIPRateLimiter(PER_IP_RATE, PER_IP_BURST, PER_IP_IDLE_TTL))
+	v1.Use(RateLimiterMiddleware(MAX_REQUEST_PER_SEC, MAX_REQUEST_BURST))
 	v1.Use(MaxConcurrentMiddleware(MAX_CONCURRENT_REQUESTS))
+	// MAX_BODY_BYTES overrides the default 1 MiB cap on request bodies.
+	v1.Use(BodyLimitMiddleware(bodylimit.FromEnv("MAX_BODY_BYTES")))
 	{
+		v1.GET("/users", userHandler.listUsers)
 		v1.GET("/user/:id", userHandler.getUserByID)
+		v1.GET("/user/by-name/:name", userHandler.getUserByName)
 		v1.POST("/user", userHandler.createUser)
 	}
 
@@ -50,33 +79,108 @@ func setupUserHandler(v1 *gin.RouterGroup, db *gorm.DB) error {
 }
 
 func (h *UserHandler) getUserByID(c *gin.Context) {
-	id := c.Param("id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a positive integer"})
+		return
+	}
+
+	h.findUser(c, h.db.Where("id = ?", id))
+}
+
+func (h *UserHandler) getUserByName(c *gin.Context) {
+	h.findUser(c, h.db.Where("name = ?", c.Param("name")))
+}
 
+// findUser writes the first user matched by query, or 404 if there is none.
+func (h *UserHandler) findUser(c *gin.Context, query *gorm.DB) {
 	var user User
-	if err := h.db.Where("name = ?", id).First(&user).Error; err != nil {
+	err := query.First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, user)
 }
 
+func (h *UserHandler) listUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DEFAULT_PAGE_LIMIT)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	limit = min(limit, MAX_PAGE_LIMIT)
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	page := UserPage{Users: []User{}, Limit: limit, Offset: offset}
+	if err := h.db.Model(&User{}).Count(&page.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.Order("created_at, id").Limit(limit).Offset(offset).Find(&page.Users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
 func (h *UserHandler) createUser(c *gin.Context) {
 	var user User
 	if err := c.ShouldBindBodyWithJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if bodylimit.IsTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user: " + err.Error()})
 		return
 	}
 
 	user.CreatedAt = time.Now()
 
+	// Creating an existing name is a no-op: FirstOrCreate loads the stored row
+	// instead, so the original CreatedAt is kept. Two requests for the same new
+	// name can both miss in First and race to Create; the loser trips the
+	// unique index on name and gets the winner's row, same as if it had come
+	// second. A new name with an email that is already taken trips the unique
+	// index on email.
 	tx := h.db.FirstOrCreate(&user, User{Name: user.Name})
+	if errors.Is(tx.Error, gorm.ErrDuplicatedKey) {
+		var existing User
+		err := h.db.Where("name = ?", user.Name).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, existing)
+		return
+	}
 	if tx.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": tx.Error.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": tx.Error.Error()})
+		return
+	}
+
+	if tx.RowsAffected == 0 {
+		c.JSON(http.StatusOK, user)
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.Header("Location", fmt.Sprintf("/v1/user/%d", user.ID))
+	c.JSON(http.StatusCreated, user)
 }
 
 // func CountWordFrequency(text string) map[string]int {
@@ -0,0 +1,339 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestRouter wires the v1 routes against a fresh in-memory database.
+func newTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	// Every connection to ":memory:" is its own database, so pin it to one.
+	return newTestRouterDSN(t, ":memory:", 1)
+}
+
+// newTestRouterDSN wires the v1 routes against dsn with up to maxConns open
+// connections. Tests that need requests to really overlap in SQLite use a
+// temp file and several connections.
+func newTestRouterDSN(t *testing.T, dsn string, maxConns int) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(maxConns)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	router := gin.New()
+	if err := SetupV1Routes(router, db); err != nil {
+		t.Fatal(err)
+	}
+	return router, db
+}
+
+func doRequest(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-Auth-Token", "secret")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateUser(t *testing.T) {
+	router, db := newTestRouter(t)
+
+	w := doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+
+	var created User
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Name != "alice" || created.Email != "alice@example.com" || created.CreatedAt.IsZero() {
+		t.Errorf("body = %+v, want alice with an ID and CreatedAt", created)
+	}
+	if got, want := w.Header().Get("Location"), fmt.Sprintf("/v1/user/%d", created.ID); got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+
+	var user User
+	if err := db.First(&user, created.ID).Error; err != nil {
+		t.Fatalf("user not persisted: %v", err)
+	}
+	if user.Name != "alice" || user.Email != "alice@example.com" || user.CreatedAt.IsZero() {
+		t.Errorf("stored %+v, want alice with a CreatedAt", user)
+	}
+}
+
+func TestCreateUserDuplicate(t *testing.T) {
+	router, db := newTestRouter(t)
+
+	w := doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+	var first User
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatal(err)
+	}
+
+	w = doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var again User
+	if err := json.Unmarshal(w.Body.Bytes(), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID || !again.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("got %+v, want the existing user %+v", again, first)
+	}
+
+	var count int64
+	if err := db.Model(&User{}).Where("name = ?", "alice").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d rows for alice, want 1", count)
+	}
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+	w := doRequest(router, http.MethodPost, "/v1/user", `{"name":"bob","email":"alice@example.com"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "email already registered") {
+		t.Errorf("body = %s, want the duplicate email message", w.Body)
+	}
+}
+
+func TestCreateUserConcurrentSameName(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "users.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+	router, db := newTestRouterDSN(t, dsn, MAX_CONCURRENT_REQUESTS)
+
+	// Stay within the per-IP burst and the concurrency cap so every request
+	// reaches the handler.
+	const workers = PER_IP_BURST - 2
+	codes := make([]int, workers)
+	bodies := make([]User, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			w := doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+			codes[i] = w.Code
+			json.Unmarshal(w.Body.Bytes(), &bodies[i])
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for i, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusOK:
+		default:
+			t.Errorf("request %d: status = %d, want 201 or 200", i, code)
+		}
+	}
+	if created != 1 {
+		t.Errorf("got %d 201 responses, want 1 (codes %v)", created, codes)
+	}
+	for i, u := range bodies {
+		if u.ID != bodies[0].ID {
+			t.Errorf("request %d returned user %d, want %d", i, u.ID, bodies[0].ID)
+		}
+	}
+
+	var count int64
+	if err := db.Model(&User{}).Where("name = ?", "alice").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d rows for alice, want 1", count)
+	}
+}
+
+func TestCreateUserBodyTooLarge(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "64")
+	router, db := newTestRouter(t)
+
+	body := fmt.Sprintf(`{"name":%q,"email":"alice@example.com"}`, strings.Repeat("a", 128))
+	w := doRequest(router, http.MethodPost, "/v1/user", body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body)
+	}
+
+	var count int64
+	if err := db.Model(&User{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("got %d users, want none stored", count)
+	}
+
+	// A body under the limit still goes through.
+	if w := doRequest(router, http.MethodPost, "/v1/user", `{"name":"al","email":"al@example.com"}`); w.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+}
+
+func TestCreateUserInvalidBody(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing name", `{"email":"alice@example.com"}`},
+		{"missing email", `{"name":"alice"}`},
+		{"malformed email", `{"name":"alice","email":"not-an-email"}`},
+		{"malformed json", `{"name":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doRequest(router, http.MethodPost, "/v1/user", tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	router, db := newTestRouter(t)
+	doRequest(router, http.MethodPost, "/v1/user", `{"name":"alice","email":"alice@example.com"}`)
+
+	var alice User
+	if err := db.Where("name = ?", "alice").First(&alice).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{"by id", fmt.Sprintf("/v1/user/%d", alice.ID), http.StatusOK},
+		{"missing id", fmt.Sprintf("/v1/user/%d", alice.ID+1), http.StatusNotFound},
+		{"non-numeric id", "/v1/user/alice", http.StatusBadRequest},
+		{"negative id", "/v1/user/-1", http.StatusBadRequest},
+		{"by name", "/v1/user/by-name/alice", http.StatusOK},
+		{"missing name", "/v1/user/by-name/bob", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(router, http.MethodGet, tt.path, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var user User
+			if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != alice.ID || user.Name != "alice" || user.CreatedAt.IsZero() {
+				t.Errorf("got %+v, want %+v", user, alice)
+			}
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	router, db := newTestRouter(t)
+
+	base := time.Now()
+	for i, name := range []string{"u0", "u1", "u2", "u3", "u4"} {
+		user := User{Name: name, Email: name + "@example.com", CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+		wantLimit int
+	}{
+		{"default page", "", []string{"u0", "u1", "u2", "u3", "u4"}, DEFAULT_PAGE_LIMIT},
+		{"first page", "?limit=2", []string{"u0", "u1"}, 2},
+		{"middle page", "?limit=2&offset=2", []string{"u2", "u3"}, 2},
+		{"last partial page", "?limit=2&offset=4", []string{"u4"}, 2},
+		{"past the end", "?limit=2&offset=10", []string{}, 2},
+		{"limit clamped", "?limit=100000", []string{"u0", "u1", "u2", "u3", "u4"}, MAX_PAGE_LIMIT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(router, http.MethodGet, "/v1/users"+tt.query, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+
+			var page UserPage
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != 5 {
+				t.Errorf("total = %d, want 5", page.Total)
+			}
+			if page.Limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", page.Limit, tt.wantLimit)
+			}
+
+			names := make([]string, len(page.Users))
+			for i, u := range page.Users {
+				names[i] = u.Name
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("users = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestListUsersInvalidQuery(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, query := range []string{"?limit=0", "?limit=-1", "?limit=abc", "?offset=-1", "?offset=abc"} {
+		t.Run(query, func(t *testing.T) {
+			if w := doRequest(router, http.MethodGet, "/v1/users"+query, ""); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// Reconnect backoff: the wait between dial attempts grows from
+	// BackoffBaseDelay by BackoffMultiplier up to BackoffMaxDelay, each
+	// randomized by ±BackoffJitter so clients do not redial in lockstep.
+	BackoffBaseDelay  = 500 * time.Millisecond
+	BackoffMultiplier = 1.6
+	BackoffJitter     = 0.2
+	BackoffMaxDelay   = 10 * time.Second
+	ConnectTimeout    = 5 * time.Second
+
+	// Keepalive pings an idle-but-open stream so a dead peer is noticed within
+	// KeepaliveTime+KeepaliveTimeout instead of at the next write. The server
+	// must allow pings this often (see its keepalive.EnforcementPolicy).
+	KeepaliveTime    = 30 * time.Second
+	KeepaliveTimeout = 10 * time.Second
+)
+
+// ClientConfig is how the client dials and keeps its connection to the server.
+type ClientConfig struct {
+	Addr string
+
+	BackoffBaseDelay  time.Duration
+	BackoffMultiplier float64
+	BackoffJitter     float64
+	BackoffMaxDelay   time.Duration
+	// ConnectTimeout is the least time one dial attempt is given.
+	ConnectTimeout time.Duration
+
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	// WaitForReady makes calls wait, up to their deadline, for the connection
+	// to come back instead of failing at once while it is reconnecting.
+	WaitForReady bool
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Addr:              ClientAddr,
+		BackoffBaseDelay:  BackoffBaseDelay,
+		BackoffMultiplier: BackoffMultiplier,
+		BackoffJitter:     BackoffJitter,
+		BackoffMaxDelay:   BackoffMaxDelay,
+		ConnectTimeout:    ConnectTimeout,
+		KeepaliveTime:     KeepaliveTime,
+		KeepaliveTimeout:  KeepaliveTimeout,
+		WaitForReady:      true,
+	}
+}
+
+// DialOptions turns cfg into grpc dial options, including the request-ID
+// interceptors every connection from this client uses.
+func (cfg ClientConfig) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  cfg.BackoffBaseDelay,
+				Multiplier: cfg.BackoffMultiplier,
+				Jitter:     cfg.BackoffJitter,
+				MaxDelay:   cfg.BackoffMaxDelay,
+			},
+			MinConnectTimeout: cfg.ConnectTimeout,
+		}),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(cfg.WaitForReady)),
+		grpc.WithChainUnaryInterceptor(RequestIDUnaryInterceptor),
+		grpc.WithChainStreamInterceptor(RequestIDStreamInterceptor),
+	}
+}
+
+// NewClientConn creates the (lazily connecting) client connection for cfg.
+func NewClientConn(cfg ClientConfig) (*grpc.ClientConn, error) {
+	return grpc.NewClient(cfg.Addr, cfg.DialOptions()...)
+}
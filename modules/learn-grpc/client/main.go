@@ -10,9 +10,10 @@ import (
 
 	pb "learn-grpc/proto"
 
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
@@ -35,9 +36,55 @@ func setupMetadata(ctx context.Context) context.Context {
 	return ctx
 }
 
+// withRequestID makes sure the outgoing metadata carries an x-request-id,
+// minting one only when the caller has not already set it. Generating it on
+// the client means the same ID shows up in client and server logs.
+func withRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if ids := md.Get(string(RequestIDKey)); len(ids) > 0 && ids[0] != "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, string(RequestIDKey), uuid.New().String())
+}
+
+// RequestIDUnaryInterceptor stamps every unary call with a request ID.
+func RequestIDUnaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	return invoker(withRequestID(ctx), method, req, reply, cc, opts...)
+}
+
+// RequestIDStreamInterceptor stamps every stream with a request ID when it is opened.
+func RequestIDStreamInterceptor(
+	ctx context.Context,
+	desc *grpc.StreamDesc,
+	cc *grpc.ClientConn,
+	method string,
+	streamer grpc.Streamer,
+	opts ...grpc.CallOption,
+) (grpc.ClientStream, error) {
+	return streamer(withRequestID(ctx), desc, cc, method, opts...)
+}
+
+// errorReason returns the ErrorInfo reason the server attached to err, or ""
+// if there is none.
+func errorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
+
 func main() {
 	// Set up a connection to the server.
-	conn, err := grpc.NewClient(ClientAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := NewClientConn(DefaultClientConfig())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -55,7 +102,7 @@ func main() {
 		if status.Code(err) == codes.DeadlineExceeded {
 			log.Printf("deadline exceeded during SayHello: %s", err.Error())
 		} else {
-			log.Fatalf("could not greet: %s", err.Error())
+			log.Fatalf("could not greet (reason %q): %s", errorReason(err), err.Error())
 		}
 	}
 	log.Printf("Greeting: %s", r.GetMessage())
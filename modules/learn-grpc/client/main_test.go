@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "learn-grpc/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDUnaryInterceptor(t *testing.T) {
+	// sentID captures the x-request-id the interceptor hands to the transport.
+	sentID := func(ctx context.Context) []string {
+		var got []string
+		invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			got = md.Get(string(RequestIDKey))
+			return nil
+		}
+		if err := RequestIDUnaryInterceptor(ctx, "/Greeter/SayHello", nil, nil, nil, invoker); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("mints an ID when absent", func(t *testing.T) {
+		ids := sentID(setupMetadata(context.Background()))
+		if len(ids) != 1 || ids[0] == "" {
+			t.Fatalf("x-request-id = %q, want one generated ID", ids)
+		}
+		if other := sentID(context.Background()); other[0] == ids[0] {
+			t.Errorf("two calls shared request ID %q", ids[0])
+		}
+	})
+
+	t.Run("keeps a caller-supplied ID", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), string(RequestIDKey), "req-123")
+		if ids := sentID(ctx); len(ids) != 1 || ids[0] != "req-123" {
+			t.Errorf("x-request-id = %q, want [req-123]", ids)
+		}
+	})
+}
+
+type greeter struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (greeter) SayHello(_ context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return &pb.HelloReply{Message: "Hello " + req.GetName()}, nil
+}
+
+func TestClientReconnectsToLateServer(t *testing.T) {
+	// Reserve a free port, then leave it closed so the first dials fail.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	cfg := DefaultClientConfig()
+	cfg.Addr = addr
+	cfg.BackoffBaseDelay = 20 * time.Millisecond
+	cfg.BackoffMaxDelay = 100 * time.Millisecond
+	cfg.ConnectTimeout = 100 * time.Millisecond
+
+	conn, err := NewClientConn(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, greeter{})
+	defer s.Stop()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("server could not listen on %s: %v", addr, err)
+			return
+		}
+		s.Serve(lis)
+	}()
+
+	// The call starts while the server is still down and waits for a
+	// reconnect attempt to land instead of failing with Unavailable.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	reply, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "Gopher"})
+	if err != nil {
+		t.Fatalf("SayHello failed: %v", err)
+	}
+	if reply.GetMessage() != "Hello Gopher" {
+		t.Errorf("reply = %q, want %q", reply.GetMessage(), "Hello Gopher")
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("call returned after %v, before the server was up", elapsed)
+	}
+}
@@ -68,8 +68,14 @@ func (x *Version) GetVersion() string {
 
 // The request message containing the user's name.
 type HelloRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Number of replies StreamHello sends. 0 means the server default; the
+	// server clamps larger values.
+	Count int32 `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	// Milliseconds between StreamHello replies. 0 means the server default; the
+	// server raises smaller values to its minimum.
+	IntervalMs    int32 `protobuf:"varint,3,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -111,6 +117,20 @@ func (x *HelloRequest) GetName() string {
 	return ""
 }
 
+func (x *HelloRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *HelloRequest) GetIntervalMs() int32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
 // The response message containing the greetings.
 type HelloReply struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -179,9 +199,12 @@ const file_proto_service_proto_rawDesc = "" +
 	"\x13proto/service.proto\x12\n" +
 	"learn_grpc\x1a\x1fgoogle/protobuf/timestamp.proto\"#\n" +
 	"\aVersion\x12\x18\n" +
-	"\aversion\x18\x01 \x01(\tR\aversion\"\"\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\"Y\n" +
 	"\fHelloRequest\x12\x12\n" +
-	"\x04name\x18\x01 \x01(\tR\x04name\"\x8f\x01\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x05R\x05count\x12\x1f\n" +
+	"\vinterval_ms\x18\x03 \x01(\x05R\n" +
+	"intervalMs\"\x8f\x01\n" +
 	"\n" +
 	"HelloReply\x12\x18\n" +
 	"\amessage\x18\x01 \x01(\tR\amessage\x128\n" +
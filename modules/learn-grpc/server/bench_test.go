@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "learn-grpc/proto"
+)
+
+// BenchmarkSayHelloFastMode measures a full SayHello round trip over bufconn:
+// client, logging/version/payload interceptors and handler, without the
+// demo's fixed one-second delay.
+//
+//	go test -bench SayHello -benchmem ./server/
+func BenchmarkSayHelloFastMode(b *testing.B) {
+	b.Setenv("FAST_MODE", "true")
+	c := newTestClient(b)
+	ctx := validCtx(context.Background())
+	req := &pb.HelloRequest{Name: "Gopher"}
+
+	for b.Loop() {
+		if _, err := c.SayHello(ctx, req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
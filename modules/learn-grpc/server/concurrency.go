@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConcurrencyLimiter caps the RPCs in flight across the whole server, the
+// gRPC twin of the HTTP MaxConcurrentMiddleware: a buffered channel is the
+// semaphore, and a call that finds it full is rejected instead of queued.
+// Unary and stream interceptors share the one semaphore, so a stream holds its
+// slot for as long as it stays open.
+type ConcurrencyLimiter struct {
+	sem chan struct{}
+}
+
+func NewConcurrencyLimiter(n int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{sem: make(chan struct{}, n)}
+}
+
+// InFlight is the number of RPCs currently holding a slot.
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.sem)
+}
+
+func (l *ConcurrencyLimiter) acquire() bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *ConcurrencyLimiter) release() {
+	<-l.sem
+}
+
+func (l *ConcurrencyLimiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !l.acquire() {
+			return nil, status.Error(codes.ResourceExhausted, "too many concurrent requests")
+		}
+		defer l.release()
+		return handler(ctx, req)
+	}
+}
+
+func (l *ConcurrencyLimiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !l.acquire() {
+			return status.Error(codes.ResourceExhausted, "too many concurrent requests")
+		}
+		defer l.release()
+		return handler(srv, stream)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "learn-grpc/proto"
+	"shared/ratelimit"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimiterRejectsExcessRPCs(t *testing.T) {
+	const limit = 2
+	limiter := NewConcurrencyLimiter(limit)
+	c := newTestClient(t,
+		grpc.ChainUnaryInterceptor(limiter.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.StreamInterceptor()),
+	)
+
+	// SayHello takes a second, long enough to hold every slot while the
+	// excess calls arrive.
+	var wg sync.WaitGroup
+	errs := make(chan error, limit)
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"})
+			errs <- err
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for limiter.InFlight() < limit {
+		if time.Now().After(deadline) {
+			t.Fatalf("in flight = %d, want %d", limiter.InFlight(), limit)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"})
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("unary over cap: code = %v, want ResourceExhausted", got)
+	}
+
+	stream, err := c.StreamHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("stream over cap: code = %v, want ResourceExhausted", got)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("call within cap failed: %v", err)
+		}
+	}
+
+	// The slots are released once the slow calls finish.
+	if _, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"}); err != nil {
+		t.Errorf("call after slots freed: %v", err)
+	}
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	bucket := ratelimit.NewTokenBucket(1, 2)
+	c := newTestClient(t,
+		grpc.ChainUnaryInterceptor(RateLimitInterceptor(bucket)),
+		grpc.ChainStreamInterceptor(RateLimitStreamInterceptor(bucket)),
+	)
+	t.Setenv("FAST_MODE", "true")
+
+	for i := range 2 {
+		if _, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"}); err != nil {
+			t.Fatalf("call %d within burst: %v", i, err)
+		}
+	}
+
+	_, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher"})
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Fatalf("call over rate: code = %v, want ResourceExhausted", got)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil {
+		t.Fatal("no RetryInfo detail")
+	}
+	if d := retry.GetRetryDelay().AsDuration(); d <= 0 || d > time.Second {
+		t.Errorf("retry delay = %v, want (0, 1s]", d)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// parseLogLevel maps LOG_LEVEL (debug, info, warn, error) to a slog level,
+// defaulting to info.
+func parseLogLevel(s string) slog.Level {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// LoggingInterceptor writes one structured line per unary RPC. It runs first
+// in the chain so rejected, timed-out and recovered calls are logged too.
+func LoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = AddIDToCtx(ctx)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor is LoggingInterceptor for streams: the line is
+// written when the stream ends, with the latency of the whole stream.
+func LoggingStreamInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := AddIDToCtx(stream.Context())
+		start := time.Now()
+		err := handler(srv, &wrappedStream{ServerStream: stream, ctx: ctx})
+		logRPC(ctx, logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logRPC(ctx context.Context, logger *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("peer", peerAddr(ctx)),
+		slog.String("request_id", requestID(ctx)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	logger.LogAttrs(ctx, rpcLevel(code), "rpc finished", attrs...)
+}
+
+// rpcLevel logs server faults as errors and everything the caller caused
+// (bad arguments, auth, cancellation, deadlines) as warnings.
+func rpcLevel(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func requestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(string(RequestIDKey)); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	pb "learn-grpc/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoggingInterceptorFields(t *testing.T) {
+	var logs syncBuffer
+	c := newLoggedTestClient(t, slog.New(slog.NewTextHandler(&logs, nil)))
+
+	tests := []struct {
+		name     string
+		id       string
+		wantCode codes.Code
+		want     []string
+	}{
+		{
+			name:     "success",
+			id:       "ok-req",
+			wantCode: codes.OK,
+			want:     []string{"level=INFO", "code=OK"},
+		},
+		{
+			name:     "missing api key",
+			id:       "bad-req",
+			wantCode: codes.Unauthenticated,
+			want:     []string{"level=WARN", "code=Unauthenticated", "error="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.wantCode == codes.OK {
+				ctx = validCtx(ctx)
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx, string(RequestIDKey), tt.id)
+
+			_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Gopher"})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v", got, tt.wantCode)
+			}
+
+			line := logLineFor(t, logs.String(), "request_id="+tt.id)
+			for _, field := range append(tt.want, "method=/learn_grpc.Greeter/SayHello", "latency=", "peer=") {
+				if !strings.Contains(line, field) {
+					t.Errorf("log line missing %q:\n%s", field, line)
+				}
+			}
+		})
+	}
+}
+
+// logLineFor returns the single log line containing marker.
+func logLineFor(t *testing.T, logs, marker string) string {
+	t.Helper()
+	var found []string
+	for _, line := range strings.Split(logs, "\n") {
+		if strings.Contains(line, marker) {
+			found = append(found, line)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("want exactly one log line with %q, got %d:\n%s", marker, len(found), logs)
+	}
+	return found[0]
+}
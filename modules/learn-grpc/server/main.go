@@ -5,23 +5,26 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	pb "learn-grpc/proto"
+	"shared/ratelimit"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type contextKey string
@@ -34,7 +37,44 @@ const (
 	RequestAPIKey     contextKey = "x-api-key"
 	RequestVersionKey contextKey = "x-client-version"
 	RequestIDKey      contextKey = "x-request-id"
-	MetricsPort                  = ":2112"
+
+	// MetricsAddr and MetricsPath are where Prometheus scrapes; METRICS_ADDR
+	// and METRICS_PATH override them.
+	MetricsAddr = ":2112"
+	MetricsPath = "/metrics"
+
+	// ShutdownTimeout bounds how long the metrics server gets to finish
+	// in-flight scrapes once the gRPC server has drained.
+	ShutdownTimeout = 5 * time.Second
+
+	// NameMaxLength is the default cap on HelloRequest.Name, in characters.
+	// NAME_MAX_LENGTH overrides it.
+	NameMaxLength = 64
+
+	// MaxConcurrentRPCs caps in-flight RPCs (unary and streams together);
+	// MAX_CONCURRENT_RPCS overrides it.
+	MaxConcurrentRPCs = 100
+
+	// RateLimitBurstFactor sizes the burst of the server-wide token bucket as a
+	// multiple of RATE_LIMIT_RPS. The bucket only exists when that is set.
+	RateLimitBurstFactor = 2
+
+	// KeepaliveMinTime is how often a client may ping; anything faster gets the
+	// connection closed with ENHANCE_YOUR_CALM. It must stay below the client's
+	// KeepaliveTime (30s).
+	KeepaliveMinTime = 20 * time.Second
+
+	// StreamHello limits; a request's count and interval_ms are clamped to
+	// these so one client cannot hold a stream open flooding or forever.
+	StreamDefaultCount    = 5
+	StreamMaxCount        = 20
+	StreamDefaultInterval = 500 * time.Millisecond
+	StreamMinInterval     = 50 * time.Millisecond
+
+	// ChatSendInterval is how often Chat pushes an unsolicited reply;
+	// ChatGoodbye is the last reply once the client has closed its side.
+	ChatSendInterval = 500 * time.Millisecond
+	ChatGoodbye      = "Goodbye from Chat Server"
 )
 
 type server struct {
@@ -135,40 +175,66 @@ func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloRe
 		panic("intentional gRPC handler panic")
 	}
 
-	logRequestID(ctx)
-
 	// Increment custom metric
 	incrementTotalGreetings(ctx)
 
+	// FAST_MODE drops the demo's one-second think time so benchmarks measure
+	// the interceptors and handler rather than the timer.
 	delay := time.Second
+	if os.Getenv("FAST_MODE") == "true" {
+		delay = 0
+	}
 	if os.Getenv("GRPC_LATE") == "true" {
 		log.Println("[CHAOS] Late response enabled - adding 10s delay")
 		delay = 10 * time.Second
 	}
 
-	timer := time.NewTimer(delay)
-	defer timer.Stop()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
 
-	select {
-	case <-ctx.Done():
-		return nil, status.Errorf(codes.DeadlineExceeded, "deadline exceeded: %v", ctx.Err())
-	case <-timer.C:
+		select {
+		case <-ctx.Done():
+			return nil, status.Errorf(codes.DeadlineExceeded, "deadline exceeded: %v", ctx.Err())
+		case <-timer.C:
+		}
+	}
 
-		return &pb.HelloReply{
-			Message:   "Hello " + in.GetName(),
-			Timestamp: timestamppb.Now(),
-		}, nil
+	return &pb.HelloReply{
+		Message:   "Hello " + in.GetName(),
+		Timestamp: timestamppb.Now(),
+	}, nil
+}
+
+// streamParams reads StreamHello's count and interval from the request,
+// falling back to the defaults for zero values and clamping the rest.
+func streamParams(in *pb.HelloRequest) (int, time.Duration) {
+	count := int(in.GetCount())
+	if count <= 0 {
+		count = StreamDefaultCount
+	}
+	count = min(count, StreamMaxCount)
+
+	interval := time.Duration(in.GetIntervalMs()) * time.Millisecond
+	if interval <= 0 {
+		interval = StreamDefaultInterval
 	}
+	interval = max(interval, StreamMinInterval)
+
+	return count, interval
 }
 
 func (s *server) StreamHello(in *pb.HelloRequest, stream pb.Greeter_StreamHelloServer) error {
-	log.Printf("Streaming to: %v", in.GetName())
-	logRequestID(stream.Context())
+	count, interval := streamParams(in)
+	slog.DebugContext(stream.Context(), "streaming", "name", in.GetName(), "count", count, "interval", interval)
 
 	// Increment custom metric for each chat message
 	incrementTotalGreetings(stream.Context())
 
-	for i := 0; i < 5; i++ {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := 0; i < count; i++ {
 		msg := fmt.Sprintf("Hello %s (message %d)", in.GetName(), i+1)
 		if stream.Context().Err() != nil {
 			return stream.Context().Err()
@@ -179,50 +245,71 @@ func (s *server) StreamHello(in *pb.HelloRequest, stream pb.Greeter_StreamHelloS
 		}); err != nil {
 			return err
 		}
-		time.Sleep(500 * time.Millisecond)
+		if i == count-1 {
+			break
+		}
 
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-ticker.C:
+		}
 	}
 	return nil
 }
 
 func (s *server) Chat(stream pb.Greeter_ChatServer) error {
-	count := 0
+	// The sender pushes a message every ChatSendInterval until stop closes.
+	// done closes once it has finished its last Send, so after <-done the
+	// handler is the only one writing to the stream.
+	stop := make(chan struct{})
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(ChatSendInterval)
+		defer ticker.Stop()
+
+		count := 0
 		for {
 			select {
+			case <-stop:
+				return
 			case <-stream.Context().Done():
-				{
-					log.Println("Chat Server Sending Error: ", stream.Context().Err().Error())
+				log.Println("Chat Server Sending Error: ", stream.Context().Err().Error())
+				return
+			case <-ticker.C:
+				count++
+				if err := stream.Send(&pb.HelloReply{
+					Message:   "From Chat Server " + strconv.Itoa(count),
+					Timestamp: timestamppb.Now(),
+				}); err != nil {
+					log.Println("Chat Server Sending Error: ", err.Error())
 					return
 				}
-
-			case <-time.After(500 * time.Millisecond):
-				{
-					count++
-					if err := stream.Send(&pb.HelloReply{
-						Message:   "From Chat Server " + strconv.Itoa(count),
-						Timestamp: timestamppb.Now(),
-					}); err != nil {
-						log.Println("Chat Server Sending Error: ", err.Error())
-						return
-					}
-				}
 			}
 		}
 	}()
+	stopSender := func() {
+		close(stop)
+		<-done
+	}
 
 	for {
-		logRequestID(stream.Context())
-
 		req, err := stream.Recv()
 		if err != nil {
+			stopSender()
+
 			if err == io.EOF {
-				log.Println("Server Chat Received EOF: ", err.Error())
-				return nil
+				// The client closed its side: let the in-flight reply land,
+				// then say goodbye so it knows nothing more is coming.
+				return stream.Send(&pb.HelloReply{
+					Message:   ChatGoodbye,
+					Timestamp: timestamppb.Now(),
+				})
 			}
 
 			if status.Code(err) == codes.Canceled {
-				log.Println("Server Chat Received Canceled: ", err.Error())
 				return status.Error(codes.Canceled, "client cancelled")
 			}
 
@@ -230,13 +317,12 @@ func (s *server) Chat(stream pb.Greeter_ChatServer) error {
 				return status.Error(codes.DeadlineExceeded, "deadline exceeded")
 			}
 
-			log.Println("Server Chat Received Error: ", err.Error())
 			return err
 		}
 
 		// Increment custom metric for each chat message
 		incrementTotalGreetings(stream.Context())
-		log.Printf("Chat Received: %v", req.GetName())
+		slog.DebugContext(stream.Context(), "chat received", "name", req.GetName())
 	}
 }
 
@@ -246,23 +332,82 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	// One structured line per RPC; LOG_LEVEL=debug adds the per-message chatter.
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: parseLogLevel(os.Getenv("LOG_LEVEL")),
+	}))
+	slog.SetDefault(logger)
+
+	nameMaxLength := NameMaxLength
+	if v := os.Getenv("NAME_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid NAME_MAX_LENGTH %q", v)
+		}
+		nameMaxLength = n
+	}
+
+	maxConcurrent := MaxConcurrentRPCs
+	if v := os.Getenv("MAX_CONCURRENT_RPCS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid MAX_CONCURRENT_RPCS %q", v)
+		}
+		maxConcurrent = n
+	}
+	limiter := NewConcurrencyLimiter(maxConcurrent)
+
+	unary := []grpc.UnaryServerInterceptor{
+		// Logging interceptor, outermost so it sees recovered panics
+		LoggingInterceptor(logger),
+		// Recovery interceptor
+		recovery.UnaryServerInterceptor(),
+		// Prometheus interceptor
+		grpc_prometheus.UnaryServerInterceptor,
+		// Concurrency cap, after Prometheus so rejections are counted
+		limiter.UnaryInterceptor(),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		// Logging interceptor
+		LoggingStreamInterceptor(logger),
+		// Recovery interceptor
+		recovery.StreamServerInterceptor(),
+		// Prometheus interceptor
+		grpc_prometheus.StreamServerInterceptor,
+		// Concurrency cap
+		limiter.StreamInterceptor(),
+	}
+
+	// Rate limit, opt-in: without RATE_LIMIT_RPS only the concurrency cap applies
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil || rps <= 0 {
+			log.Fatalf("invalid RATE_LIMIT_RPS %q", v)
+		}
+		bucket := ratelimit.NewTokenBucket(rps, max(1, int(rps*RateLimitBurstFactor)))
+		unary = append(unary, RateLimitInterceptor(bucket))
+		stream = append(stream, RateLimitStreamInterceptor(bucket))
+	}
+
+	unary = append(unary,
+		// Version interceptor
+		VersionInterceptor,
+		// Payload interceptor, after auth so bad keys never see payload errors
+		PayloadInterceptor(nameMaxLength),
+	)
+	stream = append(stream,
+		// Version interceptor
+		VersionStreamInterceptor,
+		// Payload interceptor
+		PayloadStreamInterceptor(nameMaxLength),
+	)
+
 	s := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			// Recovery interceptor
-			recovery.UnaryServerInterceptor(),
-			// Prometheus interceptor
-			grpc_prometheus.UnaryServerInterceptor,
-			// Version interceptor
-			VersionInterceptor,
-		),
-		grpc.ChainStreamInterceptor(
-			// Recovery interceptor
-			recovery.StreamServerInterceptor(),
-			// Prometheus interceptor
-			grpc_prometheus.StreamServerInterceptor,
-			// Version interceptor
-			VersionStreamInterceptor,
-		),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: KeepaliveMinTime,
+		}),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	)
 
 	// Register your gRPC service
@@ -274,20 +419,36 @@ func main() {
 	// Register custom metrics
 	registerCustomMetrics()
 
-	// Register prometheus metrics handler
-	http.Handle("/metrics", promhttp.Handler())
-
 	// Start an HTTP server to expose metrics
+	metricsPath := getenv("METRICS_PATH", MetricsPath)
+	metricsSrv, metricsAddr, err := startMetricsServer(getenv("METRICS_ADDR", MetricsAddr), metricsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Metrics server listening at %s%s", metricsAddr, metricsPath)
+
+	// On SIGINT/SIGTERM let in-flight RPCs finish, then stop the metrics
+	// server so the last scrape still sees them.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
 	go func() {
-		log.Printf("Metrics server listening at %s/metrics", MetricsPort)
-		if err := http.ListenAndServe(MetricsPort, nil); err != nil {
-			log.Fatalf("failed to serve metrics: %v", err)
+		defer close(stopped)
+		<-ctx.Done()
+		log.Println("shutting down")
+		s.GracefulStop()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("metrics server shutdown: %v", err)
 		}
 	}()
 
-	// Start gRPC server and block until error
+	// Start gRPC server and block until it stops
 	log.Printf("server listening at %v", lis.Addr())
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
+	<-stopped
 }
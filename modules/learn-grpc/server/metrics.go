@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -16,16 +23,62 @@ var totalGreetings = prometheus.NewCounterVec(
 	[]string{"method", "client_version"},
 )
 
+// knownVersions are the client_version label values recorded as-is. The
+// header comes straight from the client, so anything else is bucketed into
+// "other" to keep the label's cardinality bounded.
+var knownVersions = map[string]bool{
+	ServerVersion: true,
+}
+
 func registerCustomMetrics() {
 	prometheus.MustRegister(totalGreetings)
 }
 
+// ResetMetrics clears every custom metric series. It exists for tests, which
+// share the package-level collectors.
+func ResetMetrics() {
+	totalGreetings.Reset()
+}
+
+// versionLabel maps a client-supplied version onto a bounded label set.
+func versionLabel(md metadata.MD) string {
+	v := md.Get(string(RequestVersionKey))
+	switch {
+	case len(v) == 0 || v[0] == "":
+		return "unknown"
+	case knownVersions[v[0]]:
+		return v[0]
+	default:
+		return "other"
+	}
+}
+
 func incrementTotalGreetings(ctx context.Context) {
 	md, _ := metadata.FromIncomingContext(ctx)
-	version := "unknown"
-	if v := md.Get(string(RequestVersionKey)); len(v) > 0 {
-		version = v[0]
+	totalGreetings.WithLabelValues("to_server", versionLabel(md)).Inc()
+}
+
+// startMetricsServer serves the Prometheus handler at path on its own
+// http.Server. It binds before returning, so a bad METRICS_ADDR fails startup
+// instead of killing the process from a goroutine later.
+func startMetricsServer(addr, path string) (*http.Server, net.Addr, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, nil, fmt.Errorf("metrics path %q must start with /", path)
 	}
 
-	totalGreetings.WithLabelValues("to_server", version).Inc()
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to bind metrics address: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.Handler())
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("metrics server stopped: %v", err)
+		}
+	}()
+	return srv, lis.Addr(), nil
 }
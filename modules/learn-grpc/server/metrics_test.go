@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGreetingVersionLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		md        metadata.MD
+		wantLabel string
+	}{
+		{"known version", metadata.Pairs(string(RequestVersionKey), ServerVersion), ServerVersion},
+		{"arbitrary version", metadata.Pairs(string(RequestVersionKey), "9.9.9-evil"), "other"},
+		{"empty version", metadata.Pairs(string(RequestVersionKey), ""), "unknown"},
+		{"missing version", metadata.MD{}, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetMetrics()
+			incrementTotalGreetings(metadata.NewIncomingContext(context.Background(), tt.md))
+
+			if got := testutil.ToFloat64(totalGreetings.WithLabelValues("to_server", tt.wantLabel)); got != 1 {
+				t.Errorf("greetings{client_version=%q} = %v, want 1", tt.wantLabel, got)
+			}
+		})
+	}
+}
+
+func TestGreetingVersionCardinalityIsBounded(t *testing.T) {
+	ResetMetrics()
+	for _, v := range []string{"a", "b", "c", "2.0.0", "1.0.0-rc1", ServerVersion} {
+		md := metadata.Pairs(string(RequestVersionKey), v)
+		incrementTotalGreetings(metadata.NewIncomingContext(context.Background(), md))
+	}
+
+	if n := testutil.CollectAndCount(totalGreetings); n != 2 {
+		t.Errorf("got %d series, want 2 (%q and \"other\")", n, ServerVersion)
+	}
+	if got := testutil.ToFloat64(totalGreetings.WithLabelValues("to_server", "other")); got != 5 {
+		t.Errorf("greetings{client_version=\"other\"} = %v, want 5", got)
+	}
+}
+
+func TestMetricsServerServesConfiguredAddrAndPath(t *testing.T) {
+	srv, addr, err := startMetricsServer("127.0.0.1:0", "/custom-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	if host, _, _ := net.SplitHostPort(addr.String()); host != "127.0.0.1" {
+		t.Errorf("bound %s, want 127.0.0.1", addr)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/custom-metrics", http.StatusOK},
+		{"/metrics", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get("http://" + addr.String() + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(string(body), "go_goroutines") {
+				t.Errorf("metrics body missing go_goroutines:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestMetricsServerRejectsBadConfig(t *testing.T) {
+	if _, _, err := startMetricsServer("127.0.0.1:0", "metrics"); err == nil {
+		t.Error("path without leading slash: want error")
+	}
+	if _, _, err := startMetricsServer("not-an-addr", MetricsPath); err == nil {
+		t.Error("unbindable address: want error")
+	}
+}
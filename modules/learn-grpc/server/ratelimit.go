@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"shared/ratelimit"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RateLimitInterceptor admits RPCs at the bucket's rate, shared by every
+// client. Over the limit it fails fast with ResourceExhausted and a RetryInfo
+// detail saying when the next token is due, the gRPC form of Retry-After.
+func RateLimitInterceptor(bucket *ratelimit.TokenBucket) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if ok, wait := bucket.AllowAt(time.Now()); !ok {
+			return nil, rateLimited(wait)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor charges one token per stream, not per message.
+func RateLimitStreamInterceptor(bucket *ratelimit.TokenBucket) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if ok, wait := bucket.AllowAt(time.Now()); !ok {
+			return rateLimited(wait)
+		}
+		return handler(srv, stream)
+	}
+}
+
+func rateLimited(wait time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(wait)})
+	if err != nil {
+		return st.Err()
+	}
+	return withInfo.Err()
+}
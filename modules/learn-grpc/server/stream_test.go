@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	pb "learn-grpc/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func validCtx(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx,
+		string(RequestAPIKey), RequestAPI,
+		string(RequestVersionKey), ServerVersion,
+	)
+}
+
+// recvAll reads the stream to the end and returns the replies' arrival times.
+func recvAll(t *testing.T, stream grpc.ServerStreamingClient[pb.HelloReply]) []time.Time {
+	t.Helper()
+	var at []time.Time
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return at
+		}
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		at = append(at, time.Now())
+	}
+}
+
+func TestStreamParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          *pb.HelloRequest
+		wantCount    int
+		wantInterval time.Duration
+	}{
+		{"defaults", &pb.HelloRequest{}, StreamDefaultCount, StreamDefaultInterval},
+		{"custom", &pb.HelloRequest{Count: 3, IntervalMs: 120}, 3, 120 * time.Millisecond},
+		{"clamped", &pb.HelloRequest{Count: 10_000, IntervalMs: 1}, StreamMaxCount, StreamMinInterval},
+		{"negative", &pb.HelloRequest{Count: -4, IntervalMs: -1}, StreamDefaultCount, StreamDefaultInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, interval := streamParams(tt.req)
+			if count != tt.wantCount || interval != tt.wantInterval {
+				t.Errorf("streamParams = %d, %v; want %d, %v", count, interval, tt.wantCount, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestStreamHelloCustomRate(t *testing.T) {
+	c := newTestClient(t)
+
+	stream, err := c.StreamHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher", Count: 3, IntervalMs: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := recvAll(t, stream)
+	if len(at) != 3 {
+		t.Fatalf("got %d replies, want 3", len(at))
+	}
+	if gap := at[2].Sub(at[0]); gap < 2*60*time.Millisecond-10*time.Millisecond {
+		t.Errorf("3 replies took %v, want about 120ms", gap)
+	}
+}
+
+func TestStreamHelloClampsOversizedRequest(t *testing.T) {
+	c := newTestClient(t)
+
+	start := time.Now()
+	stream, err := c.StreamHello(validCtx(context.Background()), &pb.HelloRequest{Name: "Gopher", Count: 1_000_000, IntervalMs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := recvAll(t, stream)
+	if len(at) != StreamMaxCount {
+		t.Fatalf("got %d replies, want the clamp of %d", len(at), StreamMaxCount)
+	}
+	if took := time.Since(start); took < time.Duration(StreamMaxCount-1)*StreamMinInterval-10*time.Millisecond {
+		t.Errorf("stream took %v, faster than the minimum interval allows", took)
+	}
+}
+
+func TestStreamHelloStopsOnCancel(t *testing.T) {
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(validCtx(context.Background()))
+	defer cancel()
+	stream, err := c.StreamHello(ctx, &pb.HelloRequest{Name: "Gopher", Count: 10, IntervalMs: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	start := time.Now()
+	_, err = stream.Recv()
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("Recv after cancel: %v, want Canceled", err)
+	}
+	if took := time.Since(start); took > 250*time.Millisecond {
+		t.Errorf("cancellation took %v to surface", took)
+	}
+}
+
+// fakeHelloStream drives StreamHello directly so the test can see whether the
+// handler itself returns after the client goes away.
+type fakeHelloStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	sent   int
+	onSend func()
+}
+
+func (f *fakeHelloStream) Context() context.Context { return f.ctx }
+func (f *fakeHelloStream) Send(*pb.HelloReply) error {
+	f.sent++
+	f.onSend()
+	return nil
+}
+
+func TestStreamHelloHandlerReturnsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &fakeHelloStream{ctx: ctx, onSend: cancel}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- (&server{}).StreamHello(&pb.HelloRequest{Count: 10, IntervalMs: 1000}, stream)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("StreamHello = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("StreamHello kept running after the client cancelled")
+	}
+	if stream.sent != 1 {
+		t.Errorf("sent %d replies, want 1", stream.sent)
+	}
+}
+
+func TestChatSaysGoodbyeOnCloseSend(t *testing.T) {
+	c := newTestClient(t)
+
+	ctx, cancel := context.WithTimeout(validCtx(context.Background()), 5*time.Second)
+	defer cancel()
+
+	chat, err := c.Chat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.Send(&pb.HelloRequest{Name: "Gopher"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the server's sender to be mid-conversation before hanging up.
+	if _, err := chat.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	var last string
+	for {
+		reply, err := chat.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("stream ended with %v, want a clean EOF", err)
+		}
+		last = reply.GetMessage()
+	}
+	if last != ChatGoodbye {
+		t.Errorf("last reply = %q, want %q", last, ChatGoodbye)
+	}
+}
@@ -2,26 +2,12 @@ package main
 
 import (
 	"context"
-	"log"
+	"os"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc/metadata"
 )
 
-func logRequestID(ctx context.Context) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return
-	}
-
-	requestIDs := md.Get(string(RequestIDKey))
-	if len(requestIDs) >= 1 {
-		log.Printf("Processing request for Gopher in handler [RequestID: %s]", requestIDs[0])
-	} else {
-		log.Println("missing request id")
-	}
-}
-
 func AddIDToCtx(ctx context.Context) context.Context {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -35,3 +21,11 @@ func AddIDToCtx(ctx context.Context) context.Context {
 
 	return metadata.NewIncomingContext(ctx, md)
 }
+
+// getenv returns the environment variable key, or def when it is unset or empty.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
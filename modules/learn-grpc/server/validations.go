@@ -1,21 +1,62 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	pb "learn-grpc/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// ErrorDomain and the Reason* codes are the machine-readable half of a
+// validation failure. Each error carries a google.rpc.ErrorInfo with one of
+// these reasons and the offending metadata key under "field", so clients can
+// branch on the reason instead of parsing the message.
+const (
+	ErrorDomain = "learn-grpc"
+
+	ReasonAPIKeyMissing      = "API_KEY_MISSING"
+	ReasonAPIKeyInvalid      = "API_KEY_INVALID"
+	ReasonVersionMissing     = "CLIENT_VERSION_MISSING"
+	ReasonVersionUnsupported = "CLIENT_VERSION_UNSUPPORTED"
+	ReasonNameEmpty          = "NAME_EMPTY"
+	ReasonNameTooLong        = "NAME_TOO_LONG"
+)
+
+// validationError builds a status error carrying an ErrorInfo detail. If the
+// detail cannot be attached, the plain status is still returned.
+func validationError(code codes.Code, reason string, field string, msg string) error {
+	st := status.New(code, msg)
+	withInfo, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: map[string]string{"field": field},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withInfo.Err()
+}
+
 func validateAPIKey(md metadata.MD) error {
 	apiKeys := md.Get(string(RequestAPIKey))
 
 	// Add API Key check
 	if len(apiKeys) == 0 {
-		return status.Error(codes.Unauthenticated, "api key is missing")
+		return validationError(codes.Unauthenticated, ReasonAPIKeyMissing, string(RequestAPIKey),
+			"api key is missing")
 	}
 
 	if apiKeys[0] != RequestAPI {
-		return status.Errorf(codes.Unauthenticated, "invalid api key: %s", apiKeys[0])
+		return validationError(codes.Unauthenticated, ReasonAPIKeyInvalid, string(RequestAPIKey),
+			"invalid api key: "+apiKeys[0])
 	}
 	return nil
 }
@@ -23,11 +64,66 @@ func validateAPIKey(md metadata.MD) error {
 func validateVersion(md metadata.MD) error {
 	versions := md.Get(string(RequestVersionKey))
 	if len(versions) == 0 {
-		return status.Error(codes.InvalidArgument, "client version is missing")
+		return validationError(codes.InvalidArgument, ReasonVersionMissing, string(RequestVersionKey),
+			"client version is missing")
 	}
 
 	if versions[0] != ServerVersion {
-		return status.Errorf(codes.InvalidArgument, "invalid client version: %s", versions[0])
+		return validationError(codes.InvalidArgument, ReasonVersionUnsupported, string(RequestVersionKey),
+			"invalid client version: "+versions[0])
+	}
+	return nil
+}
+
+// validateHello checks a HelloRequest's payload. Name must be non-blank and at
+// most maxLen characters (runes, not bytes).
+func validateHello(in *pb.HelloRequest, maxLen int) error {
+	name := in.GetName()
+	if strings.TrimSpace(name) == "" {
+		return validationError(codes.InvalidArgument, ReasonNameEmpty, "name",
+			"name is empty")
+	}
+
+	if n := utf8.RuneCountInString(name); n > maxLen {
+		return validationError(codes.InvalidArgument, ReasonNameTooLong, "name",
+			fmt.Sprintf("name is %d characters, max is %d", n, maxLen))
+	}
+	return nil
+}
+
+// PayloadInterceptor rejects invalid HelloRequests before the handler runs.
+// Other request types pass through untouched.
+func PayloadInterceptor(maxLen int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if in, ok := req.(*pb.HelloRequest); ok {
+			if err := validateHello(in, maxLen); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// PayloadStreamInterceptor validates every HelloRequest a stream receives.
+// A bad message ends the stream with the validation error, since the handler
+// returns whatever Recv gives it.
+func PayloadStreamInterceptor(maxLen int) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ServerStream: stream, maxLen: maxLen})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+	maxLen int
+}
+
+func (s *validatingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if in, ok := m.(*pb.HelloRequest); ok {
+		return validateHello(in, s.maxLen)
 	}
 	return nil
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "learn-grpc/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves a Greeter behind the logging, version and payload
+// interceptors on an in-memory listener and returns a client connected to it.
+// Extra opts are applied after those, so any interceptors they chain run
+// innermost.
+func newTestClient(t testing.TB, opts ...grpc.ServerOption) pb.GreeterClient {
+	t.Helper()
+	return newLoggedTestClient(t, slog.New(slog.NewTextHandler(io.Discard, nil)), opts...)
+}
+
+// newLoggedTestClient is newTestClient with the RPC logging interceptors
+// writing to logger.
+func newLoggedTestClient(t testing.TB, logger *slog.Logger, opts ...grpc.ServerOption) pb.GreeterClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(LoggingInterceptor(logger), VersionInterceptor, PayloadInterceptor(NameMaxLength)),
+		grpc.ChainStreamInterceptor(LoggingStreamInterceptor(logger), VersionStreamInterceptor, PayloadStreamInterceptor(NameMaxLength)),
+	}, opts...)...)
+	pb.RegisterGreeterServer(s, &server{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewGreeterClient(conn)
+}
+
+// errorInfo pulls the ErrorInfo detail out of a status error, as a client would.
+func errorInfo(t *testing.T, err error) *errdetails.ErrorInfo {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("no ErrorInfo detail in %v", err)
+	return nil
+}
+
+func TestValidationErrorDetails(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		name       string
+		md         []string
+		wantCode   codes.Code
+		wantReason string
+		wantField  string
+	}{
+		{
+			name:       "missing api key",
+			md:         []string{string(RequestVersionKey), ServerVersion},
+			wantCode:   codes.Unauthenticated,
+			wantReason: ReasonAPIKeyMissing,
+			wantField:  string(RequestAPIKey),
+		},
+		{
+			name:       "invalid api key",
+			md:         []string{string(RequestAPIKey), "wrong", string(RequestVersionKey), ServerVersion},
+			wantCode:   codes.Unauthenticated,
+			wantReason: ReasonAPIKeyInvalid,
+			wantField:  string(RequestAPIKey),
+		},
+		{
+			name:       "missing version",
+			md:         []string{string(RequestAPIKey), RequestAPI},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonVersionMissing,
+			wantField:  string(RequestVersionKey),
+		},
+		{
+			name:       "unsupported version",
+			md:         []string{string(RequestAPIKey), RequestAPI, string(RequestVersionKey), "0.0.1"},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonVersionUnsupported,
+			wantField:  string(RequestVersionKey),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+
+			_, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Gopher"})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+
+			info := errorInfo(t, err)
+			if info.GetReason() != tt.wantReason {
+				t.Errorf("reason = %q, want %q", info.GetReason(), tt.wantReason)
+			}
+			if info.GetDomain() != ErrorDomain {
+				t.Errorf("domain = %q, want %q", info.GetDomain(), ErrorDomain)
+			}
+			if got := info.GetMetadata()["field"]; got != tt.wantField {
+				t.Errorf("field = %q, want %q", got, tt.wantField)
+			}
+
+			// Streams are rejected by the same validations.
+			stream, err := c.StreamHello(ctx, &pb.HelloRequest{Name: "Gopher"})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if info := errorInfo(t, err); info.GetReason() != tt.wantReason {
+				t.Errorf("stream reason = %q, want %q", info.GetReason(), tt.wantReason)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to hand to a logger while server
+// goroutines are logging.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestClientRequestIDIsLoggedUnchanged(t *testing.T) {
+	var logs syncBuffer
+	c := newLoggedTestClient(t, slog.New(slog.NewTextHandler(&logs, nil)))
+	ctx := metadata.AppendToOutgoingContext(validCtx(context.Background()), string(RequestIDKey), "client-req-42")
+
+	if _, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Gopher"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "request_id=client-req-42"; !strings.Contains(logs.String(), want) {
+		t.Errorf("server logs missing %q:\n%s", want, logs.String())
+	}
+}
+
+func TestHelloPayloadValidation(t *testing.T) {
+	c := newTestClient(t)
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{name: "empty name", payload: "", wantCode: codes.InvalidArgument, wantReason: ReasonNameEmpty},
+		{name: "blank name", payload: "   ", wantCode: codes.InvalidArgument, wantReason: ReasonNameEmpty},
+		{name: "over-long name", payload: strings.Repeat("g", NameMaxLength+1), wantCode: codes.InvalidArgument, wantReason: ReasonNameTooLong},
+		{name: "valid name", payload: "Gopher", wantCode: codes.OK},
+		{name: "max length counts runes", payload: strings.Repeat("é", NameMaxLength), wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.SayHello(validCtx(context.Background()), &pb.HelloRequest{Name: tt.payload})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.wantCode, err)
+			}
+			if tt.wantCode == codes.OK {
+				return
+			}
+
+			info := errorInfo(t, err)
+			if info.GetReason() != tt.wantReason {
+				t.Errorf("reason = %q, want %q", info.GetReason(), tt.wantReason)
+			}
+			if got := info.GetMetadata()["field"]; got != "name" {
+				t.Errorf("field = %q, want %q", got, "name")
+			}
+
+			// The stream never starts sending for a bad request.
+			stream, err := c.StreamHello(validCtx(context.Background()), &pb.HelloRequest{Name: tt.payload})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if info := errorInfo(t, err); info.GetReason() != tt.wantReason {
+				t.Errorf("stream reason = %q, want %q", info.GetReason(), tt.wantReason)
+			}
+		})
+	}
+}
@@ -3,24 +3,38 @@ package main
 import (
 	"log"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
 func main() {
 	serverAddr := "localhost:8080"
-	var wg sync.WaitGroup
 
 	log.Printf("Starting Port Bomb against %s...", serverAddr)
 
 	// Attempt to open/close 2000 connections as fast as possible
-	for i := 0; i < 2000; i++ {
+	stats := bomb(serverAddr, 2000, 2*time.Millisecond)
+
+	stats.Print(os.Stdout)
+	log.Println("Bomb finished. Check 'netstat -an | grep 8080 | grep TIME_WAIT | wc -l'")
+}
+
+// bomb opens and immediately closes n connections to addr, pausing between
+// launches, and records each connection's dial-to-close lifetime.
+func bomb(addr string, n int, pause time.Duration) *lifetimeStats {
+	var wg sync.WaitGroup
+	stats := &lifetimeStats{}
+
+	for i := 0; i < n; i++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			conn, err := net.Dial("tcp", serverAddr)
+			start := time.Now()
+			conn, err := net.Dial("tcp", addr)
 			if err != nil {
 				log.Printf("[%d] Dial error: %v", id, err)
+				stats.dialError()
 				return
 			}
 			/*
@@ -47,12 +61,13 @@ func main() {
 				It will stay here until a timeout occurs (often 60 seconds) because the other side (server)is stuck in CLOSE_WAIT.
 			*/
 			conn.Close()
+			stats.observe(time.Since(start))
 		}(i)
 
 		// Tiny sleep to avoid overloading local CPU, but fast enough to fill ports
-		time.Sleep(2 * time.Millisecond)
+		time.Sleep(pause)
 	}
 
 	wg.Wait()
-	log.Println("Bomb finished. Check 'netstat -an | grep 8080 | grep TIME_WAIT | wc -l'")
+	return stats
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBombRecordsLifetimes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	const n = 20
+	sum := bomb(ln.Addr().String(), n, 0).Summary()
+
+	if sum.Count != n || sum.DialErrors != 0 {
+		t.Fatalf("count = %d, dial errors = %d; want %d, 0", sum.Count, sum.DialErrors, n)
+	}
+	total := 0
+	for _, b := range sum.Buckets {
+		total += b
+	}
+	if total != n {
+		t.Errorf("buckets hold %d connections, want %d", total, n)
+	}
+	if sum.Min <= 0 || sum.Min > sum.Median || sum.Median > sum.P95 || sum.P95 > sum.Max {
+		t.Errorf("summary not ordered: %+v", sum)
+	}
+
+	var out strings.Builder
+	bomb(ln.Addr().String(), 1, 0).Print(&out)
+	if !strings.Contains(out.String(), "median=") {
+		t.Errorf("Print output missing summary line: %q", out.String())
+	}
+}
+
+func TestBombCountsDialErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sum := bomb(addr, 3, 0).Summary()
+	if sum.DialErrors != 3 || sum.Count != 0 {
+		t.Errorf("dial errors = %d, count = %d; want 3, 0", sum.DialErrors, sum.Count)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	if got := percentile(sorted, 50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %v, want 50ms", got)
+	}
+	if got := percentile(sorted, 95); got != 95*time.Millisecond {
+		t.Errorf("p95 = %v, want 95ms", got)
+	}
+	if got := percentile(sorted[:1], 95); got != time.Millisecond {
+		t.Errorf("p95 of one = %v, want 1ms", got)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lifetimeBuckets are the upper bounds of the connection-lifetime histogram;
+// anything slower lands in the final +Inf bucket.
+var lifetimeBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	1 * time.Second,
+}
+
+// lifetimeStats collects dial-to-close durations and dial failures so the
+// TIME_WAIT experiment can be read without netstat.
+type lifetimeStats struct {
+	mu         sync.Mutex
+	lifetimes  []time.Duration
+	dialErrors int
+}
+
+func (s *lifetimeStats) observe(d time.Duration) {
+	s.mu.Lock()
+	s.lifetimes = append(s.lifetimes, d)
+	s.mu.Unlock()
+}
+
+func (s *lifetimeStats) dialError() {
+	s.mu.Lock()
+	s.dialErrors++
+	s.mu.Unlock()
+}
+
+// lifetimeSummary is a point-in-time view of lifetimeStats. Buckets has one
+// more entry than lifetimeBuckets, for +Inf, and is not cumulative.
+type lifetimeSummary struct {
+	Count      int
+	DialErrors int
+	Min        time.Duration
+	Median     time.Duration
+	P95        time.Duration
+	Max        time.Duration
+	Buckets    []int
+}
+
+func (s *lifetimeStats) Summary() lifetimeSummary {
+	s.mu.Lock()
+	sorted := slices.Clone(s.lifetimes)
+	sum := lifetimeSummary{DialErrors: s.dialErrors}
+	s.mu.Unlock()
+
+	sum.Count = len(sorted)
+	sum.Buckets = make([]int, len(lifetimeBuckets)+1)
+	if len(sorted) == 0 {
+		return sum
+	}
+
+	slices.Sort(sorted)
+	sum.Min = sorted[0]
+	sum.Median = percentile(sorted, 50)
+	sum.P95 = percentile(sorted, 95)
+	sum.Max = sorted[len(sorted)-1]
+	for _, d := range sorted {
+		i, _ := slices.BinarySearch(lifetimeBuckets, d)
+		sum.Buckets[i]++
+	}
+	return sum
+}
+
+// percentile uses the nearest-rank method on an already sorted slice.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
+
+// Print writes the summary and a text histogram to w.
+func (s *lifetimeStats) Print(w io.Writer) {
+	sum := s.Summary()
+	fmt.Fprintf(w, "Connections: %d ok, %d dial errors\n", sum.Count, sum.DialErrors)
+	if sum.Count == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Lifetime (dial->close): min=%v median=%v p95=%v max=%v\n",
+		sum.Min, sum.Median, sum.P95, sum.Max)
+
+	for i, n := range sum.Buckets {
+		label := "+Inf"
+		if i < len(lifetimeBuckets) {
+			label = "<= " + lifetimeBuckets[i].String()
+		}
+		bar := ""
+		if n > 0 {
+			bar = strings.Repeat("#", max(1, 40*n/sum.Count))
+		}
+		fmt.Fprintf(w, "  %-10s %6d %s\n", label, n, bar)
+	}
+}
@@ -2,45 +2,149 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"time"
 )
 
+const (
+	MAX_RETRIES  = 5
+	BACKOFF_BASE = 200 * time.Millisecond
+	BACKOFF_CAP  = 5 * time.Second
+)
+
+type clientConfig struct {
+	addr        string
+	reconnect   bool
+	maxRetries  int
+	backoffBase time.Duration
+	backoffCap  time.Duration
+}
+
 func main() {
+	noReconnect := flag.Bool("no-reconnect", false, "exit as soon as the connection fails instead of re-dialing")
+	maxRetries := flag.Int("max-retries", MAX_RETRIES, "dial attempts, and consecutive failed exchanges, before giving up on a reconnect")
+	flag.Parse()
+
 	serverAddr := "localhost:8080"
 	if addr := os.Getenv("SERVER_ADDR"); addr != "" {
 		serverAddr = addr
 	}
 
-	conn, err := net.Dial("tcp", serverAddr)
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+	cfg := clientConfig{
+		addr:        serverAddr,
+		reconnect:   !*noReconnect,
+		maxRetries:  *maxRetries,
+		backoffBase: BACKOFF_BASE,
+		backoffCap:  BACKOFF_CAP,
+	}
+	if err := run(cfg, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run is the interactive prompt: it sends each line read from in and prints
+// the server's reply to out. It returns nil on an empty line, "exit", or EOF
+// (Ctrl-D).
+//
+// When the connection drops mid-exchange and cfg.reconnect is set, run
+// re-dials with exponential backoff and resends the line that was cut off.
+// A server that accepts and then hangs up straight away looks like a good
+// dial every time, so failed exchanges are backed off and capped at
+// cfg.maxRetries in a row as well.
+func run(cfg clientConfig, in io.Reader, out io.Writer) error {
+	dialAttempts := cfg.maxRetries
+	if !cfg.reconnect {
+		dialAttempts = 1
 	}
-	defer conn.Close()
 
-	log.Printf("Connected to %s", serverAddr)
+	conn, err := dialWithBackoff(cfg, dialAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() { conn.Close() }()
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(in)
 	serverReader := bufio.NewReader(conn)
 
 	for {
-		fmt.Print("Text to send: ")
-		text, _ := reader.ReadString('\n')
+		fmt.Fprint(out, "Text to send: ")
+		text, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && text == "" {
+			fmt.Fprintln(out)
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
 
 		// Exit on empty line or "exit"
 		if text == "\n" || text == "exit\n" {
+			return nil
+		}
+		// A last line ended by Ctrl-D instead of Enter still needs its newline.
+		if text[len(text)-1] != '\n' {
+			text += "\n"
+		}
+
+		delay := cfg.backoffBase
+		for failures := 1; ; failures++ {
+			message, err := exchange(conn, serverReader, text)
+			if err == nil {
+				fmt.Fprintf(out, "Server: %s", message)
+				break
+			}
+			if !cfg.reconnect {
+				return fmt.Errorf("server closed connection: %w", err)
+			}
+			if failures >= max(cfg.maxRetries, 1) {
+				return fmt.Errorf("giving up after %d failed exchanges: %w", failures, err)
+			}
+
+			log.Printf("Connection lost (%v), reconnecting to %s in %v", err, cfg.addr, delay)
 			conn.Close()
-			break
+			time.Sleep(delay)
+			delay = min(delay*2, cfg.backoffCap)
+			if conn, err = dialWithBackoff(cfg, cfg.maxRetries); err != nil {
+				return fmt.Errorf("failed to reconnect: %w", err)
+			}
+			serverReader = bufio.NewReader(conn)
 		}
+	}
+}
 
-		fmt.Fprintf(conn, text)
+// exchange sends one line and waits for the one-line reply.
+func exchange(conn net.Conn, serverReader *bufio.Reader, text string) (string, error) {
+	if _, err := fmt.Fprint(conn, text); err != nil {
+		return "", err
+	}
+	return serverReader.ReadString('\n')
+}
 
-		message, err := serverReader.ReadString('\n')
-		if err != nil {
-			log.Fatalf("Server closed connection: %v", err)
+// dialWithBackoff tries up to attempts times, doubling the wait between
+// tries from cfg.backoffBase up to cfg.backoffCap.
+func dialWithBackoff(cfg clientConfig, attempts int) (net.Conn, error) {
+	attempts = max(attempts, 1)
+	delay := cfg.backoffBase
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", cfg.addr); err == nil {
+			log.Printf("Connected to %s", cfg.addr)
+			return conn, nil
 		}
-		fmt.Printf("Server: %s", message)
+		if attempt == attempts {
+			break
+		}
+
+		log.Printf("Dial attempt %d/%d failed: %v (retrying in %v)", attempt, attempts, err, delay)
+		time.Sleep(delay)
+		delay = min(delay*2, cfg.backoffCap)
 	}
+	return nil, err
 }
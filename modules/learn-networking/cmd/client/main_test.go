@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer echoes like cmd/server, except that it hangs up on the first
+// connection after reading one line, without replying.
+func flakyServer(t *testing.T) (addr string, accepted *atomic.Int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	accepted = new(atomic.Int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			n := accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if n == 1 {
+						return
+					}
+					io.WriteString(conn, "ECHO: "+line)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), accepted
+}
+
+func testConfig(addr string, reconnect bool) clientConfig {
+	return clientConfig{
+		addr:        addr,
+		reconnect:   reconnect,
+		maxRetries:  3,
+		backoffBase: time.Millisecond,
+		backoffCap:  10 * time.Millisecond,
+	}
+}
+
+func TestRunReconnectsAfterDrop(t *testing.T) {
+	addr, accepted := flakyServer(t)
+
+	var out strings.Builder
+	if err := run(testConfig(addr, true), strings.NewReader("first\nsecond\n"), &out); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	for _, want := range []string{"Server: ECHO: first\n", "Server: ECHO: second\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q missing %q", out.String(), want)
+		}
+	}
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestRunNoReconnect(t *testing.T) {
+	addr, accepted := flakyServer(t)
+
+	var out strings.Builder
+	if err := run(testConfig(addr, false), strings.NewReader("first\n"), &out); err == nil {
+		t.Fatal("run succeeded, want an error when the server drops the connection")
+	}
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestRunGivesUpAfterMaxRetries(t *testing.T) {
+	// Grab a free port, then close it so every dial is refused.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	if err := run(testConfig(addr, true), strings.NewReader("hi\n"), io.Discard); err == nil {
+		t.Fatal("run succeeded against a closed port")
+	}
+}
+
+func TestRunCapsFailedExchanges(t *testing.T) {
+	// Every dial succeeds, but the server hangs up before replying.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+
+	cfg := testConfig(ln.Addr().String(), true)
+	done := make(chan error, 1)
+	go func() { done <- run(cfg, strings.NewReader("hi\n"), io.Discard) }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("run succeeded against a server that never replies")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run kept reconnecting instead of giving up")
+	}
+	if n := accepted.Load(); n != int32(cfg.maxRetries) {
+		t.Errorf("server accepted %d connections, want %d", n, cfg.maxRetries)
+	}
+}
+
+func TestRunExitsOnEOF(t *testing.T) {
+	addr, _ := flakyServer(t)
+
+	if err := run(testConfig(addr, true), strings.NewReader(""), io.Discard); err != nil {
+		t.Errorf("run on immediate EOF: %v", err)
+	}
+}
+
+func TestRunSendsFormatVerbsLiterally(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+		io.WriteString(conn, "ECHO: "+line)
+	}()
+
+	const input = "100%s%d%% done\n"
+	var out strings.Builder
+	if err := run(testConfig(ln.Addr().String(), false), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if got := <-received; got != input {
+		t.Errorf("server received %q, want %q", got, input)
+	}
+	if want := "Server: ECHO: " + input; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q missing %q", out.String(), want)
+	}
+}
@@ -4,11 +4,136 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	IDLE_TIMEOUT  = 5 * time.Second
+	WRITE_TIMEOUT = 1 * time.Second
+	REPLY_DELAY   = 2 * time.Second
+)
+
+// slowServer is the demo server: it reads once, waits replyDelay, and replies.
+// Without deadlines a client that connects and then goes quiet would pin a
+// goroutine and an FD forever, so reads get a deadline and a reaper closes
+// anything idle for longer than idleTimeout.
+type slowServer struct {
+	idleTimeout  time.Duration
+	writeTimeout time.Duration
+	replyDelay   time.Duration
+
+	mu   sync.Mutex
+	idle map[net.Conn]time.Time // connections waiting on the client, by accept time
+	live atomic.Int64
+}
+
+func newSlowServer(idleTimeout, replyDelay time.Duration) *slowServer {
+	return &slowServer{
+		idleTimeout:  idleTimeout,
+		writeTimeout: WRITE_TIMEOUT,
+		replyDelay:   replyDelay,
+		idle:         make(map[net.Conn]time.Time),
+	}
+}
+
+// Live is the number of connections currently open on the server side.
+func (s *slowServer) Live() int64 {
+	return s.live.Load()
+}
+
+// Serve accepts until ln is closed, reaping idle connections in the background.
+func (s *slowServer) Serve(ln net.Listener) {
+	done := make(chan struct{})
+	defer close(done)
+	go s.reap(done)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.track(conn)
+		go s.handle(conn)
+	}
+}
+
+func (s *slowServer) track(c net.Conn) {
+	s.mu.Lock()
+	s.idle[c] = time.Now()
+	s.mu.Unlock()
+	s.live.Add(1)
+}
+
+// busy takes c out of the reaper's view once the client has spoken; from then
+// on only the write deadline bounds it.
+func (s *slowServer) busy(c net.Conn) {
+	s.mu.Lock()
+	delete(s.idle, c)
+	s.mu.Unlock()
+}
+
+func (s *slowServer) untrack(c net.Conn) {
+	s.busy(c)
+	s.live.Add(-1)
+}
+
+func (s *slowServer) handle(c net.Conn) {
+	defer s.untrack(c)
+	defer c.Close()
+
+	// Read once then wait - simulates a slow client
+	buf := make([]byte, 1024)
+	c.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	if _, err := c.Read(buf); err != nil {
+		return
+	}
+	s.busy(c)
+
+	time.Sleep(s.replyDelay)
+
+	c.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	_, _ = c.Write([]byte("Acknowledged\n"))
+}
+
+// reap closes connections that have not sent anything within idleTimeout.
+// The read deadline does the same job for a handler that is already blocked
+// in Read; the reaper is the backstop that works from outside the handler.
+// Closing unblocks the handler's Read, which then untracks the connection.
+func (s *slowServer) reap(done <-chan struct{}) {
+	t := time.NewTicker(s.idleTimeout / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for c, since := range s.idle {
+				if now.Sub(since) > s.idleTimeout {
+					log.Printf("Reaping idle connection from %s", c.RemoteAddr())
+					c.Close()
+					delete(s.idle, c)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
 func main() {
+	idleTimeout := IDLE_TIMEOUT
+	if v := os.Getenv("IDLE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid IDLE_TIMEOUT %q: %v", v, err)
+		}
+		idleTimeout = d
+	}
+
 	// 1. Setup a server that can handle many connections
 	ln, err := net.Listen("tcp", "localhost:8888")
 	if err != nil {
@@ -16,28 +141,15 @@ func main() {
 	}
 	defer ln.Close()
 
+	srv := newSlowServer(idleTimeout, REPLY_DELAY)
+
 	var activeConns sync.WaitGroup
 	connCount := 100 // Let's simulate 100 concurrent "slow" connections
 
 	log.Printf("Starting Multiplexing Demo: 1 Server, %d Clients", connCount)
 
 	// Server: Accept loop
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				return
-			}
-			go func(c net.Conn) {
-				defer c.Close()
-				// Read once then wait - simulates a slow client
-				buf := make([]byte, 1024)
-				_, _ = c.Read(buf)
-				time.Sleep(2 * time.Second)
-				_, _ = c.Write([]byte("Acknowledged\n"))
-			}(conn)
-		}
-	}()
+	go srv.Serve(ln)
 
 	// Clients: Launch many goroutines
 	startTime := time.Now()
@@ -62,5 +174,6 @@ func main() {
 
 	activeConns.Wait()
 	fmt.Printf("Finished handling %d connections in %v\n", connCount, time.Since(startTime))
+	fmt.Printf("Live server-side connections: %d\n", srv.Live())
 	fmt.Println("Check 'lsof -nP -i :8888' while this is running to see 2x100 FDs!")
 }
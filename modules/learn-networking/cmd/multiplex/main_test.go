@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func startSlowServer(t *testing.T, idleTimeout, replyDelay time.Duration) (*slowServer, string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := newSlowServer(idleTimeout, replyDelay)
+	go srv.Serve(ln)
+	return srv, ln.Addr().String()
+}
+
+func waitForLive(t *testing.T, srv *slowServer, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.Live() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("live = %d, want %d", srv.Live(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestIdleConnectionsAreReaped(t *testing.T) {
+	srv, addr := startSlowServer(t, 50*time.Millisecond, 0)
+
+	const n = 10
+	for range n {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Never write or read; the server must give up on its own.
+		defer conn.Close()
+	}
+
+	waitForLive(t, srv, n)
+	waitForLive(t, srv, 0)
+}
+
+func TestActiveConnectionGetsReply(t *testing.T) {
+	srv, addr := startSlowServer(t, 50*time.Millisecond, 100*time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The reply delay is longer than the idle timeout; a client that has
+	// spoken must not be reaped while the server is working on it.
+	fmt.Fprintln(conn, "hello")
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Acknowledged\n" {
+		t.Errorf("reply = %q, want %q", reply, "Acknowledged\n")
+	}
+
+	waitForLive(t, srv, 0)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// HandlerFunc answers one command. args is everything after the verb with
+// surrounding whitespace trimmed; the reply gets its newline added by the
+// dispatcher.
+type HandlerFunc func(args string) (reply string, quit bool)
+
+// defaultCommands are the verbs the plain-text protocol understands. Add an
+// entry here (upper-case key) to teach the server a new one.
+var defaultCommands = map[string]HandlerFunc{
+	"PING": func(string) (string, bool) {
+		return "PONG", false
+	},
+	"TIME": func(string) (string, bool) {
+		return time.Now().Format(time.RFC3339), false
+	},
+	"UPPER": func(args string) (string, bool) {
+		return strings.ToUpper(args), false
+	},
+	"QUIT": func(string) (string, bool) {
+		return "BYE", true
+	},
+}
+
+// commandLines dispatches on the first word of each line, matched
+// case-insensitively against cmds. Lines without a known verb fall back to
+// echoLine, so the server still behaves like a plain echo server.
+func commandLines(cmds map[string]HandlerFunc) lineHandler {
+	return func(line string) (string, bool) {
+		verb, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		h, ok := cmds[strings.ToUpper(verb)]
+		if !ok {
+			return echoLine(line)
+		}
+		reply, quit := h(strings.TrimSpace(args))
+		return reply + "\n", quit
+	}
+}
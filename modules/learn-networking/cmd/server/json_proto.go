@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// jsonRequest is one line of the PROTO=json protocol.
+type jsonRequest struct {
+	Cmd     string `json:"cmd"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// jsonResponse always has ok set; result on success, error otherwise.
+type jsonResponse struct {
+	OK     bool   `json:"ok"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// jsonLine handles one {"cmd":...,"payload":...} line:
+//   - echo returns the payload
+//   - time returns the server time in RFC3339
+//   - quit says bye and closes the connection
+//
+// Anything else, including malformed JSON, gets an ok=false response and the
+// connection stays open.
+func jsonLine(line string) (string, bool) {
+	var req jsonRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		return encodeResponse(jsonResponse{Error: "malformed request: " + err.Error()}), false
+	}
+
+	switch req.Cmd {
+	case "echo":
+		return encodeResponse(jsonResponse{OK: true, Result: req.Payload}), false
+	case "time":
+		return encodeResponse(jsonResponse{OK: true, Result: time.Now().Format(time.RFC3339)}), false
+	case "quit":
+		return encodeResponse(jsonResponse{OK: true, Result: "bye"}), true
+	default:
+		return encodeResponse(jsonResponse{Error: "unknown command: " + req.Cmd}), false
+	}
+}
+
+// encodeResponse renders resp as a single newline-terminated line.
+func encodeResponse(resp jsonResponse) string {
+	b, _ := json.Marshal(resp) // only strings and a bool; cannot fail
+	return string(b) + "\n"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// leakRegistry remembers the connections LEAK=true mode walks away from, so
+// they can be closed later for a before/after look at the FD table.
+type leakRegistry struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newLeakRegistry() *leakRegistry {
+	return &leakRegistry{conns: make(map[net.Conn]struct{})}
+}
+
+func (r *leakRegistry) add(conn net.Conn) {
+	r.mu.Lock()
+	r.conns[conn] = struct{}{}
+	r.mu.Unlock()
+}
+
+// Active is the number of leaked connections still holding an FD.
+func (r *leakRegistry) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+// Reclaim closes every leaked connection and returns how many it closed.
+func (r *leakRegistry) Reclaim() int {
+	r.mu.Lock()
+	conns := r.conns
+	r.conns = make(map[net.Conn]struct{})
+	r.mu.Unlock()
+
+	for conn := range conns {
+		conn.Close()
+	}
+	return len(conns)
+}
+
+type reclaimResponse struct {
+	Reclaimed int `json:"reclaimed"`
+	Active    int `json:"active"`
+}
+
+// adminHandler serves POST /reclaim, which closes the leaked connections, and
+// GET /leaks, which only reports how many there are.
+func adminHandler(leaks *leakRegistry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /reclaim", func(w http.ResponseWriter, r *http.Request) {
+		n := leaks.Reclaim()
+		log.Printf("[LEAK] Reclaimed %d leaked connections", n)
+		writeJSON(w, reclaimResponse{Reclaimed: n, Active: leaks.Active()})
+	})
+	mux.HandleFunc("GET /leaks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, reclaimResponse{Active: leaks.Active()})
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
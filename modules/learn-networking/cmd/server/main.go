@@ -2,13 +2,18 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
 )
 
+// ADMIN_PORT serves /reclaim and /leaks while LEAK=true.
+const ADMIN_PORT = "8081"
+
 func main() {
 	port := "8080"
 	if p := os.Getenv("PORT"); p != "" {
@@ -21,7 +26,25 @@ func main() {
 	}
 	defer ln.Close()
 
-	log.Printf("TCP Echo Server listening on port %s", port)
+	handle := commandLines(defaultCommands)
+	if os.Getenv("PROTO") == "json" {
+		handle = jsonLine
+	}
+
+	// leaks is only set with LEAK=true; nil means connections are closed normally.
+	var leaks *leakRegistry
+	if os.Getenv("LEAK") == "true" {
+		leaks = newLeakRegistry()
+		adminPort := cmp.Or(os.Getenv("ADMIN_PORT"), ADMIN_PORT)
+		go func() {
+			log.Printf("[LEAK] Admin endpoint on port %s: POST /reclaim closes leaked FDs", adminPort)
+			if err := http.ListenAndServe(":"+adminPort, adminHandler(leaks)); err != nil {
+				log.Printf("Admin server stopped: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("TCP Echo Server listening on port %s (PROTO=%s)", port, cmp.Or(os.Getenv("PROTO"), "line"))
 
 	for {
 		conn, err := ln.Accept()
@@ -30,11 +53,22 @@ func main() {
 			continue
 		}
 
-		go handleConnection(conn)
+		go handleConnection(conn, handle, leaks)
 	}
 }
 
-func handleConnection(conn net.Conn) {
+// lineHandler turns one request line into one reply line. quit closes the
+// connection once the reply is written.
+type lineHandler func(line string) (reply string, quit bool)
+
+// echoLine is the plain-text fallback: anything that is not a command.
+func echoLine(line string) (string, bool) {
+	return "ECHO: " + line, false
+}
+
+// handleConnection serves conn until the client leaves. With a non-nil leaks
+// registry it instead abandons conn without closing it.
+func handleConnection(conn net.Conn, handle lineHandler, leaks *leakRegistry) {
 	// Intentional Leak for Experimentation
 
 	/*
@@ -45,9 +79,12 @@ func handleConnection(conn net.Conn) {
 		Because our server (in LEAK=true mode) returns from the function without calling conn.Close(), the File Descriptor stays open in the process table.
 		The Kernel cannot send the final FIN to finish the handshake because the application hasn't "given up" the socket yet.
 
+		The registry keeps a reference so POST /reclaim on the admin port can close them later.
+
 	*/
-	if os.Getenv("LEAK") == "true" {
+	if leaks != nil {
 		log.Printf("[LEAK] New connection from %s - NOT closing FD!", conn.RemoteAddr().String())
+		leaks.add(conn)
 		return // Function returns, but connection is NEVER closed
 	}
 
@@ -68,12 +105,15 @@ func handleConnection(conn net.Conn) {
 
 		fmt.Printf("[%s] Received: %s", remoteAddr, message)
 
-		// Echo back
-		_, err = conn.Write([]byte("ECHO: " + message))
+		reply, quit := handle(message)
+		_, err = conn.Write([]byte(reply))
 		if err != nil {
 			log.Printf("Error writing to %s: %v", remoteAddr, err)
 			break
 		}
+		if quit {
+			break
+		}
 	}
 
 	log.Printf("Connection closed: %s", remoteAddr)
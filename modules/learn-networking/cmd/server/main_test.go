@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialHandler runs handleConnection with handle on one end of a pipe and
+// returns the client end.
+func dialHandler(t *testing.T, handle lineHandler) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	client, server := net.Pipe()
+	go handleConnection(server, handle, nil)
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	return client, bufio.NewReader(client)
+}
+
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, line string) string {
+	t.Helper()
+	if _, err := fmt.Fprintln(conn, line); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestEchoProtocol(t *testing.T) {
+	conn, r := dialHandler(t, echoLine)
+	if got := roundTrip(t, conn, r, "hello"); got != "ECHO: hello\n" {
+		t.Errorf("reply = %q, want %q", got, "ECHO: hello\n")
+	}
+}
+
+func TestJSONProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantOK  bool
+		check   func(t *testing.T, resp jsonResponse)
+		wantEOF bool
+	}{
+		{
+			name:   "echo",
+			line:   `{"cmd":"echo","payload":"hi there"}`,
+			wantOK: true,
+			check: func(t *testing.T, resp jsonResponse) {
+				if resp.Result != "hi there" {
+					t.Errorf("result = %q, want %q", resp.Result, "hi there")
+				}
+			},
+		},
+		{
+			name:   "time",
+			line:   `{"cmd":"time"}`,
+			wantOK: true,
+			check: func(t *testing.T, resp jsonResponse) {
+				if _, err := time.Parse(time.RFC3339, resp.Result); err != nil {
+					t.Errorf("result %q is not RFC3339: %v", resp.Result, err)
+				}
+			},
+		},
+		{
+			name:   "unknown command",
+			line:   `{"cmd":"dance"}`,
+			wantOK: false,
+			check: func(t *testing.T, resp jsonResponse) {
+				if !strings.Contains(resp.Error, "unknown command") {
+					t.Errorf("error = %q, want an unknown command error", resp.Error)
+				}
+			},
+		},
+		{
+			name:   "malformed json",
+			line:   `{"cmd":`,
+			wantOK: false,
+			check: func(t *testing.T, resp jsonResponse) {
+				if !strings.HasPrefix(resp.Error, "malformed request") {
+					t.Errorf("error = %q, want a malformed request error", resp.Error)
+				}
+			},
+		},
+		{
+			name:    "quit",
+			line:    `{"cmd":"quit"}`,
+			wantOK:  true,
+			wantEOF: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, r := dialHandler(t, jsonLine)
+
+			var resp jsonResponse
+			if err := json.Unmarshal([]byte(roundTrip(t, conn, r, tt.line)), &resp); err != nil {
+				t.Fatalf("reply is not JSON: %v", err)
+			}
+			if resp.OK != tt.wantOK {
+				t.Errorf("ok = %v, want %v (%+v)", resp.OK, tt.wantOK, resp)
+			}
+			if tt.check != nil {
+				tt.check(t, resp)
+			}
+
+			if tt.wantEOF {
+				if _, err := r.ReadString('\n'); !errors.Is(err, io.EOF) {
+					t.Errorf("read after quit: %v, want EOF", err)
+				}
+				return
+			}
+			// Errors keep the connection usable.
+			if got := roundTrip(t, conn, r, `{"cmd":"echo","payload":"still here"}`); !strings.Contains(got, "still here") {
+				t.Errorf("follow-up reply = %q", got)
+			}
+		})
+	}
+}
+
+func TestCommandProtocol(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		want  string
+		check func(t *testing.T, reply string)
+	}{
+		{name: "ping", line: "PING", want: "PONG\n"},
+		{name: "upper", line: "UPPER hello world", want: "HELLO WORLD\n"},
+		{name: "lowercase verb", line: "ping", want: "PONG\n"},
+		{name: "mixed case verb", line: "Upper shout", want: "SHOUT\n"},
+		{name: "unknown verb echoes", line: "HELLO there", want: "ECHO: HELLO there\n"},
+		{name: "verb must be a whole word", line: "PINGPONG", want: "ECHO: PINGPONG\n"},
+		{
+			name: "time",
+			line: "TIME",
+			check: func(t *testing.T, reply string) {
+				if _, err := time.Parse(time.RFC3339, strings.TrimSuffix(reply, "\n")); err != nil {
+					t.Errorf("reply %q is not RFC3339: %v", reply, err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, r := dialHandler(t, commandLines(defaultCommands))
+			got := roundTrip(t, conn, r, tt.line)
+			if tt.check != nil {
+				tt.check(t, got)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandQuitClosesConnection(t *testing.T) {
+	conn, r := dialHandler(t, commandLines(defaultCommands))
+
+	if got := roundTrip(t, conn, r, "quit"); got != "BYE\n" {
+		t.Errorf("reply = %q, want %q", got, "BYE\n")
+	}
+	if _, err := r.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Errorf("read after QUIT: %v, want EOF", err)
+	}
+}
+
+func TestCommandsAreExtensible(t *testing.T) {
+	cmds := map[string]HandlerFunc{
+		"REVERSE": func(args string) (string, bool) {
+			r := []rune(args)
+			slices.Reverse(r)
+			return string(r), false
+		},
+	}
+	conn, r := dialHandler(t, commandLines(cmds))
+
+	if got := roundTrip(t, conn, r, "reverse abc"); got != "cba\n" {
+		t.Errorf("reply = %q, want %q", got, "cba\n")
+	}
+}
+
+func TestReclaimLeakedConnections(t *testing.T) {
+	const n = 3
+	leaks := newLeakRegistry()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleConnection(conn, echoLine, leaks)
+		}
+	}()
+
+	clients := make([]net.Conn, n)
+	for i := range clients {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients[i] = c
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for leaks.Active() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked %d connections, want %d", leaks.Active(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	admin := httptest.NewServer(adminHandler(leaks))
+	defer admin.Close()
+
+	resp, err := http.Post(admin.URL+"/reclaim", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got reclaimResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Reclaimed != n || got.Active != 0 {
+		t.Errorf("reclaim = %+v, want %d reclaimed and 0 active", got, n)
+	}
+	if leaks.Active() != 0 {
+		t.Errorf("active = %d after reclaim, want 0", leaks.Active())
+	}
+
+	// The server side is closed now, so every client sees EOF.
+	for i, c := range clients {
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := c.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Errorf("client %d: read err = %v, want EOF", i, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	AUTOSCALE_INTERVAL   = 500 * time.Millisecond
+	AUTOSCALE_HIGH_WATER = 100 // queue depth that triggers a scale up
+	AUTOSCALE_LOW_WATER  = 10  // queue depth below which the pool may shrink
+
+	// AUTOSCALE_SHRINK_AFTER is how many consecutive low samples it takes to
+	// shrink, so a queue that dips between bursts does not make the pool flap.
+	AUTOSCALE_SHRINK_AFTER = 4
+)
+
+type autoscaleConfig struct {
+	Min, Max    int
+	Interval    time.Duration
+	HighWater   int
+	LowWater    int
+	ShrinkAfter int
+}
+
+// autoscaler resizes a workerPool from queue depth. Growth doubles the pool
+// as soon as one sample is above HighWater; shrinking halves it only after
+// ShrinkAfter samples in a row below LowWater. The gap between the two marks
+// plus the streak is the hysteresis that keeps it from oscillating.
+type autoscaler struct {
+	cfg   autoscaleConfig
+	pool  *workerPool
+	depth func() int
+
+	lowStreak int
+}
+
+func newAutoscaler(cfg autoscaleConfig, pool *workerPool, depth func() int) *autoscaler {
+	return &autoscaler{cfg: cfg, pool: pool, depth: depth}
+}
+
+// Run samples every cfg.Interval until ctx is done.
+func (a *autoscaler) Run(ctx context.Context) {
+	t := time.NewTicker(a.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			a.step()
+		}
+	}
+}
+
+// step takes one depth sample and resizes the pool if it calls for it.
+func (a *autoscaler) step() {
+	depth := a.depth()
+	size := a.pool.Size()
+
+	switch {
+	case depth > a.cfg.HighWater:
+		a.lowStreak = 0
+		if next := min(max(size*2, 1), a.cfg.Max); next != size {
+			log.Printf("autoscale: queue depth %d, growing workers %d -> %d", depth, size, next)
+			a.pool.Resize(next)
+		}
+	case depth < a.cfg.LowWater:
+		a.lowStreak++
+		if a.lowStreak < a.cfg.ShrinkAfter {
+			return
+		}
+		a.lowStreak = 0
+		if next := max(size/2, a.cfg.Min); next != size {
+			log.Printf("autoscale: queue depth %d, shrinking workers %d -> %d", depth, size, next)
+			a.pool.Resize(next)
+		}
+	default:
+		a.lowStreak = 0
+	}
+}
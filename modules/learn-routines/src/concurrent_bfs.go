@@ -2,22 +2,50 @@ package main
 
 import (
 	"container/list"
-	"sync"
+	"context"
+	"shared/pool"
 )
 
-type reachableNode struct {
-	node  int
-	neigh []int
+// ctxCheckInterval is how many dequeued nodes travel processes between
+// cancellation checks, keeping ctx.Err() off the hot path.
+const ctxCheckInterval = 256
+
+// solveFunc answers one query. It returns false if ctx was cancelled before
+// the answer was complete.
+type solveFunc[R any] func(ctx context.Context, startNode int) (R, bool)
+
+// answer is one query's result; ok is false for a query cut off by ctx.
+type answer[R any] struct {
+	value R
+	ok    bool
 }
 
-func process(graph map[int][]int, jobs <-chan int, resultBFS chan reachableNode) {
-	for startNode := range jobs {
-		reachableNode := travel(graph, startNode)
-		resultBFS <- reachableNode
+// runQueries is the fan-out shared by the concurrent graph queries: it runs
+// solve for every start node on numWorkers goroutines via pool.Run and keeps
+// the answers that completed.
+func runQueries[R any](ctx context.Context, queries []int, numWorkers int, solve solveFunc[R]) map[int]R {
+	// A cancelled query reports ctx.Err(), which also stops pool.Run from
+	// starting the rest; the answers already in hand are kept either way.
+	answers, _ := pool.Run(ctx, queries, numWorkers, func(ctx context.Context, startNode int) (answer[R], error) {
+		value, ok := solve(ctx, startNode)
+		if !ok {
+			return answer[R]{}, ctx.Err()
+		}
+		return answer[R]{value: value, ok: true}, nil
+	})
+
+	resultMap := make(map[int]R)
+	for i, a := range answers {
+		if a.ok {
+			resultMap[queries[i]] = a.value
+		}
 	}
+	return resultMap
 }
 
-func travel(graph map[int][]int, startNode int) reachableNode {
+// travel runs a BFS from startNode and returns the visitation order. The start
+// node is always visited, even if graph has no entry for it.
+func travel(ctx context.Context, graph map[int][]int, startNode int) ([]int, bool) {
 	visited := make(map[int]bool)
 
 	list := list.New()
@@ -26,7 +54,10 @@ func travel(graph map[int][]int, startNode int) reachableNode {
 	list.PushBack(startNode)
 	visited[startNode] = true
 
-	for list.Len() > 0 {
+	for steps := 0; list.Len() > 0; steps++ {
+		if steps%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, false
+		}
 
 		node := list.Front().Value.(int)
 		list.Remove(list.Front())
@@ -41,63 +72,65 @@ func travel(graph map[int][]int, startNode int) reachableNode {
 		}
 	}
 
-	return reachableNode{
-		node:  startNode,
-		neigh: order,
+	return order, true
+}
+
+// distances runs a BFS from startNode and records the hop count to every
+// reachable node. Unreachable nodes are absent from the map.
+func distances(ctx context.Context, graph map[int][]int, startNode int) (map[int]int, bool) {
+	dist := map[int]int{startNode: 0}
+	queue := []int{startNode}
+
+	for steps := 0; len(queue) > 0; steps++ {
+		if steps%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, false
+		}
+
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, neigh := range graph[node] {
+			if _, seen := dist[neigh]; !seen {
+				dist[neigh] = dist[node] + 1
+				queue = append(queue, neigh)
+			}
+		}
 	}
+
+	return dist, true
 }
 
 // ConcurrentBFSQueries concurrently processes BFS queries on the provided graph.
+// - ctx: cancelling it stops the workers early.
 // - graph: adjacency list, e.g., graph[u] = []int{v1, v2, ...}
 // - queries: a list of starting nodes for BFS.
 // - numWorkers: how many goroutines can process BFS queries simultaneously.
 //
 // Return a map from the query (starting node) to the BFS order as a slice of nodes.
+// A start node that is absent from the graph (including an empty graph) has
+// no edges to follow, so its result is just []int{node}.
+// If ctx is cancelled, queries that had not finished are left out of the map;
+// check ctx.Err() to tell a partial result from a complete one.
 // YOU MUST use concurrency (goroutines + channels) to pass the performance tests.
-func ConcurrentBFSQueries(graph map[int][]int, queries []int, numWorkers int) map[int][]int {
+func ConcurrentBFSQueries(ctx context.Context, graph map[int][]int, queries []int, numWorkers int) map[int][]int {
 	if numWorkers == 0 || len(queries) == 0 {
 		return map[int][]int{}
 	}
 
-	if len(graph) == 0 {
-		finalResult := make(map[int][]int)
-		for _, startNode := range queries {
-			finalResult[startNode] = []int{startNode}
-		}
-		return finalResult
-	}
-
-	jobs := make(chan int, len(queries))
-
-	resultBFS := make(chan reachableNode, len(queries))
-	defer close(resultBFS)
-
-	var wg sync.WaitGroup
-
-	for range numWorkers {
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			process(graph, jobs, resultBFS)
-		}()
-
-	}
-
-	go func() {
-		for _, startNode := range queries {
-			jobs <- startNode
-		}
-		close(jobs)
-	}()
-
-	wg.Wait()
+	return runQueries(ctx, queries, numWorkers, func(ctx context.Context, startNode int) ([]int, bool) {
+		return travel(ctx, graph, startNode)
+	})
+}
 
-	resultMap := make(map[int][]int)
-	for range queries {
-		result := <-resultBFS
-		resultMap[result.node] = result.neigh
+// ConcurrentBFSDistances runs one BFS per query across numWorkers goroutines
+// and returns, per start node, the hop distance to every node reachable from it.
+// The start node itself is at distance 0; unreachable nodes are absent.
+func ConcurrentBFSDistances(graph map[int][]int, queries []int, numWorkers int) map[int]map[int]int {
+	if numWorkers == 0 || len(queries) == 0 {
+		return map[int]map[int]int{}
 	}
 
-	return resultMap
+	return runQueries(context.Background(), queries, numWorkers, func(ctx context.Context, startNode int) (map[int]int, bool) {
+		return distances(ctx, graph, startNode)
+	})
 }
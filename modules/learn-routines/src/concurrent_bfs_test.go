@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"reflect"
 	"sync"
 	"testing"
@@ -114,7 +115,7 @@ func TestBasicFunctionality(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			results := ConcurrentBFSQueries(tc.graph, tc.queries, tc.numWorkers)
+			results := ConcurrentBFSQueries(context.Background(), tc.graph, tc.queries, tc.numWorkers)
 
 			if len(results) != len(tc.queries) {
 				t.Errorf("Expected %d results, got %d", len(tc.queries), len(results))
@@ -135,7 +136,7 @@ func TestEdgeCases(t *testing.T) {
 	t.Run("Zero workers", func(t *testing.T) {
 		graph := buildSampleGraph()
 		queries := []int{0, 1}
-		results := ConcurrentBFSQueries(graph, queries, 0)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 0)
 		if len(results) != 0 {
 			t.Errorf("Expected empty results when numWorkers=0, but got %v", results)
 		}
@@ -144,7 +145,7 @@ func TestEdgeCases(t *testing.T) {
 	t.Run("Empty graph", func(t *testing.T) {
 		graph := map[int][]int{}
 		queries := []int{0}
-		results := ConcurrentBFSQueries(graph, queries, 1)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 1)
 		if len(results) != 1 || len(results[0]) != 1 || results[0][0] != 0 {
 			t.Errorf("Expected [0] for isolated node, got %v", results[0])
 		}
@@ -156,7 +157,7 @@ func TestEdgeCases(t *testing.T) {
 			1: {},
 		}
 		queries := []int{0}
-		results := ConcurrentBFSQueries(graph, queries, 1)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 1)
 		expected := []int{0, 1}
 		if !reflect.DeepEqual(results[0], expected) {
 			t.Errorf("Expected %v for self-loop graph, got %v", expected, results[0])
@@ -174,7 +175,7 @@ func TestEdgeCases(t *testing.T) {
 
 		queries := []int{0, 2, 4}
 		numWorkers := 3
-		results := ConcurrentBFSQueries(graph, queries, numWorkers)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, numWorkers)
 
 		expectedResults := map[int][]int{
 			0: {0, 1},
@@ -201,11 +202,11 @@ func TestConcurrencyRequirement(t *testing.T) {
 
 		// Test with different worker counts
 		start1 := time.Now()
-		_ = ConcurrentBFSQueries(graph, queries, 1)
+		_ = ConcurrentBFSQueries(context.Background(), graph, queries, 1)
 		duration1 := time.Since(start1)
 
 		start10 := time.Now()
-		_ = ConcurrentBFSQueries(graph, queries, 10)
+		_ = ConcurrentBFSQueries(context.Background(), graph, queries, 10)
 		duration10 := time.Since(start10)
 
 		// With more workers, it should be significantly faster (allowing for some variance)
@@ -224,7 +225,7 @@ func TestPerformanceRequirement(t *testing.T) {
 		numWorkers := 4
 
 		start := time.Now()
-		results := ConcurrentBFSQueries(graph, queries, numWorkers)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, numWorkers)
 		duration := time.Since(start)
 
 		// Should complete within reasonable time (1 second is generous)
@@ -250,12 +251,12 @@ func TestPerformanceRequirement(t *testing.T) {
 
 		// Measure sequential time (using 1 worker)
 		start := time.Now()
-		_ = ConcurrentBFSQueries(graph, queries, 1)
+		_ = ConcurrentBFSQueries(context.Background(), graph, queries, 1)
 		sequentialTime := time.Since(start)
 
 		// Measure concurrent time (using multiple workers)
 		start = time.Now()
-		_ = ConcurrentBFSQueries(graph, queries, 4)
+		_ = ConcurrentBFSQueries(context.Background(), graph, queries, 4)
 		concurrentTime := time.Since(start)
 
 		t.Logf("Sequential time: %v, Concurrent time: %v", sequentialTime, concurrentTime)
@@ -278,7 +279,7 @@ func TestStressTest(t *testing.T) {
 		}
 
 		start := time.Now()
-		results := ConcurrentBFSQueries(graph, queries, 10)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 10)
 		duration := time.Since(start)
 
 		if duration > 500*time.Millisecond {
@@ -306,7 +307,7 @@ func TestStressTest(t *testing.T) {
 			wg.Add(1)
 			go func(idx int) {
 				defer wg.Done()
-				results[idx] = ConcurrentBFSQueries(graph, queries, numWorkers)
+				results[idx] = ConcurrentBFSQueries(context.Background(), graph, queries, numWorkers)
 			}(i)
 		}
 
@@ -338,7 +339,7 @@ func TestCorrectnessWithComplexGraphs(t *testing.T) {
 		}
 
 		queries := []int{0, 5, 9}
-		results := ConcurrentBFSQueries(graph, queries, 3)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 3)
 
 		// Verify all results contain all nodes (since graph is fully connected)
 		for _, query := range queries {
@@ -366,7 +367,7 @@ func TestCorrectnessWithComplexGraphs(t *testing.T) {
 		}
 
 		queries := []int{0, 1, 2}
-		results := ConcurrentBFSQueries(graph, queries, 2)
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 2)
 
 		// Verify BFS order for tree traversal
 		expectedResults := map[int][]int{
@@ -382,3 +383,186 @@ func TestCorrectnessWithComplexGraphs(t *testing.T) {
 		}
 	})
 }
+
+func TestContextCancellation(t *testing.T) {
+	t.Run("Canceled context returns early", func(t *testing.T) {
+		graph := buildLargeLinearGraph(100000)
+		queries := make([]int, 200)
+		for i := range queries {
+			queries[i] = i
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		results := ConcurrentBFSQueries(ctx, graph, queries, 4)
+		duration := time.Since(start)
+
+		if duration > 100*time.Millisecond {
+			t.Errorf("Canceled query took %v, expected an early return", duration)
+		}
+		if len(results) != 0 {
+			t.Errorf("Expected no results for a pre-canceled context, got %d", len(results))
+		}
+	})
+
+	t.Run("Deadline mid-run returns partial results", func(t *testing.T) {
+		graph := buildLargeLinearGraph(100000)
+		queries := make([]int, 500)
+		for i := range queries {
+			queries[i] = i
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		results := ConcurrentBFSQueries(ctx, graph, queries, 4)
+		duration := time.Since(start)
+
+		if duration > 2*time.Second {
+			t.Errorf("Query ignored the deadline, took %v", duration)
+		}
+		if len(results) >= len(queries) {
+			t.Errorf("Expected partial results, got all %d", len(results))
+		}
+		for start, order := range results {
+			if !reflect.DeepEqual(order, bfsReference(graph, start)) {
+				t.Errorf("Partial result for %d is not a complete BFS", start)
+			}
+		}
+	})
+
+	t.Run("Large graph correctness", func(t *testing.T) {
+		graph := buildLargeLinearGraph(5000)
+		for i := 0; i < 5000; i += 7 {
+			graph[i] = append(graph[i], (i*31)%5000)
+		}
+		queries := []int{0, 17, 1234, 2500, 4999}
+
+		results := ConcurrentBFSQueries(context.Background(), graph, queries, 3)
+		for _, start := range queries {
+			if !reflect.DeepEqual(results[start], bfsReference(graph, start)) {
+				t.Errorf("Large graph BFS from %d does not match reference", start)
+			}
+		}
+	})
+}
+
+func TestBFSDistances(t *testing.T) {
+	t.Run("Known graph", func(t *testing.T) {
+		graph := buildSampleGraph()
+		results := ConcurrentBFSDistances(graph, []int{0, 3, 5}, 2)
+
+		expected := map[int]map[int]int{
+			0: {0: 0, 1: 1, 2: 1, 3: 2, 4: 3},
+			3: {3: 0, 4: 1},
+			5: {5: 0, 2: 1, 3: 2, 4: 3},
+		}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+	})
+
+	t.Run("Unreachable nodes are absent", func(t *testing.T) {
+		graph := map[int][]int{
+			0: {1},
+			1: {},
+			2: {0},
+		}
+		results := ConcurrentBFSDistances(graph, []int{0}, 1)
+		if _, ok := results[0][2]; ok {
+			t.Errorf("Node 2 is unreachable from 0 but has distance %d", results[0][2])
+		}
+	})
+
+	t.Run("Zero workers", func(t *testing.T) {
+		if results := ConcurrentBFSDistances(buildSampleGraph(), []int{0}, 0); len(results) != 0 {
+			t.Errorf("Expected empty results when numWorkers=0, got %v", results)
+		}
+	})
+
+	t.Run("Concurrency does not corrupt results", func(t *testing.T) {
+		graph := buildLargeLinearGraph(1000)
+		queries := make([]int, 200)
+		for i := range queries {
+			queries[i] = i * 5
+		}
+
+		results := ConcurrentBFSDistances(graph, queries, 8)
+		if len(results) != len(queries) {
+			t.Fatalf("Expected %d results, got %d", len(queries), len(results))
+		}
+		for _, start := range queries {
+			dist := results[start]
+			if len(dist) != 1000-start {
+				t.Errorf("Start %d: expected %d reachable nodes, got %d", start, 1000-start, len(dist))
+				continue
+			}
+			for node, d := range dist {
+				if d != node-start {
+					t.Errorf("Start %d: distance to %d = %d, want %d", start, node, d, node-start)
+					break
+				}
+			}
+		}
+	})
+}
+
+func TestMissingNodeSemantics(t *testing.T) {
+	t.Run("Missing query nodes in a non-empty graph", func(t *testing.T) {
+		graph := buildSampleGraph()
+		results := ConcurrentBFSQueries(context.Background(), graph, []int{0, 42, -1}, 2)
+
+		expected := map[int][]int{
+			0:  {0, 1, 2, 3, 4},
+			42: {42},
+			-1: {-1},
+		}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+	})
+
+	t.Run("Missing node matches empty-graph behavior", func(t *testing.T) {
+		empty := ConcurrentBFSQueries(context.Background(), map[int][]int{}, []int{7}, 1)
+		nonEmpty := ConcurrentBFSQueries(context.Background(), buildSampleGraph(), []int{7}, 1)
+		if !reflect.DeepEqual(empty, nonEmpty) {
+			t.Errorf("Empty graph gave %v, non-empty graph gave %v", empty, nonEmpty)
+		}
+	})
+
+	t.Run("Edge to a node without an entry", func(t *testing.T) {
+		graph := map[int][]int{0: {9}}
+		results := ConcurrentBFSQueries(context.Background(), graph, []int{0, 9}, 2)
+
+		expected := map[int][]int{0: {0, 9}, 9: {9}}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+	})
+
+	t.Run("Self-loop only", func(t *testing.T) {
+		graph := map[int][]int{3: {3}}
+		results := ConcurrentBFSQueries(context.Background(), graph, []int{3}, 1)
+		if !reflect.DeepEqual(results[3], []int{3}) {
+			t.Errorf("Expected [3], got %v", results[3])
+		}
+	})
+
+	t.Run("Disconnected components with a missing query", func(t *testing.T) {
+		graph := map[int][]int{
+			0: {1},
+			1: {0},
+			2: {3},
+			3: {2},
+		}
+		results := ConcurrentBFSQueries(context.Background(), graph, []int{1, 3, 5}, 3)
+
+		expected := map[int][]int{1: {1, 0}, 3: {3, 2}, 5: {5}}
+		if !reflect.DeepEqual(results, expected) {
+			t.Errorf("Expected %v, got %v", expected, results)
+		}
+	})
+}
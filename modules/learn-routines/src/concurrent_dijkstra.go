@@ -0,0 +1,74 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+)
+
+// WeightedEdge is a directed edge to To with a non-negative Cost.
+type WeightedEdge struct {
+	To   int
+	Cost int
+}
+
+type distItem struct {
+	node int
+	dist int
+}
+
+// distHeap is a min-heap on tentative distance.
+type distHeap []distItem
+
+func (h distHeap) Len() int           { return len(h) }
+func (h distHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h distHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *distHeap) Push(x any)        { *h = append(*h, x.(distItem)) }
+func (h *distHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// dijkstra computes the cheapest cost from startNode to every reachable node.
+// Stale heap entries are skipped lazily instead of using decrease-key.
+func dijkstra(ctx context.Context, graph map[int][]WeightedEdge, startNode int) (map[int]int, bool) {
+	dist := map[int]int{startNode: 0}
+	done := make(map[int]bool)
+	h := &distHeap{{node: startNode, dist: 0}}
+
+	for steps := 0; h.Len() > 0; steps++ {
+		if steps%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return nil, false
+		}
+
+		cur := heap.Pop(h).(distItem)
+		if done[cur.node] {
+			continue
+		}
+		done[cur.node] = true
+
+		for _, e := range graph[cur.node] {
+			next := cur.dist + e.Cost
+			if d, seen := dist[e.To]; !seen || next < d {
+				dist[e.To] = next
+				heap.Push(h, distItem{node: e.To, dist: next})
+			}
+		}
+	}
+
+	return dist, true
+}
+
+// ConcurrentDijkstra runs one Dijkstra per query across numWorkers goroutines
+// and returns, per start node, the shortest-path cost to every reachable node.
+// Edge costs must be non-negative; unreachable nodes are absent.
+func ConcurrentDijkstra(graph map[int][]WeightedEdge, queries []int, numWorkers int) map[int]map[int]int {
+	if numWorkers == 0 || len(queries) == 0 {
+		return map[int]map[int]int{}
+	}
+
+	return runQueries(context.Background(), queries, numWorkers, func(ctx context.Context, startNode int) (map[int]int, bool) {
+		return dijkstra(ctx, graph, startNode)
+	})
+}
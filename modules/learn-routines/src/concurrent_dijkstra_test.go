@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// dijkstraReference is a naive O(V^2) single-threaded Dijkstra over nodes 0..n-1.
+func dijkstraReference(graph map[int][]WeightedEdge, n, start int) map[int]int {
+	dist := make([]int, n)
+	for i := range dist {
+		dist[i] = math.MaxInt
+	}
+	dist[start] = 0
+	done := make([]bool, n)
+
+	for range n {
+		u := -1
+		for v := 0; v < n; v++ {
+			if !done[v] && dist[v] != math.MaxInt && (u == -1 || dist[v] < dist[u]) {
+				u = v
+			}
+		}
+		if u == -1 {
+			break
+		}
+		done[u] = true
+		for _, e := range graph[u] {
+			if dist[u]+e.Cost < dist[e.To] {
+				dist[e.To] = dist[u] + e.Cost
+			}
+		}
+	}
+
+	result := make(map[int]int)
+	for v, d := range dist {
+		if d != math.MaxInt {
+			result[v] = d
+		}
+	}
+	return result
+}
+
+func buildRandomWeightedGraph(r *rand.Rand, nodes, edges, maxCost int) map[int][]WeightedEdge {
+	graph := make(map[int][]WeightedEdge)
+	for range edges {
+		from, to := r.Intn(nodes), r.Intn(nodes)
+		graph[from] = append(graph[from], WeightedEdge{To: to, Cost: r.Intn(maxCost + 1)})
+	}
+	return graph
+}
+
+func TestDijkstraKnownGraph(t *testing.T) {
+	// 0 -1-> 1 -1-> 2, plus a direct but expensive 0 -5-> 2; 3 is unreachable.
+	graph := map[int][]WeightedEdge{
+		0: {{To: 1, Cost: 1}, {To: 2, Cost: 5}},
+		1: {{To: 2, Cost: 1}},
+		3: {{To: 0, Cost: 1}},
+	}
+
+	results := ConcurrentDijkstra(graph, []int{0, 3}, 2)
+	expected := map[int]map[int]int{
+		0: {0: 0, 1: 1, 2: 2},
+		3: {3: 0, 0: 1, 1: 2, 2: 3},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func TestDijkstraMatchesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	for trial := range 20 {
+		nodes := 20 + r.Intn(80)
+		graph := buildRandomWeightedGraph(r, nodes, nodes*4, 50)
+
+		queries := make([]int, nodes)
+		for i := range queries {
+			queries[i] = i
+		}
+
+		results := ConcurrentDijkstra(graph, queries, 8)
+		for _, start := range queries {
+			want := dijkstraReference(graph, nodes, start)
+			if !reflect.DeepEqual(results[start], want) {
+				t.Fatalf("Trial %d, start %d: expected %v, got %v", trial, start, want, results[start])
+			}
+		}
+	}
+}
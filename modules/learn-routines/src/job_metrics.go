@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobType = "default"
+	otherJobType   = "other"
+)
+
+// knownJobTypes are the Job.Type values recorded as-is. The type comes straight
+// from the client, so anything else is bucketed into "other" to keep the
+// metrics' cardinality bounded.
+var knownJobTypes = map[string]bool{
+	"email":  true,
+	"report": true,
+}
+
+// jobTypeLabel maps a client-supplied Job.Type onto a bounded label set.
+func jobTypeLabel(jobType string) string {
+	switch {
+	case jobType == "":
+		return defaultJobType
+	case knownJobTypes[jobType]:
+		return jobType
+	default:
+		return otherJobType
+	}
+}
+
+// latencyBuckets are the upper bounds of the per-type processing histogram.
+// Anything slower lands in the implicit +Inf bucket.
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+type typeMetrics struct {
+	success uint64
+	failure uint64
+	buckets []uint64 // len(latencyBuckets)+1, last one is +Inf
+	sum     time.Duration
+}
+
+// TypeSnapshot is the JSON view of one job type's counters. LatencyBuckets is
+// cumulative (Prometheus style), keyed by the bucket's upper bound.
+type TypeSnapshot struct {
+	Success        uint64            `json:"success"`
+	Failure        uint64            `json:"failure"`
+	LatencyBuckets map[string]uint64 `json:"latency_buckets"`
+	LatencySum     float64           `json:"latency_sum_seconds"`
+}
+
+// jobMetrics tracks success/failure counts and latency per Job.Type.
+type jobMetrics struct {
+	mu     sync.Mutex
+	byType map[string]*typeMetrics
+}
+
+func newJobMetrics() *jobMetrics {
+	return &jobMetrics{byType: make(map[string]*typeMetrics)}
+}
+
+func (m *jobMetrics) observe(jobType string, latency time.Duration, err error) {
+	jobType = jobTypeLabel(jobType)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tm, ok := m.byType[jobType]
+	if !ok {
+		tm = &typeMetrics{buckets: make([]uint64, len(latencyBuckets)+1)}
+		m.byType[jobType] = tm
+	}
+
+	if err != nil {
+		tm.failure++
+	} else {
+		tm.success++
+	}
+
+	i, _ := slices.BinarySearch(latencyBuckets, latency)
+	tm.buckets[i]++
+	tm.sum += latency
+}
+
+func (m *jobMetrics) snapshot() map[string]TypeSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]TypeSnapshot, len(m.byType))
+	for jobType, tm := range m.byType {
+		buckets := make(map[string]uint64, len(tm.buckets))
+		var cumulative uint64
+		for i, n := range tm.buckets {
+			cumulative += n
+			buckets[bucketLabel(i)] = cumulative
+		}
+		out[jobType] = TypeSnapshot{
+			Success:        tm.success,
+			Failure:        tm.failure,
+			LatencyBuckets: buckets,
+			LatencySum:     tm.sum.Seconds(),
+		}
+	}
+	return out
+}
+
+// writePrometheus renders the metrics in the Prometheus text exposition format.
+func (m *jobMetrics) writePrometheus(w io.Writer) {
+	snap := m.snapshot()
+	types := make([]string, 0, len(snap))
+	for jobType := range snap {
+		types = append(types, jobType)
+	}
+	slices.Sort(types)
+
+	fmt.Fprintln(w, "# HELP jobs_processed_total Jobs processed, by type and result.")
+	fmt.Fprintln(w, "# TYPE jobs_processed_total counter")
+	for _, jobType := range types {
+		fmt.Fprintf(w, "jobs_processed_total{type=%q,result=\"success\"} %d\n", jobType, snap[jobType].Success)
+		fmt.Fprintf(w, "jobs_processed_total{type=%q,result=\"failure\"} %d\n", jobType, snap[jobType].Failure)
+	}
+
+	fmt.Fprintln(w, "# HELP job_latency_seconds Job processing latency, including retries.")
+	fmt.Fprintln(w, "# TYPE job_latency_seconds histogram")
+	for _, jobType := range types {
+		s := snap[jobType]
+		for i := range len(latencyBuckets) + 1 {
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = fmt.Sprint(latencyBuckets[i].Seconds())
+			}
+			fmt.Fprintf(w, "job_latency_seconds_bucket{type=%q,le=%q} %d\n", jobType, le, s.LatencyBuckets[bucketLabel(i)])
+		}
+		fmt.Fprintf(w, "job_latency_seconds_sum{type=%q} %g\n", jobType, s.LatencySum)
+		fmt.Fprintf(w, "job_latency_seconds_count{type=%q} %d\n", jobType, s.Success+s.Failure)
+	}
+}
+
+func bucketLabel(i int) string {
+	if i >= len(latencyBuckets) {
+		return "+Inf"
+	}
+	return latencyBuckets[i].String()
+}
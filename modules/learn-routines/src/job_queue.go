@@ -0,0 +1,247 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	FEED_INTERVAL = 100 * time.Millisecond
+
+	// AGING_INTERVAL is how long a job must wait to gain one priority level,
+	// so a steady stream of urgent jobs cannot starve the backlog forever.
+	AGING_INTERVAL = 1 * time.Second
+)
+
+var (
+	ErrQueueFull = errors.New("queue full")
+	ErrDraining  = errors.New("draining, not accepting new jobs")
+	ErrClosing   = errors.New("shutting down, not accepting new jobs")
+)
+
+type queuedItem struct {
+	job   Job
+	score int64 // Priority*AGING_INTERVAL - enqueue time; higher runs first
+	seq   uint64
+}
+
+// jobHeap is a max-heap on score. Because every waiting job ages at the same
+// rate, comparing scores fixed at enqueue time is equivalent to comparing
+// their aged priorities at any later instant.
+type jobHeap []queuedItem
+
+func (h jobHeap) Len() int { return len(h) }
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x any)   { *h = append(*h, x.(queuedItem)) }
+func (h *jobHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// jobQueue is what /submitX feeds. Submitted jobs wait in a bounded priority
+// heap and a dispatcher goroutine hands the best one to the next free worker
+// over ch. With a store, submissions are persisted first and a feeder goroutine
+// claims them into the heap as room frees up; size then bounds the stored
+// backlog plus the heap, so a full queue still answers ErrQueueFull.
+type jobQueue struct {
+	ch    chan Job
+	store *jobStore
+	size  int
+	aging time.Duration
+
+	mu      sync.Mutex
+	pending jobHeap
+	seq     uint64
+	closed  bool
+
+	draining atomic.Bool
+	closing  atomic.Bool
+
+	wake       chan struct{} // heap gained an item, or the queue closed
+	notify     chan struct{} // store gained a row
+	feederDone chan struct{}
+}
+
+func newJobQueue(size int, store *jobStore) *jobQueue {
+	return &jobQueue{
+		ch:         make(chan Job),
+		store:      store,
+		size:       size,
+		aging:      AGING_INTERVAL,
+		wake:       make(chan struct{}, 1),
+		notify:     make(chan struct{}, 1),
+		feederDone: make(chan struct{}),
+	}
+}
+
+// Start launches the dispatcher, plus the feeder when the queue is persistent.
+// The feeder stops once ctx is done; Close waits for it before shutting intake.
+func (q *jobQueue) Start(ctx context.Context) {
+	go q.dispatch()
+	if q.store == nil {
+		close(q.feederDone)
+		return
+	}
+	go q.feed(ctx)
+}
+
+func (q *jobQueue) Submit(ctx context.Context, j Job) error {
+	if q.closing.Load() {
+		return ErrClosing
+	}
+	if q.draining.Load() {
+		return ErrDraining
+	}
+	if q.store == nil {
+		return q.push(j)
+	}
+
+	// Whatever the feeder already moved into the heap counts against size too.
+	if err := q.store.EnqueueWithin(ctx, j, q.size-q.Len()); err != nil {
+		return err
+	}
+	wakeup(q.notify)
+	return nil
+}
+
+// Len is the number of jobs waiting in memory for a worker.
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Depth is the whole backlog: the jobs waiting in memory plus, in persistent
+// mode, the rows still pending in the store. It is what /metrics reports and
+// the autoscaler watches.
+func (q *jobQueue) Depth() int {
+	n := q.Len()
+	if q.store == nil {
+		return n
+	}
+	pending, err := q.store.Pending(context.Background())
+	if err != nil {
+		log.Print("pending count failed:", err.Error())
+		return n
+	}
+	return n + int(pending)
+}
+
+// Drain stops accepting submissions while everything already queued (and, in
+// persistent mode, already stored) keeps flowing to the workers.
+func (q *jobQueue) Drain() {
+	q.draining.Store(true)
+}
+
+func (q *jobQueue) Draining() bool {
+	return q.draining.Load()
+}
+
+// StopIntake makes every later Submit fail with ErrClosing. Unlike Drain it is
+// one-way: it is the first step of shutting the process down.
+func (q *jobQueue) StopIntake() {
+	q.closing.Store(true)
+}
+
+// Close stops intake; the dispatcher hands out what is left and then closes
+// ch so workers drain and exit.
+func (q *jobQueue) Close() {
+	q.StopIntake()
+	<-q.feederDone
+
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	wakeup(q.wake)
+}
+
+func (q *jobQueue) push(j Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || len(q.pending) >= q.size {
+		return ErrQueueFull
+	}
+	q.seq++
+	heap.Push(&q.pending, queuedItem{
+		job:   j,
+		score: int64(j.Priority)*int64(q.aging) - time.Now().UnixNano(),
+		seq:   q.seq,
+	})
+	wakeup(q.wake)
+	return nil
+}
+
+func (q *jobQueue) dispatch() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			closed := q.closed
+			q.mu.Unlock()
+			if closed {
+				close(q.ch)
+				return
+			}
+			<-q.wake
+			continue
+		}
+		item := heap.Pop(&q.pending).(queuedItem)
+		q.mu.Unlock()
+
+		q.ch <- item.job
+	}
+}
+
+func (q *jobQueue) feed(ctx context.Context) {
+	defer close(q.feederDone)
+
+	ticker := time.NewTicker(FEED_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		// The feeder is the only producer in persistent mode, so the free
+		// slots cannot be taken by anyone else between Claim and push.
+		if free := q.size - q.Len(); free > 0 {
+			jobs, err := q.store.Claim(ctx, free)
+			if err != nil && ctx.Err() == nil {
+				log.Print("claim failed:", err.Error())
+			}
+			for _, j := range jobs {
+				if err := q.push(j); err != nil {
+					log.Print("failed to queue claimed job:", err.Error())
+				}
+			}
+			if len(jobs) == free {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// wakeup does a non-blocking send on a 1-buffered wake-up channel.
+func wakeup(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
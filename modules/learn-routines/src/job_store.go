@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	statusPending = "pending"
+	statusClaimed = "claimed"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// QueuedJob is the durable row behind a submitted Job.
+type QueuedJob struct {
+	ID        uint `gorm:"primaryKey"`
+	JobID     int
+	Type      string
+	Priority  int
+	Data      string
+	Status    string `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (q QueuedJob) toJob() Job {
+	return Job{ID: q.JobID, Type: q.Type, Priority: q.Priority, Data: q.Data, rowID: q.ID}
+}
+
+// jobStore persists submitted jobs so a crash does not lose the backlog.
+// Rows move pending -> claimed -> done/failed; anything still claimed at
+// startup was in flight when the process died and is put back to pending.
+type jobStore struct {
+	db *gorm.DB
+}
+
+func newJobStore(path string) (*jobStore, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %w", err)
+	}
+
+	// A single connection serializes writers, so SQLite never reports busy.
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&QueuedJob{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate job table: %w", err)
+	}
+	return &jobStore{db: db}, nil
+}
+
+func (s *jobStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Enqueue inserts j as a pending row.
+func (s *jobStore) Enqueue(ctx context.Context, j Job) error {
+	row := QueuedJob{JobID: j.ID, Type: j.Type, Priority: j.Priority, Data: j.Data, Status: statusPending}
+	return s.db.WithContext(ctx).Create(&row).Error
+}
+
+// EnqueueWithin inserts j as a pending row unless limit rows are already
+// pending, in which case it returns ErrQueueFull. The count and the insert
+// share a transaction, and the single connection runs transactions one at a
+// time, so two submitters can never both take the last slot.
+func (s *jobStore) EnqueueWithin(ctx context.Context, j Job, limit int) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		if err := tx.Model(&QueuedJob{}).Where("status = ?", statusPending).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending >= int64(limit) {
+			return ErrQueueFull
+		}
+		row := QueuedJob{JobID: j.ID, Type: j.Type, Priority: j.Priority, Data: j.Data, Status: statusPending}
+		return tx.Create(&row).Error
+	})
+}
+
+// Pending returns the number of rows waiting to be claimed.
+func (s *jobStore) Pending(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.db.WithContext(ctx).Model(&QueuedJob{}).Where("status = ?", statusPending).Count(&n).Error
+	return n, err
+}
+
+// Claim atomically flips up to limit pending rows to claimed, highest priority
+// first and oldest first within a priority. Aging happens once the jobs are in
+// the in-memory jobQueue.
+func (s *jobStore) Claim(ctx context.Context, limit int) ([]Job, error) {
+	var rows []QueuedJob
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("status = ?", statusPending).Order("priority DESC, id").Limit(limit).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(rows))
+		for i, r := range rows {
+			ids[i] = r.ID
+		}
+		return tx.Model(&QueuedJob{}).
+			Where("id IN ? AND status = ?", ids, statusPending).
+			Update("status", statusClaimed).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, len(rows))
+	for i, r := range rows {
+		jobs[i] = r.toJob()
+	}
+	return jobs, nil
+}
+
+// Finish marks a claimed row done, or failed when procErr is non-nil.
+func (s *jobStore) Finish(ctx context.Context, rowID uint, procErr error) error {
+	status := statusDone
+	if procErr != nil {
+		status = statusFailed
+	}
+	return s.db.WithContext(ctx).Model(&QueuedJob{}).
+		Where("id = ? AND status = ?", rowID, statusClaimed).
+		Update("status", status).Error
+}
+
+// Recover puts rows left claimed by a previous process back to pending.
+func (s *jobStore) Recover(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Model(&QueuedJob{}).
+		Where("status = ?", statusClaimed).
+		Update("status", statusPending)
+	return res.RowsAffected, res.Error
+}
+
+// Counts returns the number of rows in each status.
+func (s *jobStore) Counts(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		N      int64
+	}
+	err := s.db.WithContext(ctx).Model(&QueuedJob{}).
+		Select("status, COUNT(*) AS n").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Status] = r.N
+	}
+	return counts, nil
+}
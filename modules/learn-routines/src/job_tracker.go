@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// TRACKER_CAPACITY bounds how many jobs GET /job/{id} remembers; the oldest
+// submissions are forgotten first.
+const TRACKER_CAPACITY = 10000
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// JobState is the per-job view served by GET /job/{id}.
+type JobState struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type,omitempty"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// jobTracker follows every job from submission to its final status, keyed by
+// Job.ID. Resubmitting an ID starts its entry over rather than adding a
+// second one, and order keeps first-submission order for List and eviction.
+type jobTracker struct {
+	capacity int
+
+	mu    sync.Mutex
+	byID  map[int]*JobState
+	order []int
+}
+
+func newJobTracker(capacity int) *jobTracker {
+	return &jobTracker{capacity: capacity, byID: make(map[int]*JobState)}
+}
+
+func (t *jobTracker) queued(j Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.byID[j.ID]; !ok {
+		if len(t.order) >= t.capacity {
+			delete(t.byID, t.order[0])
+			t.order = t.order[1:]
+		}
+		t.order = append(t.order, j.ID)
+	}
+	t.byID[j.ID] = &JobState{ID: j.ID, Type: j.Type, Status: jobQueued, UpdatedAt: time.Now()}
+}
+
+// attempt records that a worker is starting another try at job id.
+func (t *jobTracker) attempt(id int) {
+	t.update(id, func(s *JobState) {
+		s.Status = jobRunning
+		s.Attempts++
+	})
+}
+
+func (t *jobTracker) finish(id int, err error) {
+	t.update(id, func(s *JobState) {
+		s.Status = jobSucceeded
+		s.Error = ""
+		if err != nil {
+			s.Status = jobFailed
+			s.Error = err.Error()
+		}
+	})
+}
+
+// update applies fn to id's entry. Jobs that never went through queued (for
+// example ones recovered from the store) are not tracked.
+func (t *jobTracker) update(id int, fn func(*JobState)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.byID[id]; ok {
+		fn(s)
+		s.UpdatedAt = time.Now()
+	}
+}
+
+func (t *jobTracker) Get(id int) (JobState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.byID[id]
+	if !ok {
+		return JobState{}, false
+	}
+	return *s, true
+}
+
+// List returns every tracked job in submission order.
+func (t *jobTracker) List() []JobState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]JobState, 0, len(t.order))
+	for _, id := range t.order {
+		out = append(out, *t.byID[id])
+	}
+	return out
+}
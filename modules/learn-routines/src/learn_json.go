@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
 	"time"
 )
 
@@ -19,12 +20,58 @@ type Name struct {
 	Last  string `json:"last"`
 }
 
+// UserInlined does come out flat, but not because of ",inline": encoding/json
+// has no such option and ignores it. Name is flattened because it is an
+// anonymous (embedded) field with no name in its tag. Declared as a named
+// field (Name Name with tag "name,inline") it would stay a nested "name"
+// object. A key the outer struct already has wins over the embedded one.
 type UserInlined struct {
 	ID   int              `json:"id"`
-	Name `json:",inline"` // Fields of Name are inlined into User
+	Name `json:",inline"` // Flattened by embedding; ",inline" is a no-op here
 	Role string           `json:"role"`
 }
 
+// JSONDiff marshals a and b and returns the top-level keys whose values
+// differ, with b's value, ready to send as a PATCH body. Because it works on
+// the marshaled output, json tags, omitempty and omitzero all apply: a field
+// both sides omit never shows up. A field that b omits but a set comes back as
+// nil (JSON null), meaning "cleared".
+func JSONDiff(a, b any) (map[string]any, error) {
+	before, err := toJSONObject(a)
+	if err != nil {
+		return nil, fmt.Errorf("marshal a: %w", err)
+	}
+	after, err := toJSONObject(b)
+	if err != nil {
+		return nil, fmt.Errorf("marshal b: %w", err)
+	}
+
+	diff := make(map[string]any)
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			diff[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			diff[k] = nil
+		}
+	}
+	return diff, nil
+}
+
+func toJSONObject(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func learnJSON() {
 	// A struct where Year and CreatedAt have their zero values
 	e := Event{
@@ -1,7 +1,135 @@
 package main
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestLearJson(t *testing.T) {
 	learnJSON()
 }
+
+// topLevel decodes data as a flat object of strings and numbers.
+func topLevel(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestEmbeddedStructIsFlattened(t *testing.T) {
+	u := UserInlined{ID: 1, Name: Name{First: "ada", Last: "lovelace"}, Role: "admin"}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := topLevel(t, data)
+	if m["first"] != "ada" || m["last"] != "lovelace" {
+		t.Errorf("embedded fields not at top level: %s", data)
+	}
+
+	var back UserInlined
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != u {
+		t.Errorf("round trip = %+v, want %+v", back, u)
+	}
+}
+
+func TestNamedFieldStaysNested(t *testing.T) {
+	type userNamed struct {
+		ID   int    `json:"id"`
+		Name Name   `json:"name,inline"`
+		Role string `json:"role"`
+	}
+	data, err := json.Marshal(userNamed{ID: 1, Name: Name{First: "ada"}, Role: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := topLevel(t, data)
+	if _, ok := m["first"]; ok {
+		t.Errorf("encoding/json flattened a named field: %s", data)
+	}
+	if _, ok := m["name"].(map[string]any); !ok {
+		t.Errorf("expected a nested name object: %s", data)
+	}
+}
+
+func TestEmbeddedKeyCollision(t *testing.T) {
+	type clash struct {
+		First string `json:"first"`
+		Name
+	}
+	data, err := json.Marshal(clash{First: "outer", Name: Name{First: "inner", Last: "lovelace"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := topLevel(t, data)
+	if m["first"] != "outer" || m["last"] != "lovelace" {
+		t.Errorf("outer field should shadow the embedded one: %s", data)
+	}
+}
+
+func TestJSONDiff(t *testing.T) {
+	base := Event{Name: "Conference", Year: 2024, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name string
+		a, b Event
+		want map[string]any
+	}{
+		{
+			name: "identical",
+			a:    base,
+			b:    base,
+			want: map[string]any{},
+		},
+		{
+			name: "one field changed",
+			a:    base,
+			b:    Event{Name: "Meetup", Year: base.Year, CreatedAt: base.CreatedAt},
+			want: map[string]any{"name": "Meetup"},
+		},
+		{
+			name: "zero field set",
+			a:    Event{Name: "Conference"},
+			b:    Event{Name: "Conference", Year: 2025},
+			want: map[string]any{"year": float64(2025)},
+		},
+		{
+			name: "field cleared to zero",
+			a:    base,
+			b:    Event{Name: base.Name, CreatedAt: base.CreatedAt},
+			want: map[string]any{"year": nil},
+		},
+		{
+			name: "nested struct changed",
+			a:    Event{Name: "Conference"},
+			b:    Event{Name: "Conference", Test: struct{ A int }{A: 7}},
+			want: map[string]any{"test": map[string]any{"A": float64(7)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSONDiff(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONDiff = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONDiffMarshalError(t *testing.T) {
+	if _, err := JSONDiff(Event{}, map[string]any{"bad": func() {}}); err == nil {
+		t.Error("expected an error for a value that cannot be marshaled")
+	}
+}
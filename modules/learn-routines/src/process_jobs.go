@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,31 +11,62 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"shared/bodylimit"
+	"shared/retry"
 )
 
 const (
 	WORKER_FACTOR = 2
 	RETRIES       = 3
+	MAX_WORKERS   = 256
+
+	BACKOFF_BASE = 1 * time.Millisecond
+	BACKOFF_CAP  = 50 * time.Millisecond
+
+	// SHUTDOWN_TIMEOUT bounds how long in-flight HTTP requests get to finish.
+	SHUTDOWN_TIMEOUT = 5 * time.Second
 )
 
 var (
-	stats = make(map[int]int)
+	// stats counts completed jobs per Job.Type, bucketed by jobTypeLabel.
+	stats = make(map[string]int)
 	mu    = sync.RWMutex{}
 )
 
 type Job struct {
-	ID   int    `json:"id"`
-	Data string `json:"data"`
+	ID       int    `json:"id"`
+	Type     string `json:"type,omitempty"`
+	Priority int    `json:"priority,omitempty"` // higher is dequeued first
+	Data     string `json:"data"`
+
+	rowID uint // set when the job was claimed from a jobStore
 }
 
 type Result struct {
 	JobID int
+	Type  string
 	Len   int
 }
 
+// batchResponse is what POST /submitBatch returns: one entry per submitted job,
+// in request order, saying whether it made it into the queue.
+type batchResponse struct {
+	Accepted int           `json:"accepted"`
+	Rejected int           `json:"rejected"`
+	Results  []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	ID       int    `json:"id"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
 type Processor interface {
 	Process(ctx context.Context, j Job, t *time.Timer, workTime time.Duration) error
 }
@@ -55,34 +87,274 @@ func (s *simpleProcessor) Process(ctx context.Context, j Job, t *time.Timer, wor
 	}
 }
 
-func newServer(queue chan Job, success *uint64, failure *uint64) *http.Server {
+// workerPool runs Processor workers over a shared queue. The pool can be
+// resized at runtime: growing starts new goroutines, shrinking asks idle
+// workers to exit between jobs so nothing is dropped mid-processing.
+type workerPool struct {
+	ctx     context.Context
+	queue   chan Job
+	results chan Result
+	proc    Processor
+	retry   retry.RetryOpts // how handle retries a failed Process
+	metrics *jobMetrics
+	tracker *jobTracker
+	store   *jobStore // optional; claimed jobs are marked done/failed here
+	success *uint64
+	failure *uint64
+
+	mu     sync.Mutex   // serializes Resize
+	target atomic.Int64 // written under mu, read lock-free by Size
+	live   atomic.Int64
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, queue chan Job, results chan Result, proc Processor, success *uint64, failure *uint64) *workerPool {
+	return &workerPool{
+		ctx:     ctx,
+		queue:   queue,
+		results: results,
+		proc:    proc,
+		// Full jitter keeps workers that failed at the same moment from
+		// retrying in lockstep.
+		retry: retry.RetryOpts{
+			MaxAttempts: RETRIES,
+			BaseDelay:   BACKOFF_BASE,
+			MaxDelay:    BACKOFF_CAP,
+			Jitter:      1,
+		},
+		metrics: newJobMetrics(),
+		tracker: newJobTracker(TRACKER_CAPACITY),
+		success: success,
+		failure: failure,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Resize scales the pool to n workers. Shrinking blocks until the excess
+// workers have finished their current job and exited.
+func (p *workerPool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ; p.target.Load() < int64(n); p.target.Add(1) {
+		p.wg.Add(1)
+		p.live.Add(1)
+		go p.worker()
+	}
+
+	for ; p.target.Load() > int64(n); p.target.Add(-1) {
+		select {
+		case p.quit <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Size returns the number of workers the pool is scaled to. It does not take
+// mu, so it answers straight away even while a shrinking Resize is waiting
+// for a worker to finish its job.
+func (p *workerPool) Size() int {
+	return int(p.target.Load())
+}
+
+// Live returns the number of worker goroutines currently running.
+func (p *workerPool) Live() int64 {
+	return p.live.Load()
+}
+
+// Wait blocks until every worker has exited (the queue is closed and drained).
+func (p *workerPool) Wait() {
+	p.wg.Wait()
+}
+
+func (p *workerPool) worker() {
+	defer p.wg.Done()
+	defer p.live.Add(-1)
+
+	// PRE-ALLOCATED: One timer per worker
+	// Initialized with a long duration; it will be Reset later
+	t := time.NewTimer(time.Hour)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case j, ok := <-p.queue:
+			if !ok {
+				return
+			}
+			p.handle(j, t)
+		}
+	}
+}
+
+func (p *workerPool) handle(j Job, t *time.Timer) {
+	jobCtx, cancel := context.WithTimeout(p.ctx, 1*time.Second)
+	defer cancel()
+	start := time.Now()
+
+	err := retry.Do(jobCtx, func() error {
+		workTime := time.Duration(rand.Intn(20)) * time.Millisecond
+		p.tracker.attempt(j.ID)
+		return p.proc.Process(jobCtx, j, t, workTime)
+	}, p.retry)
+	p.metrics.observe(j.Type, time.Since(start), err)
+	p.tracker.finish(j.ID, err)
+	p.finish(j, err)
+	if err != nil {
+		log.Print("process failed after retries:", err.Error())
+		atomic.AddUint64(p.failure, 1)
+	} else {
+		atomic.AddUint64(p.success, 1)
+		p.results <- Result{JobID: j.ID, Type: j.Type, Len: len(j.Data)}
+	}
+}
+
+// finish records the outcome of a persisted job. Jobs cut short by shutdown
+// stay claimed so the next process recovers and retries them.
+func (p *workerPool) finish(j Job, err error) {
+	if p.store == nil || j.rowID == 0 || p.ctx.Err() != nil {
+		return
+	}
+	if ferr := p.store.Finish(context.Background(), j.rowID, err); ferr != nil {
+		log.Print("failed to record job outcome:", ferr.Error())
+	}
+}
+
+func newServer(queue *jobQueue, pool *workerPool, success *uint64, failure *uint64) *http.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/submitX", func(w http.ResponseWriter, r *http.Request) {
 		var j Job
 		if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			badBody(w, err)
 			return
 		}
-		select {
-		case queue <- j:
-			w.WriteHeader(http.StatusAccepted)
-		default:
+		// Tracked before Submit so a worker that picks it up at once has an
+		// entry to update; a rejected job is marked failed with the reason.
+		pool.tracker.queued(j)
+		if err := queue.Submit(r.Context(), j); err != nil {
+			pool.tracker.finish(j.ID, err)
 			atomic.AddUint64(failure, 1)
-			log.Println("queue full")
-			http.Error(w, "queue full", http.StatusServiceUnavailable)
+			log.Println("submit failed:", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	mux.HandleFunc("POST /submitBatch", func(w http.ResponseWriter, r *http.Request) {
+		var jobs []Job
+		if err := json.NewDecoder(r.Body).Decode(&jobs); err != nil {
+			badBody(w, err)
+			return
+		}
+		if len(jobs) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		// Each job is offered to the queue without waiting; whatever does not
+		// fit is reported back so the client can resubmit just those.
+		resp := batchResponse{Results: make([]batchResult, len(jobs))}
+		for i, j := range jobs {
+			resp.Results[i] = batchResult{ID: j.ID, Accepted: true}
+			pool.tracker.queued(j)
+			if err := queue.Submit(r.Context(), j); err != nil {
+				pool.tracker.finish(j.ID, err)
+				atomic.AddUint64(failure, 1)
+				resp.Results[i] = batchResult{ID: j.ID, Error: err.Error()}
+				resp.Rejected++
+				continue
+			}
+			resp.Accepted++
+		}
+
+		status := http.StatusAccepted
+		if resp.Accepted == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	mux.HandleFunc("GET /job/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "bad job id", http.StatusBadRequest)
+			return
+		}
+		state, ok := pool.tracker.Get(id)
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(state)
+	})
+
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pool.tracker.List())
+	})
+
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		queue.Drain()
+		log.Println("draining: rejecting new submissions")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]any{"draining": true, "queue_Depth": queue.Depth()})
+	})
+
+	mux.HandleFunc("POST /workers", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Count int `json:"count"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			badBody(w, err)
+			return
 		}
+		if req.Count < 0 || req.Count > MAX_WORKERS {
+			http.Error(w, "count out of range", http.StatusBadRequest)
+			return
+		}
+		pool.Resize(req.Count)
+		_ = json.NewEncoder(w).Encode(map[string]any{"workers": pool.Size()})
 	})
 
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "prometheus" {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			pool.metrics.writePrometheus(w)
+			return
+		}
+
+		// Only the stats copy happens under the stats lock, and encoding waits
+		// until it is released, so a slow client never blocks the aggregator.
+		// Everything else is read outside it, so nothing the readers wait on
+		// can hold up the aggregator through mu. The counters are
+		// bumped by the workers with atomic adds, so they are read with atomic
+		// loads rather than handing the raw pointers to the encoder.
+		snapshot := map[string]any{
+			"queue_Depth":  queue.Depth(),
+			"http_success": atomic.LoadUint64(success),
+			"http_failure": atomic.LoadUint64(failure),
+			"job_types":    pool.metrics.snapshot(),
+			"draining":     queue.Draining(),
+			"workers":      pool.Size(),
+		}
 
 		mu.RLock()
-		statsCopy := make(map[int]int)
+		statsCopy := make(map[string]int, len(stats))
 		for k, v := range stats {
 			statsCopy[k] = v
 		}
-		lenQeue := len(queue)
-		_ = json.NewEncoder(w).Encode(map[string]any{"queue_Depth": lenQeue, "http_success": success, "http_failure": failure, "jobs_done": statsCopy})
 		mu.RUnlock()
+		snapshot["jobs_done"] = statsCopy
+
+		_ = json.NewEncoder(w).Encode(snapshot)
 	})
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -91,58 +363,86 @@ func newServer(queue chan Job, success *uint64, failure *uint64) *http.Server {
 		w.WriteHeader(http.StatusAccepted)
 	})
 
+	// MAX_BODY_BYTES overrides the default 1 MiB cap on request bodies.
 	return &http.Server{
-		Handler: mux,
+		Handler: bodylimit.Handler(mux, bodylimit.FromEnv("MAX_BODY_BYTES")),
+	}
+}
+
+// badBody answers a request whose JSON body could not be decoded: 413 when
+// it ran past the body limit, 400 otherwise.
+func badBody(w http.ResponseWriter, err error) {
+	if bodylimit.IsTooLarge(err) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
 	}
+	http.Error(w, "bad request", http.StatusBadRequest)
+}
+
+// shutdown stops the pipeline front to back so nothing can submit into a
+// queue that is already closed:
+//  1. /submitX starts answering 503 (ErrClosing) for requests that race in,
+//  2. the HTTP server stops accepting and gets timeout to finish in-flight
+//     requests,
+//  3. the queue closes and the workers finish whatever is left in it.
+func shutdown(srv *http.Server, queue *jobQueue, pool *workerPool, timeout time.Duration) {
+	queue.StopIntake()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("HTTP shutdown did not finish cleanly:", err)
+	}
+
+	queue.Close()
+	pool.Wait()
 }
 
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	queue := make(chan Job, 1000)
-	results := make(chan Result, 1000)
+	// QUEUE_DB=off keeps the queue purely in memory.
+	var store *jobStore
+	if path := cmp.Or(os.Getenv("QUEUE_DB"), "process_jobs.db"); path != "off" {
+		var err error
+		if store, err = newJobStore(path); err != nil {
+			log.Fatalf("failed to open job store: %v", err)
+		}
+		defer store.Close()
 
-	s := simpleProcessor{}
+		n, err := store.Recover(ctx)
+		if err != nil {
+			log.Fatalf("failed to recover claimed jobs: %v", err)
+		}
+		log.Printf("Recovered %d in-flight jobs from %s", n, path)
+	}
 
-	var wg sync.WaitGroup
+	queue := newJobQueue(1000, store)
+	queue.Start(ctx)
+	results := make(chan Result, 1000)
 
 	var success uint64
 	var failure uint64
 
-	for range WORKER_FACTOR * runtime.NumCPU() {
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			// PRE-ALLOCATED: One timer per worker
-			// Initialized with a long duration; it will be Reset later
-			t := time.NewTimer(time.Hour)
-			defer t.Stop()
-
-			for j := range queue {
-				jobCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
-				var err error
-				for retry := range RETRIES {
-					workTime := time.Duration(rand.Intn(20)) * time.Millisecond
-					if err = s.Process(jobCtx, j, t, workTime); err == nil {
-						break
-					}
-					time.Sleep((1 << retry) * time.Millisecond)
-				}
-				if err != nil {
-					log.Print("process failed after retries:", err.Error())
-					atomic.AddUint64(&failure, 1)
-				} else {
-					atomic.AddUint64(&success, 1)
-					results <- Result{JobID: j.ID, Len: len(j.Data)}
-				}
-				cancel()
-			}
-		}()
+	pool := newWorkerPool(ctx, queue.ch, results, &simpleProcessor{}, &success, &failure)
+	pool.store = store
+	pool.Resize(WORKER_FACTOR * runtime.NumCPU())
+
+	// AUTOSCALE=off keeps the pool at whatever size POST /workers sets.
+	if os.Getenv("AUTOSCALE") != "off" {
+		scaler := newAutoscaler(autoscaleConfig{
+			Min:         runtime.NumCPU(),
+			Max:         MAX_WORKERS,
+			Interval:    AUTOSCALE_INTERVAL,
+			HighWater:   AUTOSCALE_HIGH_WATER,
+			LowWater:    AUTOSCALE_LOW_WATER,
+			ShrinkAfter: AUTOSCALE_SHRINK_AFTER,
+		}, pool, queue.Depth)
+		go scaler.Run(ctx)
 	}
 
-	srv := newServer(queue, &success, &failure)
+	srv := newServer(queue, pool, &success, &failure)
 	srv.Addr = ":8080"
 	go func() {
 		log.Println("Starting the HTTP server at 8080")
@@ -155,7 +455,7 @@ func main() {
 		defer aggWG.Done()
 		for r := range results {
 			mu.Lock()
-			stats[r.JobID] += r.Len
+			stats[jobTypeLabel(r.Type)]++
 			mu.Unlock()
 		}
 	}()
@@ -163,12 +463,7 @@ func main() {
 	// Wait for shutdown
 	<-ctx.Done()
 
-	// Stop Accepting new requests
-	srv.Shutdown(context.Background())
-	// close incoming requests
-	close(queue)
-	// wait for all workers to finish
-	wg.Wait()
+	shutdown(srv, queue, pool, SHUTDOWN_TIMEOUT)
 	// close results channel
 	close(results)
 	// wait for aggregator to finish remaning items
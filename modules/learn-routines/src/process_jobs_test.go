@@ -2,15 +2,92 @@ package main
 
 import (
 	"bytes"
+	"container/heap"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"shared/retry"
 )
 
+// reliableProcessor simulates work like simpleProcessor but never fails,
+// so tests can assert exact job accounting.
+type reliableProcessor struct {
+	processed atomic.Int64
+}
+
+func (p *reliableProcessor) Process(ctx context.Context, j Job, t *time.Timer, workTime time.Duration) error {
+	t.Reset(workTime)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		p.processed.Add(1)
+		return nil
+	}
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	const jobs = 200
+	queue := make(chan Job, jobs)
+	results := make(chan Result, jobs)
+	var success, failure uint64
+
+	proc := &reliableProcessor{}
+	pool := newWorkerPool(context.Background(), queue, results, proc, &success, &failure)
+
+	pool.Resize(2)
+	pool.Resize(8)
+	if got := pool.Live(); got != 8 {
+		t.Fatalf("expected 8 live workers after scale up, got %d", got)
+	}
+
+	for i := range jobs {
+		queue <- Job{ID: i, Data: "burst"}
+	}
+
+	// Shrink while the burst is still being processed.
+	pool.Resize(1)
+	if got := pool.Size(); got != 1 {
+		t.Fatalf("expected pool size 1 after scale down, got %d", got)
+	}
+
+	close(queue)
+	pool.Wait()
+	close(results)
+
+	if got := atomic.LoadUint64(&success) + atomic.LoadUint64(&failure); got != jobs {
+		t.Errorf("expected %d jobs accounted for, got %d", jobs, got)
+	}
+	if got := proc.processed.Load(); got != jobs {
+		t.Errorf("expected %d jobs processed, got %d", jobs, got)
+	}
+	if got := len(results); got != jobs {
+		t.Errorf("expected %d results, got %d", jobs, got)
+	}
+	if got := pool.Live(); got != 0 {
+		t.Errorf("expected no live workers after shutdown, got %d", got)
+	}
+}
+
 // “How fast can I create 100 goroutines, serialize JSON, and hammer localhost?”
 func BenchmarkSubmt(b *testing.B) {
 	client := http.Client{Timeout: 5 * time.Second}
@@ -94,3 +171,908 @@ func BenchmarkSubmit(b *testing.B) {
 		<-sem
 	}
 }
+
+func TestHandleBackoffRespectsShutdown(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var success, failure uint64
+	proc := &typeFailProcessor{failTypes: map[string]bool{"bad": true}}
+	pool := newWorkerPool(ctx, nil, nil, proc, &success, &failure)
+	pool.retry = retry.RetryOpts{MaxAttempts: RETRIES, BaseDelay: time.Hour}
+
+	j := Job{ID: 1, Type: "bad"}
+	pool.tracker.queued(j)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	start := time.Now()
+	pool.handle(j, timer)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("backoff was not interrupted by cancellation, took %v", elapsed)
+	}
+
+	state, _ := pool.tracker.Get(j.ID)
+	if state.Attempts != 1 || state.Status != jobFailed {
+		t.Errorf("expected one failed attempt, got %+v", state)
+	}
+	if failure != 1 {
+		t.Errorf("expected 1 failure, got %d", failure)
+	}
+}
+
+// typeFailProcessor fails every job whose Type is listed in failTypes.
+type typeFailProcessor struct {
+	failTypes map[string]bool
+}
+
+func (p *typeFailProcessor) Process(ctx context.Context, j Job, t *time.Timer, workTime time.Duration) error {
+	if p.failTypes[j.Type] {
+		return errors.New("simulated failure")
+	}
+	return nil
+}
+
+func TestPerTypeMetrics(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	submitted := map[string]int{"email": 10, "report": 5, "bad": 3, "": 2}
+	total := 0
+	for _, n := range submitted {
+		total += n
+	}
+
+	queue := make(chan Job, total)
+	results := make(chan Result, total)
+	var success, failure uint64
+
+	proc := &typeFailProcessor{failTypes: map[string]bool{"bad": true}}
+	pool := newWorkerPool(context.Background(), queue, results, proc, &success, &failure)
+	pool.retry = retry.RetryOpts{MaxAttempts: RETRIES}
+	pool.Resize(4)
+
+	id := 0
+	for jobType, n := range submitted {
+		for range n {
+			id++
+			queue <- Job{ID: id, Type: jobType, Data: "payload"}
+		}
+	}
+	close(queue)
+	pool.Wait()
+
+	snap := pool.metrics.snapshot()
+	want := map[string]TypeSnapshot{
+		"email":        {Success: 10},
+		"report":       {Success: 5},
+		otherJobType:   {Failure: 3},
+		defaultJobType: {Success: 2},
+	}
+	for jobType, w := range want {
+		got, ok := snap[jobType]
+		if !ok {
+			t.Errorf("missing metrics for type %q", jobType)
+			continue
+		}
+		if got.Success != w.Success || got.Failure != w.Failure {
+			t.Errorf("type %q: got success=%d failure=%d, want success=%d failure=%d",
+				jobType, got.Success, got.Failure, w.Success, w.Failure)
+		}
+		if inf := got.LatencyBuckets["+Inf"]; inf != w.Success+w.Failure {
+			t.Errorf("type %q: +Inf bucket = %d, want %d", jobType, inf, w.Success+w.Failure)
+		}
+	}
+
+	srv := newServer(newJobQueue(0, nil), pool, &success, &failure)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics?format=prometheus", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `jobs_processed_total{type="email",result="success"} 10`) {
+		t.Errorf("prometheus output missing email counter:\n%s", body)
+	}
+}
+
+func TestJobTypeLabel(t *testing.T) {
+	testCases := []struct {
+		jobType string
+		want    string
+	}{
+		{"", defaultJobType},
+		{"email", "email"},
+		{"report", "report"},
+		{"bad", otherJobType},
+		{"email-" + strings.Repeat("x", 64), otherJobType},
+	}
+	for _, tc := range testCases {
+		if got := jobTypeLabel(tc.jobType); got != tc.want {
+			t.Errorf("jobTypeLabel(%q) = %q, want %q", tc.jobType, got, tc.want)
+		}
+	}
+}
+
+func TestJobStoreSurvivesRestart(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	// First "process": accept five jobs, claim two, then crash before finishing.
+	store, err := newJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := store.Enqueue(ctx, Job{ID: i, Type: "email", Data: "payload"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	claimed, err := store.Claim(ctx, 2)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("expected to claim 2 jobs, got %d (err %v)", len(claimed), err)
+	}
+	store.Close()
+
+	// Second "process": recover and run the normal pipeline.
+	store, err = newJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	recovered, err := store.Recover(ctx)
+	if err != nil || recovered != 2 {
+		t.Fatalf("expected 2 recovered jobs, got %d (err %v)", recovered, err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := newJobQueue(10, store)
+	queue.Start(runCtx)
+	results := make(chan Result, 10)
+	var success, failure uint64
+
+	proc := &reliableProcessor{}
+	pool := newWorkerPool(runCtx, queue.ch, results, proc, &success, &failure)
+	pool.store = store
+	pool.Resize(2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		counts, err := store.Counts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts[statusDone] == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs not processed after restart, counts: %v", counts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	queue.Close()
+	pool.Wait()
+
+	if got := proc.processed.Load(); got != 5 {
+		t.Errorf("expected 5 jobs processed, got %d", got)
+	}
+}
+
+// orderProcessor records the order in which jobs reach a worker.
+type orderProcessor struct {
+	mu    sync.Mutex
+	order []int
+}
+
+func (p *orderProcessor) Process(ctx context.Context, j Job, t *time.Timer, workTime time.Duration) error {
+	time.Sleep(time.Millisecond)
+	p.mu.Lock()
+	p.order = append(p.order, j.ID)
+	p.mu.Unlock()
+	return nil
+}
+
+func TestPriorityJobJumpsBacklog(t *testing.T) {
+	const backlog = 50
+	const urgentID = 999
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(100, nil)
+	queue.Start(ctx)
+	results := make(chan Result, backlog+1)
+	var success, failure uint64
+
+	proc := &orderProcessor{}
+	pool := newWorkerPool(ctx, queue.ch, results, proc, &success, &failure)
+	pool.Resize(1)
+
+	for i := range backlog {
+		if err := queue.Submit(ctx, Job{ID: i, Priority: 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := queue.Submit(ctx, Job{ID: urgentID, Priority: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Close()
+	pool.Wait()
+
+	pos := slices.Index(proc.order, urgentID)
+	if pos < 0 {
+		t.Fatal("urgent job was never processed")
+	}
+	// At most the job being processed and the one the dispatcher already
+	// popped can run ahead of it.
+	if pos > 3 {
+		t.Errorf("urgent job processed at position %d of %d, expected near the front", pos, len(proc.order))
+	}
+	if len(proc.order) != backlog+1 {
+		t.Errorf("expected %d jobs processed, got %d", backlog+1, len(proc.order))
+	}
+}
+
+func TestJobHeapAging(t *testing.T) {
+	aging := int64(AGING_INTERVAL)
+	now := time.Now().UnixNano()
+
+	h := &jobHeap{}
+	// Waited three aging intervals at priority 0.
+	heap.Push(h, queuedItem{job: Job{ID: 1, Priority: 0}, score: 0*aging - (now - 3*aging), seq: 1})
+	// Fresh job two levels higher.
+	heap.Push(h, queuedItem{job: Job{ID: 2, Priority: 2}, score: 2*aging - now, seq: 2})
+	// Fresh job five levels higher still beats the aged one.
+	heap.Push(h, queuedItem{job: Job{ID: 3, Priority: 5}, score: 5*aging - now, seq: 3})
+
+	var got []int
+	for h.Len() > 0 {
+		got = append(got, heap.Pop(h).(queuedItem).job.ID)
+	}
+	if want := []int{3, 1, 2}; !slices.Equal(got, want) {
+		t.Errorf("dequeue order = %v, want %v", got, want)
+	}
+}
+
+func TestDrainFinishesQueuedJobs(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(20, nil)
+	queue.Start(ctx)
+	results := make(chan Result, 100)
+	var success, failure uint64
+
+	proc := &reliableProcessor{}
+	pool := newWorkerPool(ctx, queue.ch, results, proc, &success, &failure)
+	ts := httptest.NewServer(newServer(queue, pool, &success, &failure).Handler)
+	defer ts.Close()
+
+	submit := func(id int) int {
+		body, _ := json.Marshal(Job{ID: id, Data: "payload"})
+		resp, err := http.Post(ts.URL+"/submitX", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// No workers yet, so submissions pile up until the queue is full.
+	accepted := 0
+	for id := 0; submit(id) == http.StatusAccepted; id++ {
+		accepted++
+	}
+	if accepted == 0 {
+		t.Fatal("expected some submissions to be accepted")
+	}
+
+	resp, err := http.Post(ts.URL+"/drain", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected /drain to return %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+
+	pool.Resize(4)
+	if code := submit(1000); code != http.StatusServiceUnavailable {
+		t.Errorf("expected submissions to be rejected while draining, got %d", code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadUint64(&success) != uint64(accepted) {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d queued jobs completed after drain", atomic.LoadUint64(&success), accepted)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metrics struct {
+		QueueDepth int  `json:"queue_Depth"`
+		Draining   bool `json:"draining"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if metrics.QueueDepth != 0 || !metrics.Draining {
+		t.Errorf("expected an empty, draining queue in /metrics, got %+v", metrics)
+	}
+
+	queue.Close()
+	pool.Wait()
+}
+
+func TestShutdownRejectsLateSubmissions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(1000, nil)
+	queue.Start(ctx)
+	results := make(chan Result)
+	go func() {
+		for range results {
+		}
+	}()
+	defer close(results)
+	var success, failure uint64
+
+	pool := newWorkerPool(ctx, queue.ch, results, &reliableProcessor{}, &success, &failure)
+	pool.Resize(4)
+
+	srv := newServer(queue, pool, &success, &failure)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	url := "http://" + ln.Addr().String() + "/submitX"
+
+	// Keep submitting until the server stops answering.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := w * 10000; ; id++ {
+				body, _ := json.Marshal(Job{ID: id, Data: "payload"})
+				resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+				if err != nil {
+					return
+				}
+				resp.Body.Close()
+				mu.Lock()
+				codes[resp.StatusCode]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	shutdown(srv, queue, pool, time.Second)
+	wg.Wait()
+
+	for code := range codes {
+		if code != http.StatusAccepted && code != http.StatusServiceUnavailable {
+			t.Errorf("unexpected status %d during shutdown (%d times)", code, codes[code])
+		}
+	}
+	if codes[http.StatusAccepted] == 0 {
+		t.Error("expected some submissions to be accepted before shutdown")
+	}
+
+	// A request that raced past the listener still gets a clean 503.
+	rec := httptest.NewRecorder()
+	body, _ := json.Marshal(Job{ID: -1, Data: "late"})
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/submitX", bytes.NewReader(body)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), ErrClosing.Error()) {
+		t.Errorf("late submit: got %d %q, want 503 %q", rec.Code, rec.Body.String(), ErrClosing)
+	}
+}
+
+func TestMetricsReportsCounterValues(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	const jobs = 7
+	queue := make(chan Job, jobs)
+	results := make(chan Result, jobs)
+	var success, failure uint64
+
+	proc := &typeFailProcessor{failTypes: map[string]bool{"bad": true}}
+	pool := newWorkerPool(context.Background(), queue, results, proc, &success, &failure)
+	pool.retry = retry.RetryOpts{MaxAttempts: RETRIES}
+	pool.Resize(2)
+	for i := range jobs {
+		jobType := "email"
+		if i < 2 {
+			jobType = "bad"
+		}
+		queue <- Job{ID: i, Type: jobType, Data: "payload"}
+	}
+	close(queue)
+	pool.Wait()
+
+	srv := newServer(newJobQueue(0, nil), pool, &success, &failure)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	var metrics map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("invalid /metrics JSON: %v\n%s", err, rec.Body.String())
+	}
+	for key, want := range map[string]float64{"http_success": 5, "http_failure": 2} {
+		got, ok := metrics[key].(float64)
+		if !ok {
+			t.Errorf("%s = %#v, want a number", key, metrics[key])
+			continue
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+// blockingProcessor holds every job until release is closed.
+type blockingProcessor struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProcessor) Process(ctx context.Context, j Job, t *time.Timer, workTime time.Duration) error {
+	p.started <- struct{}{}
+	<-p.release
+	return nil
+}
+
+func TestMetricsDoesNotWaitOnResize(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	queue := make(chan Job, 1)
+	results := make(chan Result, 1)
+	var success, failure uint64
+
+	proc := &blockingProcessor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	pool := newWorkerPool(context.Background(), queue, results, proc, &success, &failure)
+	pool.Resize(1)
+	queue <- Job{ID: 1, Data: "slow"}
+	<-proc.started
+
+	// The only worker is busy, so shrinking blocks until it finishes.
+	resized := make(chan struct{})
+	go func() {
+		pool.Resize(0)
+		close(resized)
+	}()
+
+	srv := newServer(newJobQueue(0, nil), pool, &success, &failure)
+	served := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		served <- rec.Code
+	}()
+
+	select {
+	case code := <-served:
+		if code != http.StatusOK {
+			t.Errorf("/metrics status = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(time.Second):
+		t.Error("/metrics blocked behind a shrinking Resize")
+	}
+
+	close(proc.release)
+	select {
+	case <-resized:
+	case <-time.After(time.Second):
+		t.Fatal("Resize did not finish after the job was released")
+	}
+	if got := pool.Size(); got != 0 {
+		t.Errorf("pool size = %d, want 0", got)
+	}
+}
+
+func TestSubmitBatchPartialAcceptance(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// No workers, so the queue only ever holds its capacity.
+	queue := newJobQueue(5, nil)
+	queue.Start(ctx)
+	defer queue.Close()
+	var success, failure uint64
+	pool := newWorkerPool(ctx, queue.ch, make(chan Result), &reliableProcessor{}, &success, &failure)
+	srv := newServer(queue, pool, &success, &failure)
+
+	post := func(jobs []Job) (int, batchResponse) {
+		body, _ := json.Marshal(jobs)
+		rec := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/submitBatch", bytes.NewReader(body)))
+		var resp batchResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// The dispatcher may already hold one job waiting for a worker, so fill
+	// the queue with a single submit first and let it settle.
+	if err := queue.Submit(ctx, Job{ID: 100}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	room := 5 - queue.Len()
+
+	jobs := make([]Job, 8)
+	for i := range jobs {
+		jobs[i] = Job{ID: i, Data: "payload"}
+	}
+	code, resp := post(jobs)
+	if code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", code, http.StatusAccepted)
+	}
+	if resp.Accepted != room || resp.Rejected != len(jobs)-room {
+		t.Fatalf("accepted=%d rejected=%d, want %d and %d", resp.Accepted, resp.Rejected, room, len(jobs)-room)
+	}
+	for i, r := range resp.Results {
+		wantAccepted := i < room
+		if r.ID != i || r.Accepted != wantAccepted {
+			t.Errorf("result %d = %+v, want id %d accepted=%v", i, r, i, wantAccepted)
+		}
+		if !r.Accepted && r.Error != ErrQueueFull.Error() {
+			t.Errorf("result %d error = %q, want %q", i, r.Error, ErrQueueFull)
+		}
+	}
+
+	// Once full, a batch with nothing accepted is a 503.
+	if code, resp := post(jobs[:2]); code != http.StatusServiceUnavailable || resp.Rejected != 2 {
+		t.Errorf("full queue: status %d rejected %d, want 503 and 2", code, resp.Rejected)
+	}
+	if code, _ := post(nil); code != http.StatusBadRequest {
+		t.Errorf("empty batch: status %d, want 400", code)
+	}
+}
+
+func TestPersistentQueueIsBounded(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := newJobStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// Not started, so nothing is claimed and every accepted job stays pending.
+	queue := newJobQueue(3, store)
+	var success, failure uint64
+	pool := newWorkerPool(ctx, queue.ch, make(chan Result), &reliableProcessor{}, &success, &failure)
+	srv := newServer(queue, pool, &success, &failure)
+
+	jobs := make([]Job, 5)
+	for i := range jobs {
+		jobs[i] = Job{ID: i, Data: "payload"}
+	}
+	body, _ := json.Marshal(jobs)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/submitBatch", bytes.NewReader(body)))
+
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid /submitBatch JSON: %v\n%s", err, rec.Body.String())
+	}
+	if resp.Accepted != 3 || resp.Rejected != 2 {
+		t.Fatalf("accepted=%d rejected=%d, want 3 and 2", resp.Accepted, resp.Rejected)
+	}
+	for _, r := range resp.Results[3:] {
+		if r.Error != ErrQueueFull.Error() {
+			t.Errorf("result %d error = %q, want %q", r.ID, r.Error, ErrQueueFull)
+		}
+	}
+
+	counts, err := store.Counts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[statusPending] != 3 {
+		t.Errorf("pending rows = %d, want 3", counts[statusPending])
+	}
+
+	rec = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var metrics struct {
+		QueueDepth int `json:"queue_Depth"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("invalid /metrics JSON: %v\n%s", err, rec.Body.String())
+	}
+	if metrics.QueueDepth != 3 {
+		t.Errorf("queue_Depth = %d, want the 3 stored jobs", metrics.QueueDepth)
+	}
+}
+
+func TestOversizedBodiesAreRejected(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	t.Setenv("MAX_BODY_BYTES", "64")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(5, nil)
+	queue.Start(ctx)
+	defer queue.Close()
+	var success, failure uint64
+	pool := newWorkerPool(ctx, queue.ch, make(chan Result), &reliableProcessor{}, &success, &failure)
+	srv := newServer(queue, pool, &success, &failure)
+
+	huge := strings.Repeat("x", 128)
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/submitX", fmt.Sprintf(`{"id":1,"data":%q}`, huge)},
+		{"/submitBatch", fmt.Sprintf(`[{"id":1,"data":%q}]`, huge)},
+		{"/workers", fmt.Sprintf(`{"count":1,"pad":%q}`, huge)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+			}
+		})
+	}
+
+	if n := queue.Len(); n != 0 {
+		t.Errorf("queue holds %d jobs, want none from oversized bodies", n)
+	}
+
+	// Malformed bodies under the limit are still a plain 400.
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("POST", "/submitX", strings.NewReader(`{"id":`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAutoscalerHysteresis(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var success, failure uint64
+	pool := newWorkerPool(ctx, make(chan Job), make(chan Result), &reliableProcessor{}, &success, &failure)
+	pool.Resize(2)
+
+	depth := 0
+	a := newAutoscaler(autoscaleConfig{Min: 2, Max: 8, HighWater: 50, LowWater: 10, ShrinkAfter: 3}, pool, func() int { return depth })
+
+	steps := []struct {
+		depth int
+		want  int
+	}{
+		{100, 4}, // above high water: double
+		{100, 8},
+		{100, 8}, // capped at Max
+		{5, 8},   // low, but the streak has just started
+		{30, 8},  // between the marks resets the streak
+		{5, 8},
+		{5, 8},
+		{5, 4}, // third low sample in a row: halve
+		{5, 4},
+		{5, 4},
+		{5, 2},
+		{0, 2},
+		{0, 2},
+		{0, 2}, // floored at Min
+	}
+	for i, s := range steps {
+		depth = s.depth
+		a.step()
+		if got := pool.Size(); got != s.want {
+			t.Fatalf("step %d (depth %d): workers = %d, want %d", i, s.depth, got, s.want)
+		}
+	}
+}
+
+func TestAutoscalerFollowsBurst(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(1000, nil)
+	queue.Start(ctx)
+	results := make(chan Result, 1000)
+	var success, failure uint64
+
+	pool := newWorkerPool(ctx, queue.ch, results, &reliableProcessor{}, &success, &failure)
+	pool.Resize(1)
+
+	a := newAutoscaler(autoscaleConfig{
+		Min: 1, Max: 16, Interval: 5 * time.Millisecond,
+		HighWater: 20, LowWater: 5, ShrinkAfter: 3,
+	}, pool, queue.Len)
+	go a.Run(ctx)
+
+	const burst = 400
+	for i := range burst {
+		if err := queue.Submit(ctx, Job{ID: i, Data: "payload"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	peak := 0
+	deadline := time.Now().Add(10 * time.Second)
+	for atomic.LoadUint64(&success) < burst || pool.Size() > 1 {
+		peak = max(peak, pool.Size())
+		if time.Now().After(deadline) {
+			t.Fatalf("burst not absorbed: done %d/%d, workers %d", atomic.LoadUint64(&success), burst, pool.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if peak <= 1 {
+		t.Errorf("workers never grew during the burst (peak %d)", peak)
+	}
+
+	srv := newServer(queue, pool, &success, &failure)
+	rec := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var metrics struct {
+		Workers int `json:"workers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Workers != 1 {
+		t.Errorf("/metrics workers = %d, want 1 after the queue drained", metrics.Workers)
+	}
+
+	cancel()
+	queue.Close()
+	pool.Wait()
+}
+
+func TestJobStatusEndpoint(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := newJobQueue(100, nil)
+	queue.Start(ctx)
+	results := make(chan Result, 100)
+	var success, failure uint64
+
+	proc := &typeFailProcessor{failTypes: map[string]bool{"bad": true}}
+	pool := newWorkerPool(ctx, queue.ch, results, proc, &success, &failure)
+	pool.retry = retry.RetryOpts{MaxAttempts: RETRIES}
+	pool.Resize(2)
+	ts := httptest.NewServer(newServer(queue, pool, &success, &failure).Handler)
+	defer ts.Close()
+
+	jobs := []Job{{ID: 3, Type: "email"}, {ID: 1, Type: "bad"}, {ID: 2, Type: "report"}}
+	for _, j := range jobs {
+		body, _ := json.Marshal(j)
+		resp, err := http.Post(ts.URL+"/submitX", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	getState := func(id string) (int, JobState) {
+		resp, err := http.Get(ts.URL + "/job/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var s JobState
+		_ = json.NewDecoder(resp.Body).Decode(&s)
+		return resp.StatusCode, s
+	}
+
+	want := map[int]JobState{
+		3: {Status: jobSucceeded, Attempts: 1},
+		1: {Status: jobFailed, Attempts: RETRIES, Error: "simulated failure"},
+		2: {Status: jobSucceeded, Attempts: 1},
+	}
+	for id, w := range want {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			code, s := getState(strconv.Itoa(id))
+			if code != http.StatusOK {
+				t.Fatalf("job %d: status %d", id, code)
+			}
+			if s.Status == jobSucceeded || s.Status == jobFailed {
+				if s.Status != w.Status || s.Attempts != w.Attempts || s.Error != w.Error {
+					t.Errorf("job %d = %+v, want %+v", id, s, w)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job %d never finished, last state %+v", id, s)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if code, _ := getState("42"); code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d, want 404", code)
+	}
+	if code, _ := getState("abc"); code != http.StatusBadRequest {
+		t.Errorf("bad id: status %d, want 400", code)
+	}
+
+	resp, err := http.Get(ts.URL + "/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []JobState
+	_ = json.NewDecoder(resp.Body).Decode(&all)
+	resp.Body.Close()
+	var order []int
+	for _, s := range all {
+		order = append(order, s.ID)
+	}
+	if !slices.Equal(order, []int{3, 1, 2}) {
+		t.Errorf("/jobs order = %v, want submission order [3 1 2]", order)
+	}
+
+	queue.Close()
+	pool.Wait()
+}
+
+func TestJobTrackerEvictsOldest(t *testing.T) {
+	tr := newJobTracker(2)
+	tr.queued(Job{ID: 1})
+	tr.queued(Job{ID: 2})
+	tr.queued(Job{ID: 1}) // resubmission reuses the slot
+	tr.queued(Job{ID: 3})
+
+	if _, ok := tr.Get(1); ok {
+		t.Error("oldest job 1 was not evicted")
+	}
+	if s, ok := tr.Get(3); !ok || s.Status != jobQueued {
+		t.Errorf("job 3 = %+v, %v; want queued", s, ok)
+	}
+	if got := len(tr.List()); got != 2 {
+		t.Errorf("tracked %d jobs, want 2", got)
+	}
+}
@@ -1,9 +1,6 @@
 package main
 
-import (
-	"fmt"
-	"runtime"
-)
+import "fmt"
 
 type Node struct {
 	next *Node
@@ -26,8 +23,7 @@ func heapAlloc() *Node {
 
 // PrintMemUsage outputs the current memory stats to stdout.
 func PrintMemUsage() {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
+	m := readMemSample()
 	fmt.Printf("Memory Usage:\n")
 	fmt.Printf("\tHeapAlloc = %v MiB", m.HeapAlloc/1024/1024)
 	fmt.Printf("\tHeapSys = %v MiB", m.HeapSys/1024/1024)
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// churnSink keeps AllocChurn's slices reachable long enough that the compiler
+// cannot stack-allocate or drop them.
+var churnSink [][]byte
+
+// AllocChurn allocates n byte slices of size bytes, drops them, and forces a
+// collection with runtime.GC. It returns MemStats.NumGC before and after that
+// collection.
+//
+// Side effects: runtime.GC blocks the caller until a full cycle completes and
+// stops the world twice, and ReadMemStats stops it again on each read. Use it
+// in experiments and tests, not on a hot path.
+func AllocChurn(n, size int) (beforeGC, afterGC uint32) {
+	churnSink = make([][]byte, n)
+	for i := range churnSink {
+		churnSink[i] = make([]byte, size)
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	beforeGC = m.NumGC
+
+	churnSink = nil
+	runtime.GC()
+
+	runtime.ReadMemStats(&m)
+	return beforeGC, m.NumGC
+}
+
+var heapGrowth struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+// HeapGrowth returns how much HeapAlloc has changed since the previous call,
+// negative if the heap shrank. The first call measures from zero.
+//
+// Side effects: it reads MemStats (a brief stop-the-world) and updates
+// process-wide state, so concurrent callers see each other's baselines.
+func HeapGrowth() int64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	heapGrowth.mu.Lock()
+	defer heapGrowth.mu.Unlock()
+	delta := int64(m.HeapAlloc) - int64(heapGrowth.last)
+	heapGrowth.last = m.HeapAlloc
+	return delta
+}
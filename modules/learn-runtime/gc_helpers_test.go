@@ -0,0 +1,28 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestAllocChurnTriggersGC(t *testing.T) {
+	before, after := AllocChurn(1000, 4096)
+	if after <= before {
+		t.Errorf("NumGC went from %d to %d, want an increase", before, after)
+	}
+}
+
+func TestHeapGrowthDuringRetention(t *testing.T) {
+	runtime.GC()
+	HeapGrowth()
+
+	retained := make([][]byte, 64)
+	for i := range retained {
+		retained[i] = make([]byte, 64*1024)
+	}
+
+	if delta := HeapGrowth(); delta <= 0 {
+		t.Errorf("HeapGrowth = %d while retaining 4 MiB, want > 0", delta)
+	}
+	runtime.KeepAlive(retained)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MemSample is the subset of runtime.MemStats recorded on every tick.
+type MemSample struct {
+	Time       time.Time
+	HeapAlloc  uint64
+	HeapSys    uint64
+	HeapInuse  uint64
+	TotalAlloc uint64
+	Mallocs    uint64
+	Frees      uint64
+	NumGC      uint32
+}
+
+func readMemSample() MemSample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return MemSample{
+		Time:       time.Now(),
+		HeapAlloc:  m.HeapAlloc,
+		HeapSys:    m.HeapSys,
+		HeapInuse:  m.HeapInuse,
+		TotalAlloc: m.TotalAlloc,
+		Mallocs:    m.Mallocs,
+		Frees:      m.Frees,
+		NumGC:      m.NumGC,
+	}
+}
+
+// MemSampler periodically records memory stats into a fixed-size ring buffer,
+// so a long run keeps only the most recent capacity samples.
+//
+// runtime.ReadMemStats stops the world briefly, so keep the interval well above
+// a millisecond when sampling a real service.
+type MemSampler struct {
+	mu      sync.Mutex
+	samples []MemSample
+	next    int
+	full    bool
+}
+
+func NewMemSampler(capacity int) *MemSampler {
+	return &MemSampler{samples: make([]MemSample, max(capacity, 1))}
+}
+
+// Start records a sample immediately and then once per interval until ctx is
+// done. It returns straight away; sampling happens on its own goroutine.
+func (s *MemSampler) Start(ctx context.Context, interval time.Duration) {
+	s.Sample()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.Sample()
+			}
+		}
+	}()
+}
+
+// Sample records one snapshot now, outside the ticker.
+func (s *MemSampler) Sample() {
+	sample := readMemSample()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+	if s.next == 0 {
+		s.full = true
+	}
+}
+
+// Snapshots returns a copy of the recorded samples, oldest first.
+func (s *MemSampler) Snapshots() []MemSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]MemSample(nil), s.samples[:s.next]...)
+	}
+	out := make([]MemSample, 0, len(s.samples))
+	out = append(out, s.samples[s.next:]...)
+	return append(out, s.samples[:s.next]...)
+}
+
+// Report writes one line per sample, in the same units as PrintMemUsage.
+func (s *MemSampler) Report(w io.Writer) error {
+	snaps := s.Snapshots()
+	if _, err := fmt.Fprintf(w, "Memory Usage (%d samples):\n", len(snaps)); err != nil {
+		return err
+	}
+	for _, m := range snaps {
+		_, err := fmt.Fprintf(w, "\t%s\tHeapAlloc = %v MiB\tHeapSys = %v MiB\tNumGC = %v\n",
+			m.Time.Format("15:04:05.000"), m.HeapAlloc/1024/1024, m.HeapSys/1024/1024, m.NumGC)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
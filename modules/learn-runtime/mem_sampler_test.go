@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemSamplerAccumulates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewMemSampler(16)
+	s.Start(ctx, 5*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(s.Snapshots()) < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d samples, want at least 4", len(s.Snapshots()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	snaps := s.Snapshots()
+	for i, m := range snaps {
+		if m.HeapAlloc == 0 {
+			t.Errorf("sample %d: HeapAlloc is zero", i)
+		}
+		if i > 0 && m.Time.Before(snaps[i-1].Time) {
+			t.Errorf("sample %d is older than sample %d", i, i-1)
+		}
+	}
+}
+
+func TestMemSamplerRingBuffer(t *testing.T) {
+	s := NewMemSampler(3)
+	for range 5 {
+		s.Sample()
+	}
+
+	snaps := s.Snapshots()
+	if len(snaps) != 3 {
+		t.Fatalf("got %d samples, want 3", len(snaps))
+	}
+	for i := 1; i < len(snaps); i++ {
+		if snaps[i].Time.Before(snaps[i-1].Time) {
+			t.Errorf("samples out of order at %d", i)
+		}
+	}
+}
+
+func TestMemSamplerReport(t *testing.T) {
+	s := NewMemSampler(4)
+	s.Sample()
+	s.Sample()
+
+	var b strings.Builder
+	if err := s.Report(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if !strings.HasPrefix(out, "Memory Usage (2 samples):") {
+		t.Errorf("unexpected header: %q", out)
+	}
+	if n := strings.Count(out, "HeapAlloc = "); n != 2 {
+		t.Errorf("got %d sample lines, want 2", n)
+	}
+}
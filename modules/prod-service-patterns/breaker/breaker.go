@@ -0,0 +1,270 @@
+// Package breaker is the circuit breaker from go-interview-practise/ch20,
+// copied here because this module's Docker build only sees its own
+// directory and cannot import across the workspace.
+//
+// It deliberately differs from ch20 in two ways. There is no
+// OperationTimeout: ch20 wraps ctx in it but never hands that ctx to the
+// operation, so it bounds nothing; callers here pass their own deadline.
+// And an operation that fails only because the caller's ctx ran out is not
+// counted as a failure, so clients sending tiny timeouts cannot trip the
+// breaker for everyone else. Clock is kept in sync with ch20.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State represents the current state of the circuit breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+// String returns the string representation of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "Closed"
+	case StateOpen:
+		return "Open"
+	case StateHalfOpen:
+		return "Half-Open"
+	default:
+		return "Unknown"
+	}
+}
+
+// Metrics represents the circuit breaker metrics
+type Metrics struct {
+	Requests            int64
+	Successes           int64
+	Failures            int64
+	ConsecutiveFailures int64
+	LastFailureTime     time.Time
+}
+
+// Config represents the configuration for the circuit breaker
+type Config struct {
+	Name          string                                  // Passed to OnStateChange
+	MaxRequests   uint32                                  // Max requests allowed in half-open state
+	Interval      time.Duration                           // Statistical window for closed state
+	Timeout       time.Duration                           // Time to wait before half-open
+	ReadyToTrip   func(Metrics) bool                      // Function to determine when to trip
+	OnStateChange func(name string, from State, to State) // State change callback
+	Clock         Clock                                   // Time source for Interval and Timeout; nil means the wall clock
+}
+
+// CircuitBreaker interface defines the operations for a circuit breaker
+type CircuitBreaker interface {
+	Call(ctx context.Context, operation func() (any, error)) (any, error)
+	GetState() State
+	GetMetrics() Metrics
+}
+
+var (
+	ErrCircuitBreakerOpen = errors.New("circuit breaker is open")
+	ErrTooManyRequests    = errors.New("too many requests in half-open state")
+)
+
+type circuitBreakerImpl struct {
+	config           Config
+	state            State
+	metrics          Metrics
+	lastStateChange  time.Time
+	halfOpenRequests uint32
+	windowStart      time.Time
+	mutex            sync.RWMutex
+}
+
+// NewCircuitBreaker creates a new circuit breaker with the given configuration
+func NewCircuitBreaker(config Config) CircuitBreaker {
+	if config.Name == "" {
+		config.Name = "circuit-breaker"
+	}
+	if config.MaxRequests == 0 {
+		config.MaxRequests = 1
+	}
+	if config.Interval == 0 {
+		config.Interval = time.Minute
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	if config.ReadyToTrip == nil {
+		config.ReadyToTrip = func(m Metrics) bool {
+			if m.Requests < 20 {
+				return false
+			}
+			return (float64(m.Failures) / float64(m.Requests)) >= 0.5
+		}
+	}
+
+	now := config.Clock.Now()
+	return &circuitBreakerImpl{
+		config:          config,
+		state:           StateClosed,
+		lastStateChange: now,
+		windowStart:     now,
+	}
+}
+
+// Call runs operation unless the breaker is open, and feeds the result back
+// into the breaker's state. The operation is expected to honor ctx itself;
+// when it fails with ctx's own cancellation or deadline the result says
+// nothing about the dependency and is not recorded. OnStateChange is called
+// outside the lock.
+func (cb *circuitBreakerImpl) Call(ctx context.Context, operation func() (any, error)) (any, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	cb.mutex.Lock()
+	notify, err := cb.canExecute()
+	cb.mutex.Unlock()
+	notify()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := operation()
+
+	cb.mutex.Lock()
+	if callerGaveUp(ctx, err) {
+		cb.releaseProbe()
+		notify = noStateChange
+	} else if err != nil {
+		notify = cb.recordFailure()
+	} else {
+		notify = cb.recordSuccess()
+	}
+	cb.mutex.Unlock()
+	notify()
+
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// callerGaveUp reports whether err is just ctx ending, not the operation
+// failing on its own.
+func callerGaveUp(ctx context.Context, err error) bool {
+	return ctx.Err() != nil &&
+		(errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled))
+}
+
+// releaseProbe hands back the half-open slot taken by a call whose result
+// is being ignored, so the next caller can probe instead.
+func (cb *circuitBreakerImpl) releaseProbe() {
+	if cb.state == StateHalfOpen && cb.halfOpenRequests > 0 {
+		cb.halfOpenRequests--
+	}
+}
+
+// GetState returns the current state of the circuit breaker
+func (cb *circuitBreakerImpl) GetState() State {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.state
+}
+
+// GetMetrics returns the current metrics of the circuit breaker
+func (cb *circuitBreakerImpl) GetMetrics() Metrics {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.metrics
+}
+
+func noStateChange() {}
+
+// setState switches state and returns the OnStateChange call to make once
+// the lock is released.
+func (cb *circuitBreakerImpl) setState(newState State) func() {
+	if cb.state == newState {
+		return noStateChange
+	}
+
+	oldState := cb.state
+	cb.state = newState
+	cb.lastStateChange = cb.config.Clock.Now()
+
+	switch newState {
+	case StateClosed:
+		cb.resetMetrics()
+	case StateHalfOpen:
+		cb.halfOpenRequests = 0
+	}
+
+	if cb.config.OnStateChange == nil {
+		return noStateChange
+	}
+	return func() { cb.config.OnStateChange(cb.config.Name, oldState, newState) }
+}
+
+func (cb *circuitBreakerImpl) resetMetrics() {
+	cb.metrics = Metrics{}
+	cb.halfOpenRequests = 0
+	cb.windowStart = cb.config.Clock.Now()
+}
+
+// canExecute decides whether a request may run in the current state.
+func (cb *circuitBreakerImpl) canExecute() (func(), error) {
+	switch cb.state {
+	case StateHalfOpen:
+		if cb.halfOpenRequests >= cb.config.MaxRequests {
+			return noStateChange, ErrTooManyRequests
+		}
+		cb.halfOpenRequests++
+		return noStateChange, nil
+	case StateOpen:
+		if cb.config.Clock.Now().Sub(cb.lastStateChange) > cb.config.Timeout {
+			notify := cb.setState(StateHalfOpen)
+			cb.halfOpenRequests++
+			return notify, nil
+		}
+		return noStateChange, ErrCircuitBreakerOpen
+	default:
+		return noStateChange, nil
+	}
+}
+
+func (cb *circuitBreakerImpl) checkWindow() {
+	if cb.state == StateClosed && cb.config.Clock.Now().Sub(cb.windowStart) > cb.config.Interval {
+		cb.resetMetrics()
+	}
+}
+
+func (cb *circuitBreakerImpl) recordSuccess() func() {
+	cb.checkWindow()
+	cb.metrics.Requests++
+	cb.metrics.Successes++
+	cb.metrics.ConsecutiveFailures = 0
+
+	// A single successful probe closes the circuit again.
+	if cb.state == StateHalfOpen {
+		return cb.setState(StateClosed)
+	}
+	return noStateChange
+}
+
+func (cb *circuitBreakerImpl) recordFailure() func() {
+	cb.checkWindow()
+	cb.metrics.Requests++
+	cb.metrics.Failures++
+	cb.metrics.ConsecutiveFailures++
+	cb.metrics.LastFailureTime = cb.config.Clock.Now()
+
+	if cb.state == StateHalfOpen || cb.config.ReadyToTrip(cb.metrics) {
+		return cb.setState(StateOpen)
+	}
+	return noStateChange
+}
@@ -9,6 +9,16 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	DB_PATH = "prod-service-patterns.db"
+
+	// BUSY_TIMEOUT_MS is how long a writer waits on a locked database before
+	// SQLite gives up with "database is locked".
+	BUSY_TIMEOUT_MS   = 5000
+	MAX_OPEN_CONNS    = 10
+	CONN_MAX_LIFETIME = 30 * time.Minute
+)
+
 type Database struct {
 	DB    *gorm.DB
 	Token chan struct{}
@@ -22,14 +32,9 @@ type User struct {
 }
 
 func NewDatabase(ctx context.Context, capacity int) (*Database, error) {
-	db, err := gorm.Open(sqlite.Open("prod-service-patterns.db"), &gorm.Config{})
+	db, err := openSQLite(DB_PATH)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect database %w", err)
-	}
-
-	// Automigrate User
-	if err := db.AutoMigrate(&User{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate user table: %w", err)
+		return nil, err
 	}
 
 	tokens := make(chan struct{}, capacity)
@@ -38,3 +43,28 @@ func NewDatabase(ctx context.Context, capacity int) (*Database, error) {
 	}
 	return &Database{DB: db, Token: tokens}, nil
 }
+
+// openSQLite opens the file at path in WAL mode with a busy timeout, so the
+// concurrent /process writers queue for the write lock instead of failing
+// with "database is locked". _txlock=immediate takes that lock at BEGIN,
+// which avoids the deadlock of two transactions upgrading from a read lock.
+func openSQLite(path string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, BUSY_TIMEOUT_MS)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql.DB: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(MAX_OPEN_CONNS)
+	sqlDB.SetConnMaxLifetime(CONN_MAX_LIFETIME)
+
+	// Automigrate User
+	if err := db.AutoMigrate(&User{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate user table: %w", err)
+	}
+	return db, nil
+}
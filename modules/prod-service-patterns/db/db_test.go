@@ -0,0 +1,49 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestOpenSQLiteConcurrentWrites(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "concurrent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mode string
+	if err := db.Raw("PRAGMA journal_mode").Scan(&mode).Error; err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want %q", mode, "wal")
+	}
+
+	const writers = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := User{Name: fmt.Sprintf("User-%d", i), Email: fmt.Sprintf("user-%d@example.com", i)}
+			errs <- db.Create(&user).Error
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	}
+
+	var n int64
+	db.Model(&User{}).Count(&n)
+	if n != writers {
+		t.Errorf("rows = %d, want %d", n, writers)
+	}
+}
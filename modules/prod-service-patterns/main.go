@@ -2,35 +2,170 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
+	"prod-service-patterns/breaker"
 	"prod-service-patterns/db"
 )
 
 const (
 	CAPACITY            = 10
 	jobIDKey contextKey = "job_id"
+
+	// DEFAULT_TIMEOUT is the per-request deadline used when the caller does not ask for one.
+	DEFAULT_TIMEOUT = 2 * time.Second
+	// MAX_TIMEOUT caps what a caller may request via the X-Request-Timeout header.
+	MAX_TIMEOUT = 10 * time.Second
+	// SHED_RETRY_AFTER is the Retry-After hint sent with a load-shedding 503.
+	SHED_RETRY_AFTER = 1 * time.Second
+
+	// BREAKER_TRIP_AFTER consecutive DB write failures open the store breaker;
+	// it stays open for BREAKER_COOLDOWN before letting a probe through.
+	BREAKER_TRIP_AFTER = 5
+	BREAKER_COOLDOWN   = 10 * time.Second
+
+	requestTimeoutHeader = "X-Request-Timeout"
+	jobIDHeader          = "X-Job-ID"
 )
 
 var (
 	jobID          uint64 = 0
 	successfulResp        = []byte("Processed successfully")
+
+	// ErrOverloaded is returned when no DB token is available and the request
+	// cannot wait for one (reject mode, or the bounded wait queue is full).
+	ErrOverloaded = errors.New("store overloaded, try again later")
+)
+
+// BackpressureMode selects what stepStore does when the token pool is empty.
+type BackpressureMode int
+
+const (
+	// BackpressureQueue waits for a token, bounded by AppConfig.QueueLimit.
+	BackpressureQueue BackpressureMode = iota
+	// BackpressureReject fails fast with ErrOverloaded.
+	BackpressureReject
 )
 
 type contextKey string
 
+// jobIDFromCtx returns the job ID stamped on ctx by handleProcess.
+func jobIDFromCtx(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(jobIDKey).(uint64)
+	return id, ok
+}
+
 type AppConfig struct {
 	DB  *db.Database
 	ctx context.Context
+
+	// RequestTimeout is the default deadline for a single /process call.
+	RequestTimeout time.Duration
+	// MaxRequestTimeout clamps any override sent through the X-Request-Timeout header.
+	MaxRequestTimeout time.Duration
+
+	// Backpressure selects reject-vs-queue behavior when the DB tokens run out.
+	Backpressure BackpressureMode
+	// QueueLimit bounds how many requests may wait for a token in queue mode.
+	// Zero means unbounded (wait until the request deadline).
+	QueueLimit int
+	waiting    atomic.Int64
+
+	// MaxInFlight turns on load shedding: once this many /process calls are
+	// running and no DB token is free, new calls get 503 before any step runs.
+	// Zero disables it.
+	MaxInFlight int
+	inFlight    atomic.Int64
+
+	// Breaker guards the DB write in stepStore. Nil leaves the write unprotected.
+	Breaker breaker.CircuitBreaker
+
+	// succeeded counts /process calls answered with 200, for /debug/vars.
+	succeeded atomic.Uint64
+}
+
+var (
+	publishOnce sync.Once
+	// varsApp is the AppConfig the /debug/vars counters read from.
+	varsApp atomic.Pointer[AppConfig]
+)
+
+// publishVars exposes live counters for appConfig under /debug/vars. expvar
+// names are process-wide and publishing one twice panics, so the vars are
+// registered once and read whichever AppConfig was passed in last.
+func publishVars(appConfig *AppConfig) {
+	varsApp.Store(appConfig)
+	publishOnce.Do(func() {
+		expvar.Publish("job_id", expvar.Func(func() any {
+			return atomic.LoadUint64(&jobID)
+		}))
+		expvar.Publish("db_tokens_available", expvar.Func(func() any {
+			return len(varsApp.Load().DB.Token)
+		}))
+		expvar.Publish("requests_succeeded", expvar.Func(func() any {
+			return varsApp.Load().succeeded.Load()
+		}))
+	})
+}
+
+// newStoreBreaker trips after BREAKER_TRIP_AFTER consecutive write failures
+// and logs every state transition.
+func newStoreBreaker() breaker.CircuitBreaker {
+	return breaker.NewCircuitBreaker(breaker.Config{
+		Name:    "db-store",
+		Timeout: BREAKER_COOLDOWN,
+		ReadyToTrip: func(m breaker.Metrics) bool {
+			return m.ConsecutiveFailures >= BREAKER_TRIP_AFTER
+		},
+		OnStateChange: func(name string, from, to breaker.State) {
+			log.Printf("[BREAKER] %s: %s -> %s", name, from, to)
+		},
+	})
+}
+
+// overloaded reports whether a request that makes inFlight concurrent calls
+// should be shed. Both signals must agree: a busy handler with free tokens is
+// still making progress, and an empty pool with few callers drains quickly.
+func (appConfig *AppConfig) overloaded(inFlight int64) bool {
+	return appConfig.MaxInFlight > 0 &&
+		inFlight > int64(appConfig.MaxInFlight) &&
+		len(appConfig.DB.Token) == 0
+}
+
+// requestTimeout resolves the deadline for r. A valid X-Request-Timeout header
+// (Go duration syntax, e.g. "500ms" or "3s") overrides the default and is clamped
+// to MaxRequestTimeout. Missing or invalid values fall back to the default.
+func (appConfig *AppConfig) requestTimeout(r *http.Request) time.Duration {
+	timeout := appConfig.RequestTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+	maxTimeout := appConfig.MaxRequestTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = MAX_TIMEOUT
+	}
+
+	if raw := r.Header.Get(requestTimeoutHeader); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			timeout = d
+		}
+	}
+
+	return min(timeout, maxTimeout)
 }
 
 func newHttpHandler(appConfig *AppConfig) http.Handler {
@@ -39,7 +174,8 @@ func newHttpHandler(appConfig *AppConfig) http.Handler {
 	return mux
 }
 
-func setupPProf(ctx context.Context) {
+// newDebugMux serves pprof plus the expvar counters at /debug/vars.
+func newDebugMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
@@ -50,8 +186,12 @@ func setupPProf(ctx context.Context) {
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Index)
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Index)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
 
-	server := &http.Server{Addr: ":9000", Handler: mux}
+func setupPProf(ctx context.Context) {
+	server := &http.Server{Addr: ":9000", Handler: newDebugMux()}
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Could not listen on %s: %v\n", ":9000", err)
@@ -86,8 +226,27 @@ func main() {
 	}
 
 	appConfig := &AppConfig{
-		DB:  db,
-		ctx: ctx,
+		DB:                db,
+		ctx:               ctx,
+		RequestTimeout:    DEFAULT_TIMEOUT,
+		MaxRequestTimeout: MAX_TIMEOUT,
+		Breaker:           newStoreBreaker(),
+	}
+	publishVars(appConfig)
+	if os.Getenv("BACKPRESSURE_MODE") == "reject" {
+		appConfig.Backpressure = BackpressureReject
+	}
+	if limit, err := strconv.Atoi(os.Getenv("QUEUE_LIMIT")); err == nil {
+		appConfig.QueueLimit = limit
+	}
+	if limit, err := strconv.Atoi(os.Getenv("MAX_IN_FLIGHT")); err == nil {
+		appConfig.MaxInFlight = limit
+	}
+	if d, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil && d > 0 {
+		appConfig.RequestTimeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("MAX_REQUEST_TIMEOUT")); err == nil && d > 0 {
+		appConfig.MaxRequestTimeout = d
 	}
 
 	handler := newHttpHandler(appConfig)
@@ -115,16 +274,26 @@ func main() {
 }
 
 func (appConfig *AppConfig) handleProcess(w http.ResponseWriter, r *http.Request) {
-	// 1. Create a derived context with a 2-second timeout
+	// 1. Create a derived context with the configured (or header-overridden) timeout
 	// 2. Call the steps in order: stepAuth -> stepValidate -> stepStore
 	// 3. If any step returns an error (including context timeout), return an appropriate HTTP error
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	inFlight := appConfig.inFlight.Add(1)
+	defer appConfig.inFlight.Add(-1)
+	if appConfig.overloaded(inFlight) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(SHED_RETRY_AFTER.Seconds())))
+		http.Error(w, ErrOverloaded.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), appConfig.requestTimeout(r))
 	defer cancel()
 
-	ctx = context.WithValue(ctx, jobIDKey, atomic.AddUint64(&jobID, 1))
+	id := atomic.AddUint64(&jobID, 1)
+	ctx = context.WithValue(ctx, jobIDKey, id)
+	w.Header().Set(jobIDHeader, strconv.FormatUint(id, 10))
 
-	if err := appConfig.stepAuth(ctx); err != nil {
+	if err := runStep(ctx, "auth", appConfig.stepAuth); err != nil {
 		if ctx.Err() != nil {
 			http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
 			return
@@ -134,7 +303,7 @@ func (appConfig *AppConfig) handleProcess(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := appConfig.stepValidate(ctx); err != nil {
+	if err := runStep(ctx, "validate", appConfig.stepValidate); err != nil {
 		if ctx.Err() != nil {
 			http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
 			return
@@ -143,24 +312,48 @@ func (appConfig *AppConfig) handleProcess(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := appConfig.stepStore(ctx); err != nil {
+	if err := runStep(ctx, "store", appConfig.stepStore); err != nil {
 		if ctx.Err() != nil {
 			http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
 			return
 		}
+		if errors.Is(err, ErrOverloaded) ||
+			errors.Is(err, breaker.ErrCircuitBreakerOpen) ||
+			errors.Is(err, breaker.ErrTooManyRequests) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	appConfig.succeeded.Add(1)
 	w.WriteHeader(http.StatusOK)
 	w.Write(successfulResp)
 }
 
+// runStep executes one pipeline step and emits a structured log line for its
+// transition, tagged with the job ID so slow requests can be correlated.
+func runStep(ctx context.Context, name string, step func(context.Context) error) error {
+	id, _ := jobIDFromCtx(ctx)
+	start := time.Now()
+
+	err := step(ctx)
+	attrs := []any{"job_id", id, "step", name, "elapsed", time.Since(start)}
+	if err != nil {
+		slog.WarnContext(ctx, "step failed", append(attrs, "error", err)...)
+		return err
+	}
+
+	slog.InfoContext(ctx, "step completed", attrs...)
+	return nil
+}
+
 func (appConfig *AppConfig) stepAuth(ctx context.Context) error {
 	delay := rand.Intn(500)
 	if os.Getenv("SLOW_AUTH") == "true" {
 		log.Println("[CHAOS] Slow Auth enabled - adding 3s delay")
-		delay = 3000 // Force it to exceed the 2s context timeout
+		delay = 3000 // Force it to exceed the default 2s context timeout
 	}
 
 	t := time.NewTimer(time.Duration(delay) * time.Millisecond)
@@ -191,6 +384,64 @@ func (appConfig *AppConfig) stepStore(ctx context.Context) error {
 		return fmt.Errorf("database connection refused")
 	}
 
+	if err := appConfig.acquireToken(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		appConfig.DB.Token <- struct{}{}
+	}()
+
+	select {
+	case <-ctx.Done(): // User left or Timeout
+		return ctx.Err()
+	case <-appConfig.ctx.Done(): // Global Shutdown
+		return appConfig.ctx.Err()
+	default:
+		id, _ := jobIDFromCtx(ctx)
+		user := db.User{
+			Name:  fmt.Sprintf("User-%v", id),
+			Email: fmt.Sprintf("user-%v@example.com", id),
+		}
+
+		return appConfig.guard(ctx, func() error {
+			return appConfig.DB.DB.WithContext(ctx).Create(&user).Error
+		})
+	}
+}
+
+// guard runs a DB write through the breaker, so a struggling database gets
+// fast failures instead of a pile of slow writers. Writes cut short by the
+// request's own deadline do not count against the database.
+func (appConfig *AppConfig) guard(ctx context.Context, write func() error) error {
+	if appConfig.Breaker == nil {
+		return write()
+	}
+	_, err := appConfig.Breaker.Call(ctx, func() (any, error) {
+		return nil, write()
+	})
+	return err
+}
+
+// acquireToken takes a DB token according to the configured backpressure mode.
+// Reject mode fails fast; queue mode waits, but only while fewer than QueueLimit
+// other requests are already waiting.
+func (appConfig *AppConfig) acquireToken(ctx context.Context) error {
+	select {
+	case <-appConfig.DB.Token:
+		return nil
+	default:
+	}
+
+	if appConfig.Backpressure == BackpressureReject {
+		return ErrOverloaded
+	}
+
+	waiting := appConfig.waiting.Add(1)
+	defer appConfig.waiting.Add(-1)
+	if appConfig.QueueLimit > 0 && waiting > int64(appConfig.QueueLimit) {
+		return ErrOverloaded
+	}
+
 	select {
 	case <-ctx.Done():
 		{
@@ -203,27 +454,6 @@ func (appConfig *AppConfig) stepStore(ctx context.Context) error {
 			return appConfig.ctx.Err()
 		}
 	case <-appConfig.DB.Token:
-		{
-			defer func() {
-				appConfig.DB.Token <- struct{}{}
-			}()
-
-			select {
-			case <-ctx.Done(): // User left or Timeout
-				return ctx.Err()
-			case <-appConfig.ctx.Done(): // Global Shutdown
-				return appConfig.ctx.Err()
-			default:
-				user := db.User{
-					Name:  fmt.Sprintf("User-%v", ctx.Value(jobIDKey)),
-					Email: fmt.Sprintf("user-%v@example.com", ctx.Value(jobIDKey)),
-				}
-
-				if err := appConfig.DB.DB.WithContext(ctx).Create(&user).Error; err != nil {
-					return err
-				}
-				return nil
-			}
-		}
+		return nil
 	}
 }
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"prod-service-patterns/breaker"
 	"prod-service-patterns/db"
 )
 
@@ -105,3 +112,384 @@ func BenchmarkHandleProcessLocal(b *testing.B) {
 		w.Body.Reset()
 	}
 }
+
+func TestRequestTimeout(t *testing.T) {
+	appConfig := &AppConfig{
+		RequestTimeout:    2 * time.Second,
+		MaxRequestTimeout: 5 * time.Second,
+	}
+
+	testCases := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "default without header", header: "", want: 2 * time.Second},
+		{name: "valid override", header: "500ms", want: 500 * time.Millisecond},
+		{name: "oversized value is clamped", header: "1m", want: 5 * time.Second},
+		{name: "invalid value falls back to default", header: "soon", want: 2 * time.Second},
+		{name: "negative value falls back to default", header: "-3s", want: 2 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/process", nil)
+			if tc.header != "" {
+				req.Header.Set(requestTimeoutHeader, tc.header)
+			}
+			if got := appConfig.requestTimeout(req); got != tc.want {
+				t.Errorf("requestTimeout() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// newTestApp builds an AppConfig backed by a throwaway SQLite file so local
+// tests never touch the prod-service-patterns.db used by `make run`.
+func newTestApp(t *testing.T, capacity int) *AppConfig {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	database, err := db.NewDatabase(ctx, capacity)
+	if err != nil {
+		t.Fatalf("failed to setup database: %v", err)
+	}
+
+	return &AppConfig{
+		DB:                database,
+		ctx:               ctx,
+		RequestTimeout:    DEFAULT_TIMEOUT,
+		MaxRequestTimeout: MAX_TIMEOUT,
+	}
+}
+
+func TestHandleProcessJobIDHeader(t *testing.T) {
+	appConfig := newTestApp(t, CAPACITY)
+	handler := http.HandlerFunc(appConfig.handleProcess)
+
+	var ids []uint64
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/process", nil))
+
+		raw := w.Header().Get(jobIDHeader)
+		if raw == "" {
+			t.Fatalf("expected %s header, got none (status %d)", jobIDHeader, w.Code)
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			t.Fatalf("invalid %s header %q: %v", jobIDHeader, raw, err)
+		}
+		ids = append(ids, id)
+	}
+
+	if ids[1] != ids[0]+1 {
+		t.Errorf("expected job IDs to increment, got %d then %d", ids[0], ids[1])
+	}
+}
+
+// saturate drains every token from the pool and returns a func that puts them back.
+func saturate(t *testing.T, appConfig *AppConfig) func() {
+	t.Helper()
+	n := cap(appConfig.DB.Token)
+	for range n {
+		<-appConfig.DB.Token
+	}
+	return func() {
+		for range n {
+			appConfig.DB.Token <- struct{}{}
+		}
+	}
+}
+
+func TestBackpressureRejectMode(t *testing.T) {
+	appConfig := newTestApp(t, 1)
+	appConfig.Backpressure = BackpressureReject
+	release := saturate(t, appConfig)
+	defer release()
+
+	start := time.Now()
+	err := appConfig.stepStore(context.Background())
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrOverloaded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("reject mode should fail fast, took %v", elapsed)
+	}
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(appConfig.handleProcess).ServeHTTP(w, httptest.NewRequest("GET", "/process", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestBackpressureQueueMode(t *testing.T) {
+	appConfig := newTestApp(t, 1)
+	appConfig.Backpressure = BackpressureQueue
+	appConfig.QueueLimit = 1
+	release := saturate(t, appConfig)
+
+	// The first request takes the only wait slot.
+	queued := make(chan error, 1)
+	go func() {
+		queued <- appConfig.stepStore(context.Background())
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for appConfig.waiting.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued request never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The wait queue is full, so the next request is rejected.
+	if err := appConfig.stepStore(context.Background()); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrOverloaded with a full wait queue, got %v", err)
+	}
+
+	// Freeing the token lets the queued request complete.
+	release()
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Fatalf("queued request failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queued request did not complete after token release")
+	}
+
+	if got := appConfig.waiting.Load(); got != 0 {
+		t.Errorf("expected empty wait queue, got %d", got)
+	}
+}
+
+func TestLoadShedding(t *testing.T) {
+	testCases := []struct {
+		name        string
+		maxInFlight int
+		running     int64 // other /process calls already in flight
+		wantCode    int
+		wantShed    bool
+	}{
+		{name: "saturated and over the limit sheds", maxInFlight: 2, running: 2, wantCode: http.StatusServiceUnavailable, wantShed: true},
+		{name: "under the limit waits and times out", maxInFlight: 2, running: 1, wantCode: http.StatusGatewayTimeout},
+		{name: "shedding disabled waits and times out", maxInFlight: 0, running: 10, wantCode: http.StatusGatewayTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			appConfig := newTestApp(t, 1)
+			appConfig.MaxInFlight = tc.maxInFlight
+			release := saturate(t, appConfig)
+			defer release()
+
+			appConfig.inFlight.Add(tc.running)
+			defer appConfig.inFlight.Add(-tc.running)
+
+			req := httptest.NewRequest("GET", "/process", nil)
+			// Long enough for auth and validate to finish, so a waiting
+			// request ends up timing out on the token.
+			req.Header.Set(requestTimeoutHeader, "700ms")
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			http.HandlerFunc(appConfig.handleProcess).ServeHTTP(w, req)
+			elapsed := time.Since(start)
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tc.wantCode)
+			}
+			if !tc.wantShed {
+				return
+			}
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("Retry-After = %q, want %q", got, "1")
+			}
+			if w.Header().Get(jobIDHeader) != "" {
+				t.Error("shed request should not have been assigned a job ID")
+			}
+			// stepAuth alone can take up to 500ms, so a fast answer means it never ran.
+			if elapsed > 50*time.Millisecond {
+				t.Errorf("shed request took %v, want an immediate rejection", elapsed)
+			}
+		})
+	}
+}
+
+func TestStoreBreaker(t *testing.T) {
+	appConfig := newTestApp(t, CAPACITY)
+	appConfig.Breaker = newStoreBreaker()
+
+	var logs bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	// With the table gone every insert fails inside SQLite.
+	if err := appConfig.DB.DB.Migrator().DropTable(&db.User{}); err != nil {
+		t.Fatalf("failed to drop users table: %v", err)
+	}
+
+	for i := range BREAKER_TRIP_AFTER {
+		err := appConfig.stepStore(context.Background())
+		if err == nil || errors.Is(err, breaker.ErrCircuitBreakerOpen) {
+			t.Fatalf("write %d: expected a DB error, got %v", i, err)
+		}
+	}
+	if got := appConfig.Breaker.GetState(); got != breaker.StateOpen {
+		t.Fatalf("breaker state = %v, want %v", got, breaker.StateOpen)
+	}
+	if !strings.Contains(logs.String(), "db-store: Closed -> Open") {
+		t.Errorf("expected the state change to be logged, got %q", logs.String())
+	}
+
+	failures := appConfig.Breaker.GetMetrics().Failures
+	start := time.Now()
+	err := appConfig.stepStore(context.Background())
+	if !errors.Is(err, breaker.ErrCircuitBreakerOpen) {
+		t.Fatalf("expected ErrCircuitBreakerOpen, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("open breaker should fail fast, took %v", elapsed)
+	}
+	if got := appConfig.Breaker.GetMetrics().Failures; got != failures {
+		t.Errorf("open breaker reached the DB: failures went from %d to %d", failures, got)
+	}
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(appConfig.handleProcess).ServeHTTP(w, httptest.NewRequest("GET", "/process", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestStoreBreakerIgnoresCallerTimeouts(t *testing.T) {
+	clock := breaker.NewFakeClock(time.Now())
+	appConfig := &AppConfig{Breaker: breaker.NewCircuitBreaker(breaker.Config{
+		Timeout: BREAKER_COOLDOWN,
+		Clock:   clock,
+		ReadyToTrip: func(m breaker.Metrics) bool {
+			return m.ConsecutiveFailures >= BREAKER_TRIP_AFTER
+		},
+	})}
+
+	// A write that only fails because the request's deadline ran out.
+	timedOut := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		return appConfig.guard(ctx, func() error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+	failing := func() error {
+		return appConfig.guard(context.Background(), func() error {
+			return errors.New("database connection refused")
+		})
+	}
+
+	for range BREAKER_TRIP_AFTER * 2 {
+		if err := timedOut(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+	}
+	if got := appConfig.Breaker.GetState(); got != breaker.StateClosed {
+		t.Fatalf("caller timeouts tripped the breaker: state = %v", got)
+	}
+	if m := appConfig.Breaker.GetMetrics(); m.Failures != 0 {
+		t.Errorf("caller timeouts were recorded as %d failures", m.Failures)
+	}
+
+	for range BREAKER_TRIP_AFTER {
+		failing()
+	}
+	if got := appConfig.Breaker.GetState(); got != breaker.StateOpen {
+		t.Fatalf("breaker state = %v, want %v", got, breaker.StateOpen)
+	}
+
+	// A half-open probe that times out gives its slot back instead of
+	// leaving the breaker stuck rejecting every later probe.
+	clock.Advance(BREAKER_COOLDOWN + time.Second)
+	if err := timedOut(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded from the probe, got %v", err)
+	}
+	if got := appConfig.Breaker.GetState(); got != breaker.StateHalfOpen {
+		t.Fatalf("breaker state = %v, want %v", got, breaker.StateHalfOpen)
+	}
+	if err := appConfig.guard(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("next probe should be let through, got %v", err)
+	}
+	if got := appConfig.Breaker.GetState(); got != breaker.StateClosed {
+		t.Errorf("breaker state = %v, want %v", got, breaker.StateClosed)
+	}
+}
+
+func TestDebugVars(t *testing.T) {
+	appConfig := newTestApp(t, CAPACITY)
+	publishVars(appConfig)
+	debug := newDebugMux()
+
+	vars := func() map[string]json.Number {
+		t.Helper()
+		w := httptest.NewRecorder()
+		debug.ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var raw map[string]any
+		dec := json.NewDecoder(w.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			t.Fatalf("failed to decode /debug/vars: %v", err)
+		}
+
+		got := make(map[string]json.Number)
+		for _, name := range []string{"job_id", "db_tokens_available", "requests_succeeded"} {
+			n, ok := raw[name].(json.Number)
+			if !ok {
+				t.Fatalf("expected numeric %q in /debug/vars, got %#v", name, raw[name])
+			}
+			got[name] = n
+		}
+		return got
+	}
+	asInt := func(n json.Number) int64 {
+		t.Helper()
+		v, err := n.Int64()
+		if err != nil {
+			t.Fatalf("expected an integer, got %q", n)
+		}
+		return v
+	}
+
+	before := vars()
+	if got := asInt(before["db_tokens_available"]); got != CAPACITY {
+		t.Errorf("db_tokens_available = %d, want %d", got, CAPACITY)
+	}
+
+	w := httptest.NewRecorder()
+	http.HandlerFunc(appConfig.handleProcess).ServeHTTP(w, httptest.NewRequest("GET", "/process", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	after := vars()
+	if got, want := asInt(after["job_id"]), asInt(before["job_id"])+1; got != want {
+		t.Errorf("job_id = %d, want %d", got, want)
+	}
+	if got, want := asInt(after["requests_succeeded"]), asInt(before["requests_succeeded"])+1; got != want {
+		t.Errorf("requests_succeeded = %d, want %d", got, want)
+	}
+
+	release := saturate(t, appConfig)
+	defer release()
+	if got := asInt(vars()["db_tokens_available"]); got != 0 {
+		t.Errorf("db_tokens_available with the pool drained = %d, want 0", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Package bodylimit caps how much of a request body a handler will read, so
+// one huge upload cannot exhaust memory while JSON is being decoded.
+package bodylimit
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// DEFAULT_MAX_BYTES is the body limit when none is configured.
+const DEFAULT_MAX_BYTES = 1 << 20
+
+// Wrap replaces r.Body with one that fails with *http.MaxBytesError after n
+// bytes. The error surfaces from whatever reads the body, typically a JSON
+// decoder; check it with IsTooLarge. It also tells the server to close the
+// connection instead of draining the rest of the oversized body.
+func Wrap(w http.ResponseWriter, r *http.Request, n int64) {
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+	}
+}
+
+// Handler applies Wrap to every request before calling next.
+func Handler(next http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Wrap(w, r, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsTooLarge reports whether err came from reading past a Wrap limit; the
+// handler should answer 413 Request Entity Too Large rather than 400.
+func IsTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// FromEnv reads a byte limit from the environment variable key, falling back
+// to DEFAULT_MAX_BYTES when it is unset or not a positive integer.
+func FromEnv(key string) int64 {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DEFAULT_MAX_BYTES
+}
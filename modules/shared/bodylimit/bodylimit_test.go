@@ -0,0 +1,62 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]string
+		err := json.NewDecoder(r.Body).Decode(&v)
+		switch {
+		case IsTooLarge(err):
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		case err != nil:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}), 32)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"under the limit", `{"a":"b"}`, http.StatusOK},
+		{"over the limit", fmt.Sprintf(`{"a":%q}`, strings.Repeat("x", 64)), http.StatusRequestEntityTooLarge},
+		{"malformed but small", `{"a":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", DEFAULT_MAX_BYTES},
+		{"4096", 4096},
+		{"0", DEFAULT_MAX_BYTES},
+		{"lots", DEFAULT_MAX_BYTES},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TEST_MAX_BODY_BYTES", tt.value)
+			if got := FromEnv("TEST_MAX_BODY_BYTES"); got != tt.want {
+				t.Errorf("FromEnv = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package dbtx runs database/sql transactions that survive SQLite lock
+// contention: a transaction that fails with SQLITE_BUSY is rolled back and
+// run again from the start after a short backoff.
+package dbtx
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Backoff between attempts doubles from baseDelay up to maxDelay.
+var (
+	baseDelay = 10 * time.Millisecond
+	maxDelay  = 500 * time.Millisecond
+)
+
+// IsBusy reports whether err is SQLite refusing a lock another connection
+// holds. The drivers only expose this through their own error types, so it
+// matches on the message to stay free of a driver dependency.
+func IsBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY")
+}
+
+// Retry calls op until it succeeds, fails with an error IsBusy does not
+// recognise, or has been retried maxRetries times. The last error is
+// returned unchanged.
+//
+// op must be safe to run again from scratch; for a transaction that means op
+// begins, and on failure rolls back, its own transaction. Use it directly for
+// drivers with their own transaction API, such as gorm's db.Transaction.
+func Retry(maxRetries int, op func() error) error {
+	delay := baseDelay
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !IsBusy(err) || attempt >= maxRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// WithRetryTx runs fn inside a transaction on db, committing if fn returns
+// nil and rolling back otherwise. If fn or the commit fails because the
+// database is busy, the whole transaction is retried up to maxRetries times.
+func WithRetryTx(db *sql.DB, fn func(*sql.Tx) error, maxRetries int) error {
+	return Retry(maxRetries, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
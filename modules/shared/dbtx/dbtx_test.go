@@ -0,0 +1,125 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errLocked = errors.New("database is locked")
+
+// fakeDB is a database/sql driver whose commits fail with errLocked until
+// busyCommits of them have been refused.
+type fakeDB struct {
+	busyCommits int
+	commits     int
+	rollbacks   int
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return f, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (f *fakeDB) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (f *fakeDB) Close() error                        { return nil }
+func (f *fakeDB) Begin() (driver.Tx, error)           { return f, nil }
+
+func (f *fakeDB) Commit() error {
+	if f.busyCommits > 0 {
+		f.busyCommits--
+		return errLocked
+	}
+	f.commits++
+	return nil
+}
+
+func (f *fakeDB) Rollback() error {
+	f.rollbacks++
+	return nil
+}
+
+func openFake(t *testing.T, busyCommits int) (*sql.DB, *fakeDB) {
+	t.Helper()
+	baseDelay, maxDelay = time.Millisecond, time.Millisecond
+	f := &fakeDB{busyCommits: busyCommits}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+func TestWithRetryTx(t *testing.T) {
+	t.Run("retries busy commits until one succeeds", func(t *testing.T) {
+		db, f := openFake(t, 2)
+		calls := 0
+		err := WithRetryTx(db, func(*sql.Tx) error { calls++; return nil }, 3)
+		if err != nil {
+			t.Fatalf("WithRetryTx = %v, want nil", err)
+		}
+		if calls != 3 || f.commits != 1 {
+			t.Errorf("fn ran %d times with %d commits, want 3 and 1", calls, f.commits)
+		}
+	})
+
+	t.Run("gives up after maxRetries", func(t *testing.T) {
+		db, f := openFake(t, 10)
+		calls := 0
+		err := WithRetryTx(db, func(*sql.Tx) error { calls++; return nil }, 2)
+		if !errors.Is(err, errLocked) {
+			t.Fatalf("WithRetryTx = %v, want %v", err, errLocked)
+		}
+		if calls != 3 || f.commits != 0 {
+			t.Errorf("fn ran %d times with %d commits, want 3 and 0", calls, f.commits)
+		}
+	})
+
+	t.Run("rolls back and does not retry other errors", func(t *testing.T) {
+		db, f := openFake(t, 0)
+		boom := errors.New("boom")
+		calls := 0
+		err := WithRetryTx(db, func(*sql.Tx) error { calls++; return boom }, 3)
+		if !errors.Is(err, boom) {
+			t.Fatalf("WithRetryTx = %v, want %v", err, boom)
+		}
+		if calls != 1 || f.rollbacks != 1 || f.commits != 0 {
+			t.Errorf("calls=%d rollbacks=%d commits=%d, want 1, 1, 0", calls, f.rollbacks, f.commits)
+		}
+	})
+
+	t.Run("retries when fn itself hits a lock", func(t *testing.T) {
+		db, f := openFake(t, 0)
+		calls := 0
+		err := WithRetryTx(db, func(*sql.Tx) error {
+			calls++
+			if calls == 1 {
+				return errLocked
+			}
+			return nil
+		}, 3)
+		if err != nil {
+			t.Fatalf("WithRetryTx = %v, want nil", err)
+		}
+		if f.rollbacks != 1 || f.commits != 1 {
+			t.Errorf("rollbacks=%d commits=%d, want 1 and 1", f.rollbacks, f.commits)
+		}
+	})
+}
+
+func TestIsBusy(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("database is locked"), true},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), true},
+		{errors.New("database table is locked: products"), true},
+		{sql.ErrNoRows, false},
+	}
+	for _, tt := range tests {
+		if got := IsBusy(tt.err); got != tt.want {
+			t.Errorf("IsBusy(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
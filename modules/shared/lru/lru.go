@@ -0,0 +1,76 @@
+// Package lru is a size-capped, least-recently-used cache that is safe for
+// concurrent use. It is meant as an in-memory front for lookups whose source
+// of truth lives elsewhere (usually a database), so memory stays bounded no
+// matter how many keys pass through.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Cache holds at most capacity entries. Get and Set both count as a use;
+// when a Set would go over capacity, the least recently used entry is dropped.
+type Cache[K comparable, V any] struct {
+	capacity int
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[K]*list.Element
+}
+
+// New returns an empty cache holding up to capacity entries. A capacity
+// below 1 is treated as 1.
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	return &Cache[K, V]{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key and marks it as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*entry[K, V]).value, true
+}
+
+// Set stores value under key, replacing any existing value, and evicts the
+// least recently used entry if the cache is over capacity.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Len is the number of entries currently cached.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
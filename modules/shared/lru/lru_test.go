@@ -0,0 +1,86 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	// Touch a so b becomes the oldest, then push one more in.
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v; want 1, true", v, ok)
+	}
+	c.Set("d", 4)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3, "d": 4} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %v; want %d, true", key, v, ok, want)
+		}
+	}
+	if c.Len() != 3 {
+		t.Errorf("Len = %d, want 3", c.Len())
+	}
+}
+
+func TestCacheSetReplacesAndRefreshes(t *testing.T) {
+	c := New[int, string](2)
+	c.Set(1, "one")
+	c.Set(2, "two")
+	c.Set(1, "uno") // update counts as a use, so 2 is now the oldest
+	c.Set(3, "three")
+
+	if v, _ := c.Get(1); v != "uno" {
+		t.Errorf("Get(1) = %q, want %q", v, "uno")
+	}
+	if _, ok := c.Get(2); ok {
+		t.Error("2 should have been evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+}
+
+func TestCacheZeroCapacity(t *testing.T) {
+	c := New[string, int](0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want 1", c.Len())
+	}
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Errorf("Get(b) = %d, %v; want 2, true", v, ok)
+	}
+}
+
+func TestCacheConcurrentUse(t *testing.T) {
+	const capacity = 64
+	c := New[string, int](capacity)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				key := fmt.Sprintf("k%d", (g*1000+i)%200)
+				c.Set(key, i)
+				c.Get(key)
+				c.Len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Len() > capacity {
+		t.Errorf("Len = %d, over capacity %d", c.Len(), capacity)
+	}
+}
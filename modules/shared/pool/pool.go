@@ -0,0 +1,82 @@
+// Package pool is the fan-out worker pool the modules keep hand-rolling:
+// a fixed number of goroutines pull inputs off a channel and write each
+// answer back at its input's index. The learn-routines BFS and Dijkstra
+// queries run on it.
+package pool
+
+import (
+	"context"
+	"sync"
+)
+
+// Run calls fn on every input using up to numWorkers goroutines and returns
+// the outputs in input order, so out[i] is fn's answer for inputs[i].
+//
+// The first error from fn cancels the context handed to the other calls,
+// stops new inputs from being started, and is returned once every worker has
+// exited. If ctx is cancelled before every input has run, Run returns
+// ctx.Err(). In both cases out still holds the answers that did complete.
+//
+// numWorkers below 1 is treated as 1, and no more goroutines than inputs are
+// started.
+func Run[In, Out any](ctx context.Context, inputs []In, numWorkers int, fn func(context.Context, In) (Out, error)) ([]Out, error) {
+	out := make([]Out, len(inputs))
+	if len(inputs) == 0 {
+		return out, ctx.Err()
+	}
+	numWorkers = min(max(numWorkers, 1), len(inputs))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered to len(inputs) so filling it never blocks.
+	indices := make(chan int, len(inputs))
+	for i := range inputs {
+		indices <- i
+	}
+	close(indices)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		done     int
+		wg       sync.WaitGroup
+	)
+
+	for range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if ctx.Err() != nil {
+					return
+				}
+
+				// Each index is owned by exactly one worker, so writing out[i]
+				// needs no lock.
+				v, err := fn(ctx, inputs[i])
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					out[i] = v
+					done++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return out, firstErr
+	}
+	if done < len(inputs) {
+		return out, ctx.Err()
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func square(_ context.Context, n int) (int, error) { return n * n, nil }
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputs     []int
+		numWorkers int
+		want       []int
+	}{
+		{"empty", nil, 4, []int{}},
+		{"single worker", []int{1, 2, 3}, 1, []int{1, 4, 9}},
+		{"several workers", []int{1, 2, 3, 4, 5, 6, 7, 8}, 3, []int{1, 4, 9, 16, 25, 36, 49, 64}},
+		{"more workers than inputs", []int{3, 4}, 16, []int{9, 16}},
+		{"zero workers", []int{5}, 0, []int{25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Run(context.Background(), tt.inputs, tt.numWorkers, square)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Run = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPreservesOrderWithUnevenWork(t *testing.T) {
+	inputs := []int{5, 1, 4, 2, 3}
+	got, err := Run(context.Background(), inputs, len(inputs), func(_ context.Context, n int) (int, error) {
+		// Later inputs finish first.
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		return n * 10, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{50, 10, 40, 20, 30}; !slices.Equal(got, want) {
+		t.Errorf("Run = %v, want %v", got, want)
+	}
+}
+
+func TestRunStopsOnFirstError(t *testing.T) {
+	errBoom := errors.New("boom")
+	var started atomic.Int32
+
+	inputs := make([]int, 100)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	_, err := Run(context.Background(), inputs, 2, func(ctx context.Context, n int) (int, error) {
+		started.Add(1)
+		if n == 3 {
+			return 0, errBoom
+		}
+		return n, nil
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("err = %v, want %v", err, errBoom)
+	}
+	if n := started.Load(); n == int32(len(inputs)) {
+		t.Errorf("all %d inputs ran after the error", n)
+	}
+}
+
+func TestRunCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	inputs := make([]int, 50)
+	var ran atomic.Int32
+	_, err := Run(ctx, inputs, 2, func(ctx context.Context, _ int) (int, error) {
+		if ran.Add(1) == 2 {
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Millisecond):
+		}
+		return 0, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if n := ran.Load(); n == int32(len(inputs)) {
+		t.Errorf("all %d inputs ran after cancellation", n)
+	}
+}
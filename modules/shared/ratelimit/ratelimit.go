@@ -0,0 +1,83 @@
+// Package ratelimit is a token-bucket rate limiter that is safe for
+// concurrent use. It limits how often something happens; bounding how many
+// things run at once is a semaphore's job, not this package's.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket holds up to burst tokens and refills at rate tokens per second.
+// Refill is lazy: each call tops the bucket up for the time elapsed since the
+// last one, so there is no ticker goroutine and fractional rates work.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. The clock starts at the first call,
+// so a bucket created ahead of time does not bank extra tokens.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Allow takes a token if one is available right now.
+func (b *TokenBucket) Allow() bool {
+	ok, _ := b.AllowAt(time.Now())
+	return ok
+}
+
+// AllowAt is Allow at an explicit time. When the bucket is empty it reports
+// how long until the next token is, which callers can turn into Retry-After.
+// Times earlier than the last call refill nothing.
+func (b *TokenBucket) AllowAt(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.last.IsZero() {
+		b.last = now
+	}
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Wait blocks until a token is available or ctx is done, whichever is first.
+// Waiters are not queued, so under contention one may be overtaken by a
+// later caller.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		ok, wait := b.AllowAt(time.Now())
+		if ok {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// LastUsed is when the bucket was last asked for a token, zero if never.
+// Owners of many buckets use it to drop idle ones.
+func (b *TokenBucket) LastUsed() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.last
+}
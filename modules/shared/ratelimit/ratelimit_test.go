@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAllowSteadyRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		burst    int
+		interval time.Duration // gap between requests
+		duration time.Duration
+	}{
+		{"under the rate", 10, 5, 200 * time.Millisecond, 10 * time.Second},
+		{"twice the rate", 5, 10, 100 * time.Millisecond, 10 * time.Second},
+		{"fractional rate", 0.5, 1, 100 * time.Millisecond, 20 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			b := NewTokenBucket(tt.rate, tt.burst)
+
+			var allowed, denied int
+			for now := start; now.Sub(start) < tt.duration; now = now.Add(tt.interval) {
+				if ok, _ := b.AllowAt(now); ok {
+					allowed++
+				} else {
+					denied++
+				}
+			}
+
+			// Nothing beyond the initial burst plus what refilled meanwhile.
+			sent := allowed + denied
+			want := min(float64(sent), float64(tt.burst)+tt.rate*tt.duration.Seconds())
+			if diff := float64(allowed) - want; diff > 1 || diff < -1 {
+				t.Errorf("allowed = %d, want %.1f±1 (denied %d of %d)", allowed, want, denied, sent)
+			}
+		})
+	}
+}
+
+func TestAllowAtReportsWait(t *testing.T) {
+	b := NewTokenBucket(4, 1)
+	now := time.Now()
+
+	if ok, _ := b.AllowAt(now); !ok {
+		t.Fatal("first token rejected")
+	}
+	ok, wait := b.AllowAt(now)
+	if ok || wait != 250*time.Millisecond {
+		t.Errorf("AllowAt = %v, %v; want false, 250ms", ok, wait)
+	}
+	if got := b.LastUsed(); !got.Equal(now) {
+		t.Errorf("LastUsed = %v, want %v", got, now)
+	}
+}
+
+func TestWaitBlocksUntilRefill(t *testing.T) {
+	b := NewTokenBucket(20, 1) // one token every 50ms
+	if !b.Allow() {
+		t.Fatal("first token rejected")
+	}
+
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("Wait returned after %v, want about 50ms", waited)
+	}
+}
+
+func TestWaitHonoursContext(t *testing.T) {
+	b := NewTokenBucket(0.1, 1) // next token in 10s
+	b.Allow()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := b.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want DeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("Wait returned after %v, want it to stop at the deadline", waited)
+	}
+}
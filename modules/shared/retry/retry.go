@@ -0,0 +1,72 @@
+// Package retry reruns an operation with exponential backoff until it
+// succeeds, fails with an error the caller does not want retried, runs out of
+// attempts, or its context is done.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryOpts configures Do. The zero value makes a single attempt.
+type RetryOpts struct {
+	// MaxAttempts counts the first call too; anything below 1 means 1.
+	MaxAttempts int
+
+	// The wait before retry n is BaseDelay*2^(n-1), capped at MaxDelay when
+	// MaxDelay is set.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter in [0, 1] shortens each wait by a random fraction up to Jitter,
+	// so clients that failed together do not all retry in lockstep.
+	Jitter float64
+
+	// Retryable reports whether err is worth another attempt. nil retries
+	// every error.
+	Retryable func(error) bool
+}
+
+// Do calls fn until it returns nil or Do gives up, and returns fn's last
+// error. If ctx is done before fn has succeeded, Do stops waiting and returns
+// ctx.Err() joined with the last error from fn, so errors.Is matches either.
+func Do(ctx context.Context, fn func() error, opts RetryOpts) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	attempts := max(opts.MaxAttempts, 1)
+	delay := opts.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts || (opts.Retryable != nil && !opts.Retryable(err)) {
+			return err
+		}
+
+		t := time.NewTimer(jitter(delay, opts.Jitter))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-t.C:
+		}
+
+		delay *= 2
+		if opts.MaxDelay > 0 {
+			delay = min(delay, opts.MaxDelay)
+		}
+	}
+}
+
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 || fraction <= 0 {
+		return d
+	}
+	fraction = min(fraction, 1)
+	return d - time.Duration(rand.Float64()*fraction*float64(d))
+}
@@ -0,0 +1,112 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errTransient = errors.New("transient")
+	errLast      = errors.New("still transient")
+	errFatal     = errors.New("fatal")
+)
+
+// failing returns an fn that fails with errs in order and then succeeds,
+// counting its calls in calls.
+func failing(calls *int, errs ...error) func() error {
+	return func() error {
+		*calls++
+		if *calls <= len(errs) {
+			return errs[*calls-1]
+		}
+		return nil
+	}
+}
+
+func TestDo(t *testing.T) {
+	opts := RetryOpts{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    2 * time.Millisecond,
+		Jitter:      0.5,
+		Retryable:   func(err error) bool { return !errors.Is(err, errFatal) },
+	}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{"first try", nil, nil, 1},
+		{"success on the nth try", []error{errTransient, errTransient}, nil, 3},
+		{"exhaustion returns the last error", []error{errTransient, errTransient, errLast, errTransient}, errLast, 3},
+		{"non-retryable error stops early", []error{errTransient, errFatal, errTransient}, errFatal, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), failing(&calls, tt.errs...), opts)
+			if err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoZeroOptsTriesOnce(t *testing.T) {
+	calls := 0
+	if err := Do(context.Background(), failing(&calls, errTransient), RetryOpts{}); err != errTransient {
+		t.Errorf("err = %v, want %v", err, errTransient)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestDoCancelledMidBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	fn := func() error {
+		calls++
+		// Cancel while Do is about to sleep for an hour.
+		cancel()
+		return errTransient
+	}
+
+	start := time.Now()
+	err := Do(ctx, fn, RetryOpts{MaxAttempts: 5, BaseDelay: time.Hour})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Do took %v, want it to stop on cancel", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errTransient) {
+		t.Errorf("err = %v, want context.Canceled joined with %v", err, errTransient)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	// A context that is already done does not call fn at all.
+	calls = 0
+	if err := Do(ctx, fn, RetryOpts{MaxAttempts: 5}); !errors.Is(err, context.Canceled) || calls != 0 {
+		t.Errorf("err = %v, calls = %d; want context.Canceled and no calls", err, calls)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const d = 100 * time.Millisecond
+	for range 100 {
+		if got := jitter(d, 0.25); got < 75*time.Millisecond || got > d {
+			t.Fatalf("jitter(%v, 0.25) = %v, want within [75ms, 100ms]", d, got)
+		}
+	}
+	if got := jitter(d, 0); got != d {
+		t.Errorf("jitter(%v, 0) = %v, want %v", d, got, d)
+	}
+}